@@ -0,0 +1,13 @@
+// Gojls lists jails like jls(8), using package jail:
+//
+//	gojls [-hnqv] [--libxo json] [-j jail] [param ...]
+//
+// With no flags it prints a table of JID, IP address, hostname and path; -v
+// adds the name, state, cpuset and every address. Naming parameters (or
+// passing -n, which on its own selects all of them) prints their values
+// instead, as name=value pairs with -n. -h prints the parameter names first,
+// and -q quotes values that contain spaces.
+//
+// -j limits the listing to one jail, given by JID or name. --libxo json
+// prints the same information as a JSON document shaped like jls's.
+package main
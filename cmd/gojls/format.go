@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lye/freebsd/jail"
+)
+
+// jailInfo is the part of *jail.Jail that gojls lists.
+type jailInfo interface {
+	Jid() int
+	Name() string
+	Hostname() string
+	Path() string
+	CpusetId() int
+	Dying() bool
+	IpAddrs() []net.IP
+	GetParams(names ...string) (map[string]interface{}, error)
+}
+
+type listOptions struct {
+	verbose   bool
+	nameValue bool
+	header    bool
+	quote     bool
+	libxo     string
+	jail      string
+	params    []string
+}
+
+func parseArgs(args []string, stderr io.Writer) (*listOptions, error) {
+	opts := &listOptions{}
+
+	flags := flag.NewFlagSet("gojls", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.BoolVar(&opts.verbose, "v", false, "verbose listing")
+	flags.BoolVar(&opts.nameValue, "n", false, "print parameters as name=value")
+	flags.BoolVar(&opts.header, "h", false, "print a header line of parameter names")
+	flags.BoolVar(&opts.quote, "q", false, "quote values containing spaces")
+	flags.StringVar(&opts.libxo, "libxo", "", "output format (only json is supported)")
+	flags.StringVar(&opts.jail, "j", "", "list only the jail with this JID or name")
+
+	if er := flags.Parse(args); er != nil {
+		return nil, er
+	}
+
+	if opts.libxo != "" && opts.libxo != "json" {
+		er := fmt.Errorf("Unsupported libxo format `%s'", opts.libxo)
+		fmt.Fprintf(stderr, "gojls: %s\n", er)
+		return nil, er
+	}
+
+	opts.params = flags.Args()
+	return opts, nil
+}
+
+// paramMode is true when parameter values are listed rather than one of the
+// fixed tables.
+func (opts *listOptions) paramMode() bool {
+	return opts.nameValue || len(opts.params) > 0
+}
+
+func listJails(w io.Writer, jails []jailInfo, opts *listOptions) error {
+	if opts.libxo == "json" {
+		return writeJSON(w, jails, opts)
+
+	} else if opts.paramMode() {
+		return writeParams(w, jails, opts)
+
+	} else if opts.verbose {
+		writeVerbose(w, jails)
+
+	} else {
+		writeDefault(w, jails)
+	}
+
+	return nil
+}
+
+// firstAddr is the address jls shows in its default listing: the first IPv4
+// address if there is one, otherwise the first IPv6 address.
+func firstAddr(j jailInfo) string {
+	addrs := j.IpAddrs()
+	if len(addrs) == 0 {
+		return ""
+	}
+
+	return addrs[0].String()
+}
+
+func jailState(j jailInfo) string {
+	if j.Dying() {
+		return "DYING"
+	}
+
+	return "ACTIVE"
+}
+
+func writeDefault(w io.Writer, jails []jailInfo) {
+	fmt.Fprintf(w, "   JID  IP Address      Hostname                      Path\n")
+
+	for _, j := range jails {
+		fmt.Fprintf(w, "%6d  %-15.15s %-29.29s %.74s\n", j.Jid(), firstAddr(j), j.Hostname(), j.Path())
+	}
+}
+
+func writeVerbose(w io.Writer, jails []jailInfo) {
+	fmt.Fprintf(w, "   JID  Hostname                      Path\n")
+	fmt.Fprintf(w, "        Name                          State\n")
+	fmt.Fprintf(w, "        CPUSetID\n")
+	fmt.Fprintf(w, "        IP Address(es)\n")
+
+	for _, j := range jails {
+		fmt.Fprintf(w, "%6d  %-29.29s %.74s\n", j.Jid(), j.Hostname(), j.Path())
+		fmt.Fprintf(w, "        %-29.29s %.6s\n", j.Name(), jailState(j))
+		fmt.Fprintf(w, "        %-6d\n", j.CpusetId())
+
+		for _, addr := range j.IpAddrs() {
+			fmt.Fprintf(w, "        %s\n", addr)
+		}
+	}
+}
+
+type paramValue struct {
+	name  string
+	value interface{}
+}
+
+// jailParams reads the requested parameters from a jail, in the order they
+// were asked for; with none requested, all of them in name order.
+func jailParams(j jailInfo, names []string) ([]paramValue, error) {
+	values, er := j.GetParams(names...)
+	if er != nil {
+		return nil, er
+	}
+
+	if len(names) == 0 {
+		for name := range values {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+	}
+
+	params := []paramValue{}
+
+	for _, name := range names {
+		params = append(params, paramValue{name, values[name]})
+	}
+
+	return params, nil
+}
+
+// noName negates a boolean parameter the way jail(8) does, by prefixing
+// the last component of its name with "no".
+func noName(name string) string {
+	idx := strings.LastIndex(name, ".") + 1
+	return name[:idx] + "no" + name[idx:]
+}
+
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+
+	case []net.IP:
+		addrs := []string{}
+		for _, ip := range v {
+			addrs = append(addrs, ip.String())
+		}
+
+		return strings.Join(addrs, ",")
+	}
+
+	return fmt.Sprint(value)
+}
+
+func quoteValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\"'\\") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+func writeParams(w io.Writer, jails []jailInfo, opts *listOptions) error {
+	printedHeader := false
+
+	for _, j := range jails {
+		params, er := jailParams(j, opts.params)
+		if er != nil {
+			return er
+		}
+
+		if opts.header && !printedHeader {
+			names := []string{}
+			for _, param := range params {
+				names = append(names, param.name)
+			}
+
+			fmt.Fprintln(w, strings.Join(names, " "))
+			printedHeader = true
+		}
+
+		fields := []string{}
+
+		for _, param := range params {
+			if b, ok := param.value.(bool); ok && opts.nameValue {
+				if b {
+					fields = append(fields, param.name)
+
+				} else {
+					fields = append(fields, noName(param.name))
+				}
+
+				continue
+			}
+
+			value := formatValue(param.value)
+			if opts.quote {
+				value = quoteValue(value)
+			}
+
+			if opts.nameValue {
+				value = param.name + "=" + value
+			}
+
+			fields = append(fields, value)
+		}
+
+		fmt.Fprintln(w, strings.Join(fields, " "))
+	}
+
+	return nil
+}
+
+// jsonObject is a JSON object that keeps its fields in order, as libxo does.
+type jsonObject []paramValue
+
+func (obj jsonObject) MarshalJSON() ([]byte, error) {
+	buf := []byte{'{'}
+
+	for i, field := range obj {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+
+		key, er := json.Marshal(field.name)
+		if er != nil {
+			return nil, er
+		}
+
+		value, er := json.Marshal(field.value)
+		if er != nil {
+			return nil, er
+		}
+
+		buf = append(append(append(buf, key...), ':'), value...)
+	}
+
+	return append(buf, '}'), nil
+}
+
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []net.IP:
+		addrs := []string{}
+		for _, ip := range v {
+			addrs = append(addrs, ip.String())
+		}
+
+		return addrs
+
+	case net.IP:
+		return v.String()
+
+	case jail.JailSys:
+		return string(v)
+	}
+
+	return value
+}
+
+func jsonJail(j jailInfo, opts *listOptions) (jsonObject, error) {
+	if opts.paramMode() {
+		params, er := jailParams(j, opts.params)
+		if er != nil {
+			return nil, er
+		}
+
+		obj := jsonObject{}
+		for _, param := range params {
+			obj = append(obj, paramValue{param.name, jsonValue(param.value)})
+		}
+
+		return obj, nil
+
+	} else if opts.verbose {
+		ip4, ip6 := []string{}, []string{}
+
+		for _, addr := range j.IpAddrs() {
+			if addr.To4() != nil {
+				ip4 = append(ip4, addr.String())
+
+			} else {
+				ip6 = append(ip6, addr.String())
+			}
+		}
+
+		return jsonObject{
+			{"jid", j.Jid()},
+			{"hostname", j.Hostname()},
+			{"path", j.Path()},
+			{"name", j.Name()},
+			{"state", jailState(j)},
+			{"cpusetid", j.CpusetId()},
+			{"ipv4_addrs", ip4},
+			{"ipv6_addrs", ip6},
+		}, nil
+	}
+
+	return jsonObject{
+		{"jid", j.Jid()},
+		{"ipv4", firstAddr(j)},
+		{"hostname", j.Hostname()},
+		{"path", j.Path()},
+	}, nil
+}
+
+func writeJSON(w io.Writer, jails []jailInfo, opts *listOptions) error {
+	list := []jsonObject{}
+
+	for _, j := range jails {
+		obj, er := jsonJail(j, opts)
+		if er != nil {
+			return er
+		}
+
+		list = append(list, obj)
+	}
+
+	doc := jsonObject{
+		{"__version", "2"},
+		{"jail-information", jsonObject{{"jail", list}}},
+	}
+
+	buf, er := json.Marshal(doc)
+	if er != nil {
+		return er
+	}
+
+	_, er = fmt.Fprintf(w, "%s\n", buf)
+	return er
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/lye/freebsd/jail"
+)
+
+// fakeJail stands in for a *jail.Jail.
+type fakeJail struct {
+	jid      int
+	name     string
+	hostname string
+	path     string
+	cpusetId int
+	dying    bool
+	addrs    []net.IP
+	params   map[string]interface{}
+}
+
+func (fj *fakeJail) Jid() int          { return fj.jid }
+func (fj *fakeJail) Name() string      { return fj.name }
+func (fj *fakeJail) Hostname() string  { return fj.hostname }
+func (fj *fakeJail) Path() string      { return fj.path }
+func (fj *fakeJail) CpusetId() int     { return fj.cpusetId }
+func (fj *fakeJail) Dying() bool       { return fj.dying }
+func (fj *fakeJail) IpAddrs() []net.IP { return fj.addrs }
+
+func (fj *fakeJail) GetParams(names ...string) (map[string]interface{}, error) {
+	if len(names) == 0 {
+		return fj.params, nil
+	}
+
+	params := map[string]interface{}{}
+
+	for _, name := range names {
+		value, ok := fj.params[name]
+		if !ok {
+			return nil, fmt.Errorf("Invalid parameter `%s'", name)
+		}
+
+		params[name] = value
+	}
+
+	return params, nil
+}
+
+func fixtureJails() []jailInfo {
+	return []jailInfo{
+		&fakeJail{
+			jid:      1,
+			name:     "www",
+			hostname: "www.example.org",
+			path:     "/jails/www",
+			cpusetId: 3,
+			addrs:    []net.IP{net.ParseIP("192.0.2.10").To4(), net.ParseIP("2001:db8::10")},
+			params: map[string]interface{}{
+				"jid":           1,
+				"name":          "www",
+				"host.hostname": "www.example.org",
+				"ip4":           jail.JailSysNew,
+				"ip4.addr":      []net.IP{net.ParseIP("192.0.2.10").To4()},
+				"persist":       true,
+				"allow.mount":   false,
+			},
+		},
+		&fakeJail{
+			jid:      7,
+			name:     "build",
+			hostname: "build box",
+			path:     "/jails/build",
+			cpusetId: 9,
+			dying:    true,
+			params: map[string]interface{}{
+				"jid":           7,
+				"name":          "build",
+				"host.hostname": "build box",
+				"ip4":           jail.JailSysDisable,
+				"ip4.addr":      []net.IP{},
+				"persist":       false,
+				"allow.mount":   true,
+			},
+		},
+	}
+}
+
+func runList(t *testing.T, args ...string) string {
+	opts, er := parseArgs(args, io.Discard)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	out := &bytes.Buffer{}
+	if er := listJails(out, fixtureJails(), opts); er != nil {
+		t.Fatal(er)
+	}
+
+	return out.String()
+}
+
+func TestListDefault(t *testing.T) {
+	expected := "" +
+		"   JID  IP Address      Hostname                      Path\n" +
+		"     1  192.0.2.10      www.example.org               /jails/www\n" +
+		"     7                  build box                     /jails/build\n"
+
+	if out := runList(t); out != expected {
+		t.Errorf("Default listing:\n%s", out)
+	}
+}
+
+func TestListVerbose(t *testing.T) {
+	expected := "" +
+		"   JID  Hostname                      Path\n" +
+		"        Name                          State\n" +
+		"        CPUSetID\n" +
+		"        IP Address(es)\n" +
+		"     1  www.example.org               /jails/www\n" +
+		"        www                           ACTIVE\n" +
+		"        3     \n" +
+		"        192.0.2.10\n" +
+		"        2001:db8::10\n" +
+		"     7  build box                     /jails/build\n" +
+		"        build                         DYING\n" +
+		"        9     \n"
+
+	if out := runList(t, "-v"); out != expected {
+		t.Errorf("Verbose listing:\n%s", out)
+	}
+}
+
+func TestListParams(t *testing.T) {
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{
+			[]string{"jid", "host.hostname"},
+			"1 www.example.org\n7 build box\n",
+		},
+		{
+			[]string{"-q", "-h", "jid", "host.hostname", "persist"},
+			"jid host.hostname persist\n1 www.example.org true\n7 \"build box\" false\n",
+		},
+		{
+			[]string{"-n", "-q", "name", "ip4", "ip4.addr", "persist", "allow.mount"},
+			"name=www ip4=new ip4.addr=192.0.2.10 persist allow.nomount\n" +
+				"name=build ip4=disable ip4.addr=\"\" nopersist allow.mount\n",
+		},
+		{
+			[]string{"-n"},
+			"allow.nomount host.hostname=www.example.org ip4=new ip4.addr=192.0.2.10 jid=1 name=www persist\n" +
+				"allow.mount host.hostname=build box ip4=disable ip4.addr= jid=7 name=build nopersist\n",
+		},
+	} {
+		if out := runList(t, tc.args...); out != tc.expected {
+			t.Errorf("Listing with %v:\n%s", tc.args, out)
+		}
+	}
+}
+
+func TestListJSON(t *testing.T) {
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{
+			[]string{"--libxo", "json"},
+			`{"__version":"2","jail-information":{"jail":[` +
+				`{"jid":1,"ipv4":"192.0.2.10","hostname":"www.example.org","path":"/jails/www"},` +
+				`{"jid":7,"ipv4":"","hostname":"build box","path":"/jails/build"}]}}` + "\n",
+		},
+		{
+			[]string{"--libxo=json", "-v"},
+			`{"__version":"2","jail-information":{"jail":[` +
+				`{"jid":1,"hostname":"www.example.org","path":"/jails/www","name":"www","state":"ACTIVE","cpusetid":3,"ipv4_addrs":["192.0.2.10"],"ipv6_addrs":["2001:db8::10"]},` +
+				`{"jid":7,"hostname":"build box","path":"/jails/build","name":"build","state":"DYING","cpusetid":9,"ipv4_addrs":[],"ipv6_addrs":[]}]}}` + "\n",
+		},
+		{
+			[]string{"--libxo", "json", "jid", "ip4", "ip4.addr", "persist"},
+			`{"__version":"2","jail-information":{"jail":[` +
+				`{"jid":1,"ip4":"new","ip4.addr":["192.0.2.10"],"persist":true},` +
+				`{"jid":7,"ip4":"disable","ip4.addr":[],"persist":false}]}}` + "\n",
+		},
+	} {
+		if out := runList(t, tc.args...); out != tc.expected {
+			t.Errorf("Listing with %v:\n%s", tc.args, out)
+		}
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	opts, er := parseArgs([]string{"-v", "-j", "www", "name", "path"}, io.Discard)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if !opts.verbose || opts.jail != "www" || len(opts.params) != 2 || !opts.paramMode() {
+		t.Errorf("Parsed %+v", opts)
+	}
+
+	if _, er := parseArgs([]string{"--libxo", "xml"}, io.Discard); er == nil {
+		t.Error("Unsupported libxo format accepted")
+	}
+
+	if _, er := parseArgs([]string{"-x"}, io.Discard); er == nil {
+		t.Error("Unknown flag accepted")
+	}
+}
+
+func TestListUnknownParam(t *testing.T) {
+	opts, er := parseArgs([]string{"bogus"}, io.Discard)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if er := listJails(io.Discard, fixtureJails(), opts); er == nil {
+		t.Error("Unknown parameter listed")
+	}
+}
@@ -0,0 +1,70 @@
+//go:build freebsd
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/lye/freebsd/jail"
+)
+
+func main() {
+	/* parseArgs has already explained what's wrong. */
+	opts, er := parseArgs(os.Args[1:], os.Stderr)
+	if er != nil {
+		os.Exit(2)
+	}
+
+	jails, er := selectJails(opts.jail)
+	if er != nil {
+		fmt.Fprintf(os.Stderr, "gojls: %s\n", er)
+		os.Exit(1)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+
+	if er := listJails(out, jails, opts); er != nil {
+		out.Flush()
+		fmt.Fprintf(os.Stderr, "gojls: %s\n", er)
+		os.Exit(1)
+	}
+
+	out.Flush()
+}
+
+// selectJails returns every jail, or just the one named by sel (a JID or
+// name).
+func selectJails(sel string) ([]jailInfo, error) {
+	if sel == "" {
+		jails, er := jail.EnumerateJails()
+		if er != nil {
+			return nil, er
+		}
+
+		infos := []jailInfo{}
+		for i := range jails {
+			infos = append(infos, &jails[i])
+		}
+
+		return infos, nil
+	}
+
+	var j *jail.Jail
+	var er error
+
+	if jid, convEr := strconv.Atoi(sel); convEr == nil {
+		j, er = jail.LookupByJid(jid)
+
+	} else {
+		j, er = jail.LookupByName(sel)
+	}
+
+	if er != nil {
+		return nil, fmt.Errorf("jail `%s': %s", sel, er)
+	}
+
+	return []jailInfo{j}, nil
+}
@@ -0,0 +1,13 @@
+//go:build !freebsd
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Fprintln(os.Stderr, "gojls: jails are only available on FreeBSD")
+	os.Exit(1)
+}
@@ -0,0 +1,190 @@
+//go:build freebsd
+
+package cpuset
+
+/*
+#include <sys/param.h>
+#include <sys/cpuset.h>
+#include <sys/domainset.h>
+
+static void cpuset_mask_zero(cpuset_t *mask) {
+	CPU_ZERO(mask);
+}
+
+static void cpuset_mask_set(cpuset_t *mask, int cpu) {
+	CPU_SET(cpu, mask);
+}
+
+static int cpuset_mask_isset(cpuset_t *mask, int cpu) {
+	return CPU_ISSET(cpu, mask);
+}
+
+static int domainset_mask_isset(domainset_t *mask, int domain) {
+	return DOMAINSET_ISSET(domain, mask);
+}
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+// cpuSetSize is CPU_SETSIZE, the number of CPUs a cpuset_t holds.
+const cpuSetSize = C.CPU_SETSIZE
+
+// Level selects which set a query or change applies to, relative to the
+// object named by a Which and an ID.
+type Level int
+
+const (
+	// LevelRoot is the root set the object belongs to, which bounds every
+	// set beneath it.
+	LevelRoot Level = C.CPU_LEVEL_ROOT
+
+	// LevelCpuset is the numbered set the object is assigned to, which may
+	// be shared with other objects.
+	LevelCpuset Level = C.CPU_LEVEL_CPUSET
+
+	// LevelWhich is the object's own mask. For a jail, that's the jail's
+	// set.
+	LevelWhich Level = C.CPU_LEVEL_WHICH
+)
+
+// Which is the kind of object an ID refers to.
+type Which int
+
+const (
+	WhichTid    Which = C.CPU_WHICH_TID
+	WhichPid    Which = C.CPU_WHICH_PID
+	WhichCpuset Which = C.CPU_WHICH_CPUSET
+	WhichIrq    Which = C.CPU_WHICH_IRQ
+	WhichJail   Which = C.CPU_WHICH_JAIL
+	WhichDomain Which = C.CPU_WHICH_DOMAIN
+)
+
+// Create makes a new set with the same CPUs as the calling process's root
+// set and moves the calling process into it, returning the new set's ID.
+// That's the only way the kernel creates sets; other processes can then be
+// moved into it with SetId.
+func Create() (int, error) {
+	var setid C.cpusetid_t
+
+	if _, er := C.cpuset(&setid); er != nil {
+		return 0, er
+	}
+
+	return int(setid), nil
+}
+
+// GetId returns the ID of the set at level for the object. An ID of -1
+// means the calling thread or process.
+func GetId(level Level, which Which, id int) (int, error) {
+	var setid C.cpusetid_t
+
+	if _, er := C.cpuset_getid(C.cpulevel_t(level), C.cpuwhich_t(which), C.id_t(id), &setid); er != nil {
+		return 0, er
+	}
+
+	return int(setid), nil
+}
+
+// SetId moves the object into the set setid. Only processes (WhichPid) can
+// be moved between sets.
+func SetId(which Which, id int, setid int) error {
+	_, er := C.cpuset_setid(C.cpuwhich_t(which), C.id_t(id), C.cpusetid_t(setid))
+	return er
+}
+
+// GetAffinity returns the CPUs the object may run on at level.
+func GetAffinity(level Level, which Which, id int) (CPUMask, error) {
+	var cmask C.cpuset_t
+
+	if _, er := C.cpuset_getaffinity(C.cpulevel_t(level), C.cpuwhich_t(which), C.id_t(id),
+		C.size_t(unsafe.Sizeof(cmask)), &cmask); er != nil {
+		return CPUMask{}, er
+	}
+
+	mask := CPUMask{}
+
+	for cpu := 0; cpu < C.CPU_SETSIZE; cpu++ {
+		if C.cpuset_mask_isset(&cmask, C.int(cpu)) != 0 {
+			mask.Set(cpu)
+		}
+	}
+
+	return mask, nil
+}
+
+// SetAffinity restricts the object to the CPUs in mask at level. The mask
+// must be a subset of the object's root set.
+func SetAffinity(level Level, which Which, id int, mask CPUMask) error {
+	var cmask C.cpuset_t
+	C.cpuset_mask_zero(&cmask)
+
+	for _, cpu := range mask.CPUs() {
+		if cpu >= C.CPU_SETSIZE {
+			return fmt.Errorf("CPU %d is out of range", cpu)
+		}
+
+		C.cpuset_mask_set(&cmask, C.int(cpu))
+	}
+
+	_, er := C.cpuset_setaffinity(C.cpulevel_t(level), C.cpuwhich_t(which), C.id_t(id),
+		C.size_t(unsafe.Sizeof(cmask)), &cmask)
+	return er
+}
+
+// DomainPolicyType is how memory is allocated across the domains in a
+// DomainPolicy.
+type DomainPolicyType int
+
+const (
+	PolicyRoundRobin DomainPolicyType = C.DOMAINSET_POLICY_ROUNDROBIN
+	PolicyFirstTouch DomainPolicyType = C.DOMAINSET_POLICY_FIRSTTOUCH
+	PolicyPrefer     DomainPolicyType = C.DOMAINSET_POLICY_PREFER
+	PolicyInterleave DomainPolicyType = C.DOMAINSET_POLICY_INTERLEAVE
+)
+
+// String returns the policy's name as cpuset(1) spells it.
+func (policy DomainPolicyType) String() string {
+	switch policy {
+	case PolicyRoundRobin:
+		return "round-robin"
+	case PolicyFirstTouch:
+		return "first-touch"
+	case PolicyPrefer:
+		return "prefer"
+	case PolicyInterleave:
+		return "interleave"
+	}
+
+	return "unknown"
+}
+
+// DomainPolicy describes which NUMA memory domains an object allocates from,
+// and how.
+type DomainPolicy struct {
+	Policy  DomainPolicyType
+	Domains []int
+}
+
+// GetDomainPolicy returns the memory domain policy of the object at level.
+func GetDomainPolicy(level Level, which Which, id int) (DomainPolicy, error) {
+	var cmask C.domainset_t
+	var policy C.int
+
+	if _, er := C.cpuset_getdomain(C.cpulevel_t(level), C.cpuwhich_t(which), C.id_t(id),
+		C.size_t(unsafe.Sizeof(cmask)), &cmask, &policy); er != nil {
+		return DomainPolicy{}, er
+	}
+
+	dp := DomainPolicy{Policy: DomainPolicyType(policy), Domains: []int{}}
+
+	for domain := 0; domain < C.DOMAINSET_SETSIZE; domain++ {
+		if C.domainset_mask_isset(&cmask, C.int(domain)) != 0 {
+			dp.Domains = append(dp.Domains, domain)
+		}
+	}
+
+	return dp, nil
+}
@@ -0,0 +1,3 @@
+// Provides access to cpuset(2), for restricting processes and jails to sets
+// of CPUs and inspecting their memory domain policies.
+package cpuset
@@ -0,0 +1,156 @@
+package cpuset
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// CPUMask is a set of CPUs, numbered from 0. The zero value is empty.
+type CPUMask struct {
+	words []uint64
+}
+
+// NewCPUMask returns a mask containing cpus.
+func NewCPUMask(cpus ...int) CPUMask {
+	mask := CPUMask{}
+
+	for _, cpu := range cpus {
+		mask.Set(cpu)
+	}
+
+	return mask
+}
+
+// ParseCPUMask parses a list of CPUs in the form cpuset(1) takes, e.g.
+// "0-3,8". CPUs must be below cpuSetSize, the most a cpuset can hold.
+func ParseCPUMask(s string) (CPUMask, error) {
+	mask := CPUMask{}
+
+	if strings.TrimSpace(s) == "" {
+		return mask, nil
+	}
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		first, last := field, field
+
+		if idx := strings.IndexByte(field, '-'); idx >= 0 {
+			first, last = field[:idx], field[idx+1:]
+		}
+
+		lo, er := strconv.Atoi(first)
+		if er != nil || lo < 0 {
+			return CPUMask{}, fmt.Errorf("Invalid CPU list `%s'", s)
+		}
+
+		hi, er := strconv.Atoi(last)
+		if er != nil || hi < lo || hi >= cpuSetSize {
+			return CPUMask{}, fmt.Errorf("Invalid CPU list `%s'", s)
+		}
+
+		for cpu := lo; cpu <= hi; cpu++ {
+			mask.Set(cpu)
+		}
+	}
+
+	return mask, nil
+}
+
+// Set adds cpu to the mask. Negative CPUs are ignored.
+func (m *CPUMask) Set(cpu int) {
+	if cpu < 0 {
+		return
+	}
+
+	for len(m.words) <= cpu/64 {
+		m.words = append(m.words, 0)
+	}
+
+	m.words[cpu/64] |= 1 << uint(cpu%64)
+}
+
+// Clear removes cpu from the mask.
+func (m *CPUMask) Clear(cpu int) {
+	if cpu >= 0 && cpu/64 < len(m.words) {
+		m.words[cpu/64] &^= 1 << uint(cpu%64)
+	}
+}
+
+// IsSet returns true if cpu is in the mask.
+func (m *CPUMask) IsSet(cpu int) bool {
+	return cpu >= 0 && cpu/64 < len(m.words) && m.words[cpu/64]&(1<<uint(cpu%64)) != 0
+}
+
+// Count returns the number of CPUs in the mask.
+func (m *CPUMask) Count() int {
+	n := 0
+
+	for _, word := range m.words {
+		n += bits.OnesCount64(word)
+	}
+
+	return n
+}
+
+// CPUs returns the CPUs in the mask in ascending order.
+func (m *CPUMask) CPUs() []int {
+	cpus := []int{}
+
+	for i, word := range m.words {
+		for word != 0 {
+			bit := bits.TrailingZeros64(word)
+			cpus = append(cpus, i*64+bit)
+			word &^= 1 << uint(bit)
+		}
+	}
+
+	return cpus
+}
+
+// Equal returns true if both masks contain the same CPUs.
+func (m *CPUMask) Equal(other CPUMask) bool {
+	for i := 0; i < len(m.words) || i < len(other.words); i++ {
+		var lhs, rhs uint64
+
+		if i < len(m.words) {
+			lhs = m.words[i]
+		}
+
+		if i < len(other.words) {
+			rhs = other.words[i]
+		}
+
+		if lhs != rhs {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String formats the mask as a CPU list, collapsing runs into ranges, e.g.
+// "0-3,8".
+func (m CPUMask) String() string {
+	cpus := m.CPUs()
+	ranges := []string{}
+
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+
+		if j > i {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+
+		} else {
+			ranges = append(ranges, strconv.Itoa(cpus[i]))
+		}
+
+		i = j + 1
+	}
+
+	return strings.Join(ranges, ",")
+}
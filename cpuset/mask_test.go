@@ -0,0 +1,79 @@
+package cpuset
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParseCPUMask(t *testing.T) {
+	for in, expected := range map[string][]int{
+		"0-3,8":     {0, 1, 2, 3, 8},
+		"5":         {5},
+		"":          {},
+		"1, 3 ,5-6": {1, 3, 5, 6},
+		"2-2":       {2},
+		"63-65":     {63, 64, 65},
+		"8,0-3,2":   {0, 1, 2, 3, 8},
+	} {
+		mask, er := ParseCPUMask(in)
+		if er != nil {
+			t.Errorf("%s: %s", in, er)
+			continue
+		}
+
+		if cpus := mask.CPUs(); !reflect.DeepEqual(cpus, expected) {
+			t.Errorf("%s: parsed as %v, expected %v", in, cpus, expected)
+		}
+
+		if mask.Count() != len(expected) {
+			t.Errorf("%s: counted %d CPUs, expected %d", in, mask.Count(), len(expected))
+		}
+	}
+
+	for _, bad := range []string{"x", "3-1", "-1", "1-", "1,,2", "0-3;8",
+		"0-2147483647", "4294967296", strconv.Itoa(cpuSetSize), fmt.Sprintf("0-%d", cpuSetSize)} {
+		if _, er := ParseCPUMask(bad); er == nil {
+			t.Errorf("Expected `%s' to be rejected", bad)
+		}
+	}
+	last := strconv.Itoa(cpuSetSize - 1)
+	if mask, er := ParseCPUMask(last); er != nil || !mask.IsSet(cpuSetSize-1) {
+		t.Errorf("Expected the last CPU in a cpuset to be accepted: %v", er)
+	}
+}
+
+func TestCPUMaskString(t *testing.T) {
+	for expected, cpus := range map[string][]int{
+		"0-3,8":       {0, 1, 2, 3, 8},
+		"":            {},
+		"1,3,5-6":     {6, 5, 3, 1},
+		"0,63-64,127": {0, 63, 64, 127},
+	} {
+		mask := NewCPUMask(cpus...)
+		if mask.String() != expected {
+			t.Errorf("%v: formatted as `%s', expected `%s'", cpus, mask, expected)
+		}
+	}
+}
+
+func TestCPUMaskOps(t *testing.T) {
+	mask := NewCPUMask(1, 70)
+
+	if !mask.IsSet(1) || !mask.IsSet(70) || mask.IsSet(2) || mask.IsSet(-1) || mask.IsSet(500) {
+		t.Errorf("Unexpected membership in %s", mask)
+	}
+
+	mask.Clear(70)
+	mask.Clear(500)
+
+	if !mask.Equal(NewCPUMask(1)) || mask.Equal(NewCPUMask(1, 2)) {
+		t.Errorf("Expected %s to equal just CPU 1", mask)
+	}
+
+	empty := CPUMask{}
+	if empty.Count() != 0 || len(empty.CPUs()) != 0 || !empty.Equal(NewCPUMask()) {
+		t.Errorf("The zero mask should be empty")
+	}
+}
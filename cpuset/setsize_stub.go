@@ -0,0 +1,7 @@
+//go:build !freebsd
+
+package cpuset
+
+// cpuSetSize is CPU_SETSIZE as FreeBSD defines it by default, so CPU lists
+// are parsed the same way elsewhere.
+const cpuSetSize = 1024
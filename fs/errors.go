@@ -0,0 +1,124 @@
+package fs
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// MountError describes a failed mount. It matches its errno with
+// errors.Is, e.g. errors.Is(er, syscall.EBUSY).
+type MountError struct {
+	FsType string
+	Source string
+	Target string
+	Flags  int
+
+	// Errno is the error nmount(2) returned.
+	Errno syscall.Errno
+
+	// Message is the kernel's explanation of the failure, if it gave one;
+	// it's usually more specific than the errno (e.g. "Invalid fstype").
+	Message string
+}
+
+func (me *MountError) Error() string {
+	what := me.Target
+	if me.FsType != "" {
+		what = me.FsType + " on " + me.Target
+	}
+
+	if me.Message != "" {
+		return fmt.Sprintf("mount %s: %s", what, me.Message)
+	}
+
+	return fmt.Sprintf("mount %s: %s", what, me.Errno)
+}
+
+func (me *MountError) Unwrap() error {
+	return me.Errno
+}
+
+// errmsgSize is the size of the buffer the kernel is given to explain
+// failures in, as mount(8) uses.
+const errmsgSize = 255
+
+// withErrmsg adds an errmsg buffer to args, returning the new args and the
+// index of the buffer's iovec in encodeIovecs's spans.
+func withErrmsg(args []mountArg) ([]mountArg, int) {
+	args = append(args[:len(args):len(args)], rawArg("errmsg", make([]byte, errmsgSize)))
+	return args, 2*len(args) - 1
+}
+
+// errmsgString extracts the message the kernel left in an errmsg buffer.
+func errmsgString(raw []byte) string {
+	if idx := bytes.IndexByte(raw, 0); idx >= 0 {
+		raw = raw[:idx]
+	}
+
+	return strings.TrimSpace(string(raw))
+}
+
+// argString returns the string value of the named option, or "".
+func argString(args []mountArg, name string) string {
+	for _, arg := range args {
+		if arg.name == name {
+			return string(bytes.TrimSuffix(arg.value, []byte{0}))
+		}
+	}
+
+	return ""
+}
+
+// newMountError describes the failure of nmount with args. Errors that
+// aren't errnos are returned untouched.
+func newMountError(args []mountArg, flags int, er error, msg string) error {
+	errno, ok := er.(syscall.Errno)
+	if !ok {
+		return er
+	}
+
+	return &MountError{
+		FsType:  argString(args, "fstype"),
+		Source:  argString(args, "from"),
+		Target:  argString(args, "fspath"),
+		Flags:   flags,
+		Errno:   errno,
+		Message: msg,
+	}
+}
+
+// UnmountFailure is a mount UnmountTree couldn't unmount.
+type UnmountFailure struct {
+	Target string
+	Err    error
+}
+
+// UnmountTreeError reports a partly failed UnmountTree: the mounts that
+// were unmounted, in the order they were, and those that weren't. It
+// matches the errors of the individual failures with errors.Is.
+type UnmountTreeError struct {
+	Root      string
+	Unmounted []string
+	Failed    []UnmountFailure
+}
+
+func (ue *UnmountTreeError) Error() string {
+	failed := make([]string, len(ue.Failed))
+	for i, failure := range ue.Failed {
+		failed[i] = fmt.Sprintf("%s: %s", failure.Target, failure.Err)
+	}
+
+	return fmt.Sprintf("unmount %s: %d of %d mounts failed: %s",
+		ue.Root, len(ue.Failed), len(ue.Failed)+len(ue.Unmounted), strings.Join(failed, "; "))
+}
+
+func (ue *UnmountTreeError) Unwrap() []error {
+	ers := make([]error, len(ue.Failed))
+	for i, failure := range ue.Failed {
+		ers[i] = failure.Err
+	}
+
+	return ers
+}
@@ -0,0 +1,78 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestMountError(t *testing.T) {
+	args, er := mountArgs("tmpfs", "tmpfs", "/tmp", []mountArg{stringArg("size", "lots")})
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	raw := make([]byte, errmsgSize)
+	copy(raw, "Invalid size\n")
+
+	er = newMountError(args, 0x4, syscall.EINVAL, errmsgString(raw))
+
+	var me *MountError
+	if !errors.As(er, &me) {
+		t.Fatalf("Expected a MountError, got %v", er)
+	}
+
+	if me.FsType != "tmpfs" || me.Source != "tmpfs" || me.Target != "/tmp" || me.Flags != 0x4 {
+		t.Errorf("Unexpected MountError %+v", me)
+	}
+
+	if er.Error() != "mount tmpfs on /tmp: Invalid size" {
+		t.Errorf("Unexpected message `%s'", er)
+	}
+
+	if !errors.Is(er, syscall.EINVAL) || errors.Is(er, syscall.EBUSY) {
+		t.Error("MountError doesn't match its errno")
+	}
+
+	er = newMountError(args, 0, syscall.EBUSY, "")
+
+	if !errors.Is(er, syscall.EBUSY) || er.Error() != "mount tmpfs on /tmp: "+syscall.EBUSY.Error() {
+		t.Errorf("Unexpected error without a message: %v", er)
+	}
+
+	if er := newMountError(args, 0, syscall.EEXIST, ""); !errors.Is(er, os.ErrExist) {
+		t.Error("MountError should match os.ErrExist through its errno")
+	}
+
+	other := errors.New("something else")
+	if er := newMountError(args, 0, other, ""); er != other {
+		t.Errorf("Non-errno error was wrapped: %v", er)
+	}
+}
+
+func TestWithErrmsg(t *testing.T) {
+	args := make([]mountArg, 2, 8)
+	args[0], args[1] = stringArg("fstype", "tmpfs"), stringArg("fspath", "/tmp")
+
+	withMsg, idx := withErrmsg(args)
+
+	/* The caller's args aren't scribbled on. */
+	if len(args) != 2 || len(args[:3][2].name) != 0 {
+		t.Error("withErrmsg modified its argument")
+	}
+
+	buf, spans := encodeIovecs(withMsg)
+
+	if idx != 5 || spans[idx-1].len != len("errmsg\x00") || spans[idx].len != errmsgSize {
+		t.Fatalf("errmsg buffer is at %d: %v", idx, spans)
+	}
+
+	if span := spans[idx]; span.off+span.len != len(buf) {
+		t.Errorf("errmsg span %v doesn't end the %d byte buffer", span, len(buf))
+	}
+
+	if msg := errmsgString([]byte("\x00stale")); msg != "" {
+		t.Errorf("Empty errmsg read as `%s'", msg)
+	}
+}
@@ -0,0 +1,114 @@
+package fs
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// MountOptions are filesystem options for nmount(2), as `mount -o` takes
+// them. Flags such as "ro" or "noexec" have an empty value; the rest are
+// described in each filesystem's man page (e.g. "size" for tmpfs).
+type MountOptions map[string]string
+
+// mountArg is a single option for nmount(2). Flags have a nil value.
+type mountArg struct {
+	name  string
+	value []byte
+}
+
+func stringArg(name, value string) mountArg {
+	return mountArg{name, append([]byte(value), 0)}
+}
+
+func flagArg(name string) mountArg {
+	return mountArg{name: name}
+}
+
+// rawArg is an option whose value is binary rather than a string, such as
+// the socket address NFS takes.
+func rawArg(name string, value []byte) mountArg {
+	return mountArg{name, value}
+}
+
+// args turns the options into mountArgs, in name order.
+func (opts MountOptions) args() []mountArg {
+	names := []string{}
+	for name := range opts {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	args := []mountArg{}
+
+	for _, name := range names {
+		if value := opts[name]; value == "" {
+			args = append(args, flagArg(name))
+
+		} else {
+			args = append(args, stringArg(name, value))
+		}
+	}
+
+	return args
+}
+
+// mountArgs returns everything nmount needs to mount fstype from from onto
+// to, followed by the filesystem's own options. An empty from is left out.
+func mountArgs(fstype, from, to string, fsArgs []mountArg) ([]mountArg, error) {
+	args := []mountArg{stringArg("fstype", fstype), stringArg("fspath", to)}
+
+	if from != "" {
+		args = append(args, stringArg("from", from))
+	}
+
+	args = append(args, fsArgs...)
+	seen := map[string]bool{}
+
+	for _, arg := range args {
+		if arg.name == "" || bytes.IndexByte([]byte(arg.name), 0) >= 0 {
+			return nil, fmt.Errorf("Invalid mount option `%s'", arg.name)
+
+		} else if seen[arg.name] {
+			return nil, fmt.Errorf("Mount option `%s' given twice", arg.name)
+		}
+
+		seen[arg.name] = true
+	}
+
+	if fstype == "" || to == "" {
+		return nil, fmt.Errorf("Mounting needs a filesystem type and a mount point")
+	}
+
+	return args, nil
+}
+
+// iovecSpan locates one iovec's data in the buffer built by encodeIovecs.
+// A span of length 0 is a NULL iovec.
+type iovecSpan struct {
+	off, len int
+}
+
+// encodeIovecs lays args out the way nmount(2) takes them: alternating name
+// and value iovecs, with all of their data packed into a single buffer.
+// Names are NUL-terminated; flags get a NULL value.
+func encodeIovecs(args []mountArg) ([]byte, []iovecSpan) {
+	buf := []byte{}
+	spans := []iovecSpan{}
+
+	for _, arg := range args {
+		spans = append(spans, iovecSpan{len(buf), len(arg.name) + 1})
+		buf = append(append(buf, arg.name...), 0)
+
+		if arg.value == nil {
+			spans = append(spans, iovecSpan{})
+
+		} else {
+			spans = append(spans, iovecSpan{len(buf), len(arg.value)})
+			buf = append(buf, arg.value...)
+		}
+	}
+
+	return buf, spans
+}
@@ -0,0 +1,91 @@
+package fs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMountOptionsArgs(t *testing.T) {
+	args := MountOptions{"size": "1g", "ro": "", "mode": "1777"}.args()
+
+	expected := []mountArg{
+		{"mode", []byte("1777\x00")},
+		{"ro", nil},
+		{"size", []byte("1g\x00")},
+	}
+
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Options became %q", args)
+	}
+}
+
+func TestMountArgs(t *testing.T) {
+	args, er := mountArgs("tmpfs", "tmpfs", "/tmp", []mountArg{flagArg("nonc")})
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	expected := []mountArg{
+		{"fstype", []byte("tmpfs\x00")},
+		{"fspath", []byte("/tmp\x00")},
+		{"from", []byte("tmpfs\x00")},
+		{"nonc", nil},
+	}
+
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Arguments are %q", args)
+	}
+
+	if args, er := mountArgs("procfs", "", "/proc", nil); er != nil || len(args) != 2 {
+		t.Errorf("Mounting without a source gave %q, %v", args, er)
+	}
+
+	for _, tc := range []struct {
+		fstype, to string
+		fsArgs     []mountArg
+	}{
+		{"", "/tmp", nil},
+		{"tmpfs", "", nil},
+		{"tmpfs", "/tmp", []mountArg{stringArg("fspath", "/elsewhere")}},
+		{"tmpfs", "/tmp", []mountArg{flagArg("ro"), flagArg("ro")}},
+		{"tmpfs", "/tmp", []mountArg{flagArg("")}},
+		{"tmpfs", "/tmp", []mountArg{flagArg("r\x00o")}},
+	} {
+		if _, er := mountArgs(tc.fstype, "tmpfs", tc.to, tc.fsArgs); er == nil {
+			t.Errorf("Expected %s on `%s' with %q to be rejected", tc.fstype, tc.to, tc.fsArgs)
+		}
+	}
+}
+
+func TestEncodeIovecs(t *testing.T) {
+	buf, spans := encodeIovecs([]mountArg{
+		stringArg("fstype", "nfs"),
+		flagArg("nfsv4"),
+		rawArg("addr", []byte{16, 2, 0, 0}),
+	})
+
+	if string(buf) != "fstype\x00nfs\x00nfsv4\x00addr\x00\x10\x02\x00\x00" {
+		t.Errorf("Buffer is %q", buf)
+	}
+
+	expected := []iovecSpan{
+		{0, 7}, {7, 4},
+		{11, 6}, {0, 0},
+		{17, 5}, {22, 4},
+	}
+
+	if !reflect.DeepEqual(spans, expected) {
+		t.Errorf("Spans are %v", spans)
+	}
+
+	/* Every span must lie within the buffer. */
+	for _, span := range spans {
+		if span.off+span.len > len(buf) {
+			t.Errorf("Span %v overruns the %d byte buffer", span, len(buf))
+		}
+	}
+
+	if buf, spans := encodeIovecs(nil); len(buf) != 0 || len(spans) != 0 {
+		t.Errorf("Nothing encoded to %q, %v", buf, spans)
+	}
+}
@@ -0,0 +1,163 @@
+//go:build freebsd
+
+package fs
+
+/*
+#include <sys/param.h>
+#include <sys/mount.h>
+*/
+import "C"
+import (
+	"context"
+	"sync"
+	"syscall"
+)
+
+// vfsTracker uses kqueue's EVFILT_FS to hear about filesystems being
+// mounted and unmounted, so the watcher can poll right away instead of
+// waiting out the interval. The loop owns the kqueue and closes it when it
+// stops, whether it's told to or kevent fails.
+type vfsTracker struct {
+	kq   int
+	wake chan struct{}
+
+	// failed receives the error that stopped the loop, if it wasn't
+	// stopped by close.
+	failed chan error
+
+	lock   sync.Mutex
+	closed bool
+}
+
+func newVfsTracker() (*vfsTracker, error) {
+	kq, er := syscall.Kqueue()
+	if er != nil {
+		return nil, er
+	}
+
+	/* The user event is only used to tell the loop to stop. */
+	changes := make([]syscall.Kevent_t, 2)
+	syscall.SetKevent(&changes[0], 0, syscall.EVFILT_USER, syscall.EV_ADD|syscall.EV_CLEAR)
+	syscall.SetKevent(&changes[1], 0, syscall.EVFILT_FS, syscall.EV_ADD|syscall.EV_CLEAR)
+
+	if _, er := syscall.Kevent(kq, changes, nil, nil); er != nil {
+		syscall.Close(kq)
+		return nil, er
+	}
+
+	vt := &vfsTracker{kq: kq, wake: make(chan struct{}, 1), failed: make(chan error, 1)}
+	go vt.loop()
+
+	return vt, nil
+}
+
+func (vt *vfsTracker) loop() {
+	events := make([]syscall.Kevent_t, 16)
+
+	for {
+		n, er := syscall.Kevent(vt.kq, nil, events, nil)
+		if er == syscall.EINTR {
+			continue
+
+		} else if er != nil {
+			vt.release()
+			vt.failed <- er
+			return
+		}
+
+		changed := false
+
+		for _, event := range events[:n] {
+			if event.Filter == syscall.EVFILT_USER {
+				vt.release()
+				return
+			}
+
+			/* EVFILT_FS also reports filesystems that stop responding
+			 * and the like, which don't change the mount table. */
+			if event.Fflags&(C.VQ_MOUNT|C.VQ_UNMOUNT) != 0 {
+				changed = true
+			}
+		}
+
+		if !changed {
+			continue
+		}
+
+		select {
+		case vt.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// release closes the kqueue; once it has, close leaves the descriptor (which
+// may have been reused by then) alone.
+func (vt *vfsTracker) release() {
+	vt.lock.Lock()
+	defer vt.lock.Unlock()
+
+	vt.closed = true
+	syscall.Close(vt.kq)
+}
+
+func (vt *vfsTracker) close() {
+	vt.lock.Lock()
+	defer vt.lock.Unlock()
+
+	if vt.closed {
+		return
+	}
+
+	change := syscall.Kevent_t{}
+	syscall.SetKevent(&change, 0, syscall.EVFILT_USER, 0)
+	change.Fflags = syscall.NOTE_TRIGGER
+
+	syscall.Kevent(vt.kq, []syscall.Kevent_t{change}, nil, nil)
+}
+
+func snapshotMounts() ([]MountState, error) {
+	infos := GetMountInfo()
+
+	snapshot := make([]MountState, len(infos))
+	for i := range infos {
+		snapshot[i] = &infos[i]
+	}
+
+	return snapshot, nil
+}
+
+// WatchMounts reports filesystems being mounted, remounted and unmounted
+// until ctx is done, at which point the returned channel is closed.
+// Filesystems that are already mounted are reported as mounted first.
+//
+// Changes are found by comparing successive snapshots of the mount table,
+// taken every second. Where kqueue is available, the kernel's notice of a
+// mount or unmount triggers a snapshot straight away; remounts are only
+// noticed by polling, as the kernel doesn't announce them. Should kqueue
+// fail while watching, a NotificationsLost event is sent and the watcher
+// carries on polling.
+func WatchMounts(ctx context.Context) (<-chan MountEvent, error) {
+	w := &mountWatcher{snapshot: snapshotMounts, interval: defaultWatchInterval}
+
+	vt, er := newVfsTracker()
+	if er != nil {
+		return w.start(ctx)
+	}
+
+	w.wake = vt.wake
+	w.failed = vt.failed
+
+	events, er := w.start(ctx)
+	if er != nil {
+		vt.close()
+		return nil, er
+	}
+
+	go func() {
+		<-ctx.Done()
+		vt.close()
+	}()
+
+	return events, nil
+}
@@ -1,3 +1,5 @@
+//go:build freebsd
+
 package fs
 
 /*
@@ -5,51 +7,94 @@ package fs
 #include <sys/param.h>
 #include <sys/mount.h>
 #include <sys/uio.h>
+#include <stdlib.h>
 */
 import "C"
 import (
-	"fmt"
 	"sync"
 	"unsafe"
 )
 
 var mountLock sync.RWMutex
 
-func nmount(options map[string][]byte, flags int) (*MountInfo, error) {
+// nmount passes args to nmount(2), along with a buffer for the kernel to
+// explain any failure in; failures are returned as a *MountError. The
+// iovecs and everything they point to are copied into C memory first.
+func nmount(args []mountArg, flags int) error {
 	mountLock.Lock()
 	defer mountLock.Unlock()
 
-	toBytes, ok := options["fspath"]
-	if !ok {
-		return nil, fmt.Errorf("fspath non-optional")
-	}
+	withMsg, errmsgIdx := withErrmsg(args)
+	buf, spans := encodeIovecs(withMsg)
 
-	to := string(toBytes)
+	cbuf := C.CBytes(buf)
+	defer C.free(cbuf)
 
-	var iovs []C.struct_iovec
-	var iov C.struct_iovec
+	ciovs := C.calloc(C.size_t(len(spans)), C.sizeof_struct_iovec)
+	defer C.free(ciovs)
 
-	for k, value := range options {
-		key := []byte(k)
-		key = append(key, 0)
-		value = append(value, 0)
+	iovs := unsafe.Slice((*C.struct_iovec)(ciovs), len(spans))
+
+	for i, span := range spans {
+		if span.len > 0 {
+			iovs[i].iov_base = unsafe.Add(cbuf, span.off)
+			iovs[i].iov_len = C.size_t(span.len)
+		}
+	}
 
-		iov.iov_base = unsafe.Pointer(&key[0])
-		iov.iov_len = C.size_t(len(key))
-		iovs = append(iovs, iov)
+	if rv, er := C.nmount(&iovs[0], C.uint(len(iovs)), C.int(flags)); rv != 0 {
+		errmsg := spans[errmsgIdx]
+		msg := errmsgString(C.GoBytes(unsafe.Add(cbuf, errmsg.off), C.int(errmsg.len)))
 
-		iov.iov_base = unsafe.Pointer(&value[0])
-		iov.iov_len = C.size_t(len(value))
-		iovs = append(iovs, iov)
+		return newMountError(args, flags, er, msg)
 	}
 
-	if _, er := C.nmount(&iovs[0], C.uint(len(iovs)), C.int(flags)); er != nil {
+	return nil
+}
+
+func mount(fstype, from, to string, fsArgs []mountArg, flags int) (*MountInfo, error) {
+	args, er := mountArgs(fstype, from, to, fsArgs)
+	if er != nil {
+		return nil, er
+	}
+
+	if er := nmount(args, flags); er != nil {
 		return nil, er
 	}
 
 	return MountInfoForPath(to)
 }
 
+// Mount mounts a filesystem of type fstype from the named source onto to,
+// with options given as `mount -o` would take them. For filesystems that
+// aren't backed by anything, from is just the name shown by mount(8).
+func Mount(fstype, from, to string, opts MountOptions, flags int) (*MountInfo, error) {
+	return mount(fstype, from, to, opts.args(), flags)
+}
+
+// MountWith mounts a filesystem from the named source onto to, with the
+// typed options for its filesystem type.
+func MountWith(from, to string, opts FsOptions, flags int) (*MountInfo, error) {
+	fsArgs, er := opts.mountArgs(from)
+	if er != nil {
+		return nil, er
+	}
+
+	return mount(opts.FsType(), from, to, fsArgs, flags)
+}
+
+// MountDevfs mounts a devfs at to. If ruleset isn't 0, the devfs.rules(5)
+// ruleset with that number is applied to it, hiding whatever devices the
+// ruleset doesn't unhide.
+func MountDevfs(to string, ruleset int, flags int) (*MountInfo, error) {
+	return MountWith("devfs", to, DevfsOptions{Ruleset: ruleset}, flags)
+}
+
+// MountTmpfs mounts a tmpfs(5), a filesystem kept in memory, at to.
+func MountTmpfs(to string, opts TmpfsOptions, flags int) (*MountInfo, error) {
+	return MountWith("tmpfs", to, opts, flags)
+}
+
 // MountNullfs mounts a path on top an arbitrary mountpoint. The filesystem
 // at the mountpoint is not accessible under the nullfs mount (as opposed
 // to a unionfs mount). The mounted and mountee must be distinct paths or the
@@ -57,13 +102,7 @@ func nmount(options map[string][]byte, flags int) (*MountInfo, error) {
 //
 // Requires the nullfs kernel module.
 func MountNullfs(from, to string, flags int) (*MountInfo, error) {
-	args := map[string][]byte{
-		"fstype": []byte("nullfs"),
-		"fspath": []byte(to),
-		"target": []byte(from),
-	}
-
-	return nmount(args, flags)
+	return MountWith(from, to, NullfsOptions{}, flags)
 }
 
 // MountUnionfs mounts a path on top of an arbitrary mountpoint. The filesystem
@@ -74,23 +113,11 @@ func MountNullfs(from, to string, flags int) (*MountInfo, error) {
 // made on the top filesystem and accessing the original file will be very
 // difficult.
 func MountUnionfs(from, to string, flags int) (*MountInfo, error) {
-	args := map[string][]byte{
-		"fstype": []byte("unionfs"),
-		"fspath": []byte(to),
-		"from":   []byte(from),
-	}
-
-	return nmount(args, flags)
+	return MountWith(from, to, UnionfsOptions{}, flags)
 }
 
 // MountUfs mounts a normal UFS filesystem. from should be a character device
 // containing a valid, *trusted* UFS filesystem.
 func MountUfs(from, to string, flags int) (*MountInfo, error) {
-	args := map[string][]byte{
-		"fstype": []byte("ufs"),
-		"fspath": []byte(to),
-		"from":   []byte(from),
-	}
-
-	return nmount(args, flags)
+	return MountWith(from, to, UfsOptions{}, flags)
 }
@@ -1,3 +1,5 @@
+//go:build freebsd
+
 package fs
 
 /* 
@@ -5,6 +7,7 @@ package fs
 #include <sys/param.h>
 #include <sys/ucred.h>
 #include <sys/mount.h>
+#include <stdlib.h>
 
 struct statfs* offset(struct statfs *v, int i) {
 	return v + i;
@@ -15,6 +18,7 @@ import (
 	"fmt"
 	"os/user"
 	"sync"
+	"unsafe"
 )
 
 // MountInfo is a struct returned by the statfs system call. Accessor
@@ -165,6 +169,19 @@ func (mi *MountInfo) NumAsyncReads() uint64 {
 	return uint64(mi.f_asyncreads)
 }
 
+// Size returns the size of the filesystem in bytes (f_blocks * f_bsize).
+// For a tmpfs this is its configured size; one mounted without a size
+// reports however much memory and swap it could currently grow into.
+func (mi *MountInfo) Size() uint64 {
+	return mi.NumBlocks() * mi.BlockSize()
+}
+
+// UsedSize returns the number of bytes in use on the filesystem
+// ((f_blocks - f_bfree) * f_bsize).
+func (mi *MountInfo) UsedSize() uint64 {
+	return (mi.NumBlocks() - mi.NumFreeBlocks()) * mi.BlockSize()
+}
+
 // OwnerId returns f_owner, the string-encoded uid of the user that mounted
 // the filesystem.
 func (mi *MountInfo) OwnerId() string {
@@ -197,10 +214,58 @@ func (mi *MountInfo) MntToName() string {
 	return C.GoString(&mi.f_mntonname[0])
 }
 
+func (mi *MountInfo) mountPoint() mountPoint {
+	fsid := mi.FilesystemId()
+	return mountPoint{path: mi.MntToName(), fsid: [2]int32{fsid[0], fsid[1]}}
+}
+
+func unmount(mp mountPoint, opts UnmountOpts) error {
+	flags := 0
+	if opts.Force {
+		flags |= C.MNT_FORCE
+	}
+
+	if opts.ByFsid {
+		flags |= C.MNT_BYFSID
+	}
+
+	target := C.CString(mp.unmountTarget(opts))
+	defer C.free(unsafe.Pointer(target))
+
+	if rv, er := C.unmount(target, C.int(flags)); rv != 0 {
+		return er
+	}
+
+	return nil
+}
+
 // Unmount unmounts the filesystem.
 func (mi *MountInfo) Unmount() error {
-	_, er := C.unmount(&mi.f_mntonname[0], 0)
-	return er
+	return mi.UnmountWith(UnmountOpts{})
+}
+
+// UnmountWith unmounts the filesystem with the given options.
+func (mi *MountInfo) UnmountWith(opts UnmountOpts) error {
+	return unmount(mi.mountPoint(), opts)
+}
+
+// UnmountTree unmounts every filesystem mounted at or beneath root, deepest
+// first. Filesystems are always named by fsid, so ones mounted over are
+// still reached. It carries on past failures, which are reported in an
+// *UnmountTreeError.
+func UnmountTree(root string, opts UnmountOpts) error {
+	infos := GetMountInfo()
+
+	mounts := make([]mountPoint, len(infos))
+	for i := range infos {
+		mounts[i] = infos[i].mountPoint()
+	}
+
+	opts.ByFsid = true
+
+	return unmountTree(root, unmountOrder(mounts, root), func(mp mountPoint) error {
+		return unmount(mp, opts)
+	})
 }
 
 // IsMounted returns true iff the filesystem is currently mounted.
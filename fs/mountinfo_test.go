@@ -1,6 +1,10 @@
+//go:build freebsd
+
 package fs
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -25,3 +29,41 @@ func TestRootMounted(t *testing.T) {
 		t.Errorf("...root fs isn't mounted?")
 	}
 }
+
+func TestMountTmpfs(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Mounting requires root")
+	}
+
+	dir, er := os.MkdirTemp("", "tmpfs")
+	if er != nil {
+		t.Fatal(er)
+	}
+	defer os.Remove(dir)
+
+	info, er := MountTmpfs(dir, TmpfsOptions{Size: 16 << 20, Mode: 0700, Uid: new(int)}, 0)
+	if er != nil {
+		t.Fatal(er)
+	}
+	defer info.Unmount()
+
+	if info.FsTypeName() != "tmpfs" {
+		t.Errorf("Mounted a %s, expected tmpfs", info.FsTypeName())
+	}
+
+	if info.Size() != 16<<20 {
+		t.Errorf("tmpfs is %d bytes, expected %d", info.Size(), 16<<20)
+	}
+
+	if er := os.WriteFile(filepath.Join(dir, "data"), make([]byte, 1<<20), 0600); er != nil {
+		t.Fatal(er)
+	}
+
+	if info, er = MountInfoForPath(dir); er != nil {
+		t.Fatal(er)
+	}
+
+	if used := info.UsedSize(); used < 1<<20 || used > info.Size() {
+		t.Errorf("tmpfs has %d of %d bytes used after writing 1MB", used, info.Size())
+	}
+}
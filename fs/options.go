@@ -0,0 +1,411 @@
+package fs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FsOptions are the options for one type of filesystem, for MountWith. Each
+// of the *Options types in this package is one; their zero values mount
+// with the filesystem's defaults.
+type FsOptions interface {
+	// FsType returns the filesystem's type, as `mount -t` takes it.
+	FsType() string
+
+	// mountArgs returns the filesystem's options for mounting from.
+	mountArgs(from string) ([]mountArg, error)
+}
+
+// TmpfsOptions are options for tmpfs(5), a filesystem kept in memory.
+type TmpfsOptions struct {
+	// Size is the most the filesystem may hold, in bytes; 0 allows it to
+	// use all of the available memory and swap.
+	Size uint64
+
+	// MaxFileSize is the largest a single file may grow, in bytes; 0 leaves
+	// files limited only by Size.
+	MaxFileSize uint64
+
+	// Inodes is the most files the filesystem may hold; 0 derives it from
+	// the size.
+	Inodes uint64
+
+	// Mode is the permissions of the filesystem's root; 0 leaves them as
+	// the mount point's.
+	Mode os.FileMode
+
+	// Uid and Gid own the filesystem's root; nil leaves them as the mount
+	// point's.
+	Uid *int
+	Gid *int
+
+	// NoNameCache disables the namecache for the filesystem, which saves
+	// memory when it holds many files that are rarely looked up twice.
+	NoNameCache bool
+}
+
+func (TmpfsOptions) FsType() string {
+	return "tmpfs"
+}
+
+func (opts TmpfsOptions) mountArgs(from string) ([]mountArg, error) {
+	args := []mountArg{}
+
+	if opts.Size != 0 {
+		args = append(args, stringArg("size", strconv.FormatUint(opts.Size, 10)))
+	}
+
+	if opts.MaxFileSize != 0 {
+		args = append(args, stringArg("maxfilesize", strconv.FormatUint(opts.MaxFileSize, 10)))
+	}
+
+	if opts.Inodes != 0 {
+		args = append(args, stringArg("inodes", strconv.FormatUint(opts.Inodes, 10)))
+	}
+
+	if opts.Mode != 0 {
+		args = append(args, stringArg("mode", fmt.Sprintf("%o", unixMode(opts.Mode))))
+	}
+
+	if opts.Uid != nil {
+		if *opts.Uid < 0 {
+			return nil, fmt.Errorf("Option `uid' cannot be negative")
+		}
+
+		args = append(args, stringArg("uid", strconv.Itoa(*opts.Uid)))
+	}
+
+	if opts.Gid != nil {
+		if *opts.Gid < 0 {
+			return nil, fmt.Errorf("Option `gid' cannot be negative")
+		}
+
+		args = append(args, stringArg("gid", strconv.Itoa(*opts.Gid)))
+	}
+
+	if opts.NoNameCache {
+		args = append(args, flagArg("nonc"))
+	}
+
+	return args, nil
+}
+
+// unixMode converts the permission bits of an os.FileMode to a chmod(2)
+// mode.
+func unixMode(mode os.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+
+	if mode&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+
+	if mode&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+
+	if mode&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+
+	return bits
+}
+
+// NullfsOptions are options for nullfs(5), which mounts a directory at a
+// second place in the tree. The mount hides whatever was at the mount
+// point, unlike unionfs.
+type NullfsOptions struct {
+	// NoCache stops nullfs from caching vnodes, so the lower filesystem's
+	// changes are seen immediately.
+	NoCache bool
+}
+
+func (NullfsOptions) FsType() string {
+	return "nullfs"
+}
+
+func (opts NullfsOptions) mountArgs(from string) ([]mountArg, error) {
+	args := []mountArg{}
+
+	if opts.NoCache {
+		args = append(args, flagArg("nocache"))
+	}
+
+	return args, nil
+}
+
+// UnionfsCopyMode says who owns the files unionfs copies up to the upper
+// layer.
+type UnionfsCopyMode string
+
+const (
+	// UnionfsCopyTraditional gives the copies the mounting user's
+	// ownership; it's the default.
+	UnionfsCopyTraditional UnionfsCopyMode = "traditional"
+
+	// UnionfsCopyTransparent keeps the original files' ownership.
+	UnionfsCopyTransparent UnionfsCopyMode = "transparent"
+
+	// UnionfsCopyMasquerade gives the copies to the mount's owner, as
+	// set with the udir, ufile, uid and gid options.
+	UnionfsCopyMasquerade UnionfsCopyMode = "masquerade"
+)
+
+// UnionfsWhiteout says when unionfs leaves a whiteout in the upper layer to
+// hide a removed file.
+type UnionfsWhiteout string
+
+const (
+	// UnionfsWhiteoutAlways leaves one for every removal; it's the
+	// default.
+	UnionfsWhiteoutAlways UnionfsWhiteout = "always"
+
+	// UnionfsWhiteoutWhenNeeded only leaves one when the lower layer has
+	// a file by the same name.
+	UnionfsWhiteoutWhenNeeded UnionfsWhiteout = "whenneeded"
+)
+
+// UnionfsOptions are options for unionfs(5), which stacks a directory over
+// the mount point, with changes going to the upper layer.
+type UnionfsOptions struct {
+	// Below puts the mounted directory under the mount point rather than
+	// over it, so changes go to the mount point's filesystem.
+	Below bool
+
+	CopyMode UnionfsCopyMode
+	Whiteout UnionfsWhiteout
+}
+
+func (UnionfsOptions) FsType() string {
+	return "unionfs"
+}
+
+func (opts UnionfsOptions) mountArgs(from string) ([]mountArg, error) {
+	args := []mountArg{}
+
+	if opts.Below {
+		args = append(args, flagArg("below"))
+	}
+
+	switch opts.CopyMode {
+	case "":
+
+	case UnionfsCopyTraditional, UnionfsCopyTransparent, UnionfsCopyMasquerade:
+		args = append(args, stringArg("copymode", string(opts.CopyMode)))
+
+	default:
+		return nil, fmt.Errorf("Invalid unionfs copymode `%s'", opts.CopyMode)
+	}
+
+	switch opts.Whiteout {
+	case "":
+
+	case UnionfsWhiteoutAlways, UnionfsWhiteoutWhenNeeded:
+		args = append(args, stringArg("whiteout", string(opts.Whiteout)))
+
+	default:
+		return nil, fmt.Errorf("Invalid unionfs whiteout `%s'", opts.Whiteout)
+	}
+
+	return args, nil
+}
+
+// UfsOptions are options for UFS, mounted from a disk device. The device
+// should hold a *trusted* filesystem.
+type UfsOptions struct {
+	// Acls enables POSIX.1e ACLs.
+	Acls bool
+
+	// Multilabel enables per-file MAC labels.
+	Multilabel bool
+}
+
+func (UfsOptions) FsType() string {
+	return "ufs"
+}
+
+func (opts UfsOptions) mountArgs(from string) ([]mountArg, error) {
+	args := []mountArg{}
+
+	if opts.Acls {
+		args = append(args, flagArg("acls"))
+	}
+
+	if opts.Multilabel {
+		args = append(args, flagArg("multilabel"))
+	}
+
+	return args, nil
+}
+
+// DevfsOptions are options for devfs(5).
+type DevfsOptions struct {
+	// Ruleset is the devfs.rules(5) ruleset to apply, hiding whatever
+	// devices it doesn't unhide; 0 shows every device.
+	Ruleset int
+}
+
+func (DevfsOptions) FsType() string {
+	return "devfs"
+}
+
+func (opts DevfsOptions) mountArgs(from string) ([]mountArg, error) {
+	if opts.Ruleset < 0 || opts.Ruleset > 65535 {
+		return nil, fmt.Errorf("Invalid devfs ruleset %d", opts.Ruleset)
+
+	} else if opts.Ruleset == 0 {
+		return nil, nil
+	}
+
+	return []mountArg{stringArg("ruleset", strconv.Itoa(opts.Ruleset))}, nil
+}
+
+// ProcfsOptions are options for procfs(5), which has none of its own.
+type ProcfsOptions struct{}
+
+func (ProcfsOptions) FsType() string {
+	return "procfs"
+}
+
+func (ProcfsOptions) mountArgs(from string) ([]mountArg, error) {
+	return nil, nil
+}
+
+// FdescfsOptions are options for fdescfs(5), which shows each process its
+// own file descriptors.
+type FdescfsOptions struct {
+	// LinRdlnk makes readlink(2) on a descriptor return the path it was
+	// opened with, as Linux programs expect.
+	LinRdlnk bool
+
+	// NoDup makes opening a descriptor's node open the file afresh,
+	// rather than duplicating the descriptor.
+	NoDup bool
+}
+
+func (FdescfsOptions) FsType() string {
+	return "fdescfs"
+}
+
+func (opts FdescfsOptions) mountArgs(from string) ([]mountArg, error) {
+	args := []mountArg{}
+
+	if opts.LinRdlnk {
+		args = append(args, flagArg("linrdlnk"))
+	}
+
+	if opts.NoDup {
+		args = append(args, flagArg("nodup"))
+	}
+
+	return args, nil
+}
+
+// nfsPort is where NFSv4 servers listen.
+const nfsPort = 2049
+
+// NfsOptions are options for an NFSv4 mount, from "host:/path". Only
+// version 4 is supported, since the older versions need the mount
+// protocol to get a file handle before the kernel can take over.
+type NfsOptions struct {
+	// Addr is the server's address. It can be left out if the host in
+	// the mount's source is an IP address; names aren't resolved.
+	Addr net.IP
+
+	// Port defaults to 2049.
+	Port int
+
+	// ReadSize and WriteSize are the sizes of reads and writes sent to
+	// the server; 0 negotiates them.
+	ReadSize  int
+	WriteSize int
+
+	// Soft gives up on requests after a number of retries, rather than
+	// retrying forever.
+	Soft bool
+}
+
+func (NfsOptions) FsType() string {
+	return "nfs"
+}
+
+func (opts NfsOptions) mountArgs(from string) ([]mountArg, error) {
+	idx := strings.LastIndex(from, ":/")
+	if idx <= 0 {
+		return nil, fmt.Errorf("NFS source `%s' must be host:/path", from)
+	}
+
+	host, path := strings.Trim(from[:idx], "[]"), from[idx+1:]
+
+	addr := opts.Addr
+	if addr == nil {
+		if addr = net.ParseIP(host); addr == nil {
+			return nil, fmt.Errorf("NFS server `%s' needs an address", host)
+		}
+	}
+
+	port := opts.Port
+	if port == 0 {
+		port = nfsPort
+	}
+
+	sa, er := encodeSockaddr(addr, port)
+	if er != nil {
+		return nil, er
+	}
+
+	args := []mountArg{
+		flagArg("nfsv4"),
+		rawArg("addr", sa),
+		stringArg("hostname", from),
+		stringArg("dirpath", path),
+	}
+
+	if opts.ReadSize != 0 {
+		args = append(args, stringArg("rsize", strconv.Itoa(opts.ReadSize)))
+	}
+
+	if opts.WriteSize != 0 {
+		args = append(args, stringArg("wsize", strconv.Itoa(opts.WriteSize)))
+	}
+
+	if opts.Soft {
+		args = append(args, flagArg("soft"))
+	}
+
+	return args, nil
+}
+
+// Address families, from <sys/socket.h>.
+const (
+	afInet  = 2
+	afInet6 = 28
+)
+
+// encodeSockaddr packs an address into a struct sockaddr_in or
+// sockaddr_in6.
+func encodeSockaddr(ip net.IP, port int) ([]byte, error) {
+	if port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("Invalid port %d", port)
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		sa := make([]byte, 16)
+		sa[0], sa[1] = byte(len(sa)), afInet
+		binary.BigEndian.PutUint16(sa[2:], uint16(port))
+		copy(sa[4:], ip4)
+		return sa, nil
+
+	} else if ip6 := ip.To16(); ip6 != nil {
+		sa := make([]byte, 28)
+		sa[0], sa[1] = byte(len(sa)), afInet6
+		binary.BigEndian.PutUint16(sa[2:], uint16(port))
+		copy(sa[8:], ip6)
+		return sa, nil
+	}
+
+	return nil, fmt.Errorf("Invalid address `%s'", ip)
+}
@@ -0,0 +1,143 @@
+package fs
+
+import (
+	"net"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestFsOptions(t *testing.T) {
+	for _, tc := range []struct {
+		opts     FsOptions
+		from     string
+		fstype   string
+		expected []mountArg
+	}{
+		{TmpfsOptions{}, "tmpfs", "tmpfs", []mountArg{}},
+		{
+			TmpfsOptions{Size: 1 << 30, Inodes: 10000, Mode: os.ModeSticky | 0777},
+			"tmpfs", "tmpfs",
+			[]mountArg{stringArg("size", "1073741824"), stringArg("inodes", "10000"), stringArg("mode", "1777")},
+		},
+		{TmpfsOptions{Mode: os.ModeSetgid | 0750}, "tmpfs", "tmpfs", []mountArg{stringArg("mode", "2750")}},
+		{
+			TmpfsOptions{MaxFileSize: 1 << 20, Uid: intPtr(0), Gid: intPtr(5), NoNameCache: true},
+			"tmpfs", "tmpfs",
+			[]mountArg{stringArg("maxfilesize", "1048576"), stringArg("uid", "0"), stringArg("gid", "5"), flagArg("nonc")},
+		},
+
+		{NullfsOptions{}, "/usr/src", "nullfs", []mountArg{}},
+		{NullfsOptions{NoCache: true}, "/usr/src", "nullfs", []mountArg{flagArg("nocache")}},
+
+		{UnionfsOptions{}, "/overlay", "unionfs", []mountArg{}},
+		{
+			UnionfsOptions{Below: true, CopyMode: UnionfsCopyTransparent, Whiteout: UnionfsWhiteoutWhenNeeded},
+			"/overlay", "unionfs",
+			[]mountArg{flagArg("below"), stringArg("copymode", "transparent"), stringArg("whiteout", "whenneeded")},
+		},
+
+		{UfsOptions{}, "/dev/ada0p2", "ufs", []mountArg{}},
+		{UfsOptions{Acls: true, Multilabel: true}, "/dev/ada0p2", "ufs", []mountArg{flagArg("acls"), flagArg("multilabel")}},
+
+		{DevfsOptions{}, "devfs", "devfs", nil},
+		{DevfsOptions{Ruleset: 4}, "devfs", "devfs", []mountArg{stringArg("ruleset", "4")}},
+
+		{ProcfsOptions{}, "procfs", "procfs", nil},
+
+		{FdescfsOptions{}, "fdescfs", "fdescfs", []mountArg{}},
+		{FdescfsOptions{LinRdlnk: true, NoDup: true}, "fdescfs", "fdescfs", []mountArg{flagArg("linrdlnk"), flagArg("nodup")}},
+
+		{
+			NfsOptions{},
+			"192.0.2.5:/export/home", "nfs",
+			[]mountArg{
+				flagArg("nfsv4"),
+				rawArg("addr", []byte{16, 2, 0x08, 0x01, 192, 0, 2, 5, 0, 0, 0, 0, 0, 0, 0, 0}),
+				stringArg("hostname", "192.0.2.5:/export/home"),
+				stringArg("dirpath", "/export/home"),
+			},
+		},
+		{
+			NfsOptions{Addr: net.ParseIP("192.0.2.5"), Port: 20490, ReadSize: 65536, WriteSize: 32768, Soft: true},
+			"files:/export", "nfs",
+			[]mountArg{
+				flagArg("nfsv4"),
+				rawArg("addr", []byte{16, 2, 0x50, 0x0a, 192, 0, 2, 5, 0, 0, 0, 0, 0, 0, 0, 0}),
+				stringArg("hostname", "files:/export"),
+				stringArg("dirpath", "/export"),
+				stringArg("rsize", "65536"),
+				stringArg("wsize", "32768"),
+				flagArg("soft"),
+			},
+		},
+	} {
+		if fstype := tc.opts.FsType(); fstype != tc.fstype {
+			t.Errorf("%#v is for %s, expected %s", tc.opts, fstype, tc.fstype)
+		}
+
+		args, er := tc.opts.mountArgs(tc.from)
+		if er != nil {
+			t.Errorf("%#v: %s", tc.opts, er)
+			continue
+		}
+
+		if !reflect.DeepEqual(args, tc.expected) {
+			t.Errorf("%#v gave %q, expected %q", tc.opts, args, tc.expected)
+		}
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestFsOptionsInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		opts FsOptions
+		from string
+	}{
+		{TmpfsOptions{Uid: intPtr(-1)}, "tmpfs"},
+		{TmpfsOptions{Gid: intPtr(-2)}, "tmpfs"},
+		{UnionfsOptions{CopyMode: "sideways"}, "/overlay"},
+		{UnionfsOptions{Whiteout: "never"}, "/overlay"},
+		{DevfsOptions{Ruleset: -1}, "devfs"},
+		{NfsOptions{}, "files:/export"},
+		{NfsOptions{}, "192.0.2.5"},
+		{NfsOptions{}, ":/export"},
+		{NfsOptions{Port: 70000}, "192.0.2.5:/export"},
+	} {
+		if _, er := tc.opts.mountArgs(tc.from); er == nil {
+			t.Errorf("Expected %#v from `%s' to be rejected", tc.opts, tc.from)
+		}
+	}
+}
+
+func TestEncodeSockaddr(t *testing.T) {
+	sa, er := encodeSockaddr(net.ParseIP("2001:db8::5"), 2049)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	expected := append([]byte{28, 28, 0x08, 0x01, 0, 0, 0, 0}, net.ParseIP("2001:db8::5")...)
+	expected = append(expected, 0, 0, 0, 0)
+
+	if !reflect.DeepEqual(sa, expected) {
+		t.Errorf("IPv6 sockaddr is %v", sa)
+	}
+
+	if _, er := encodeSockaddr(net.IP{1, 2, 3}, 2049); er == nil {
+		t.Error("Encoded an invalid address")
+	}
+}
+
+func TestNfsOptionsIPv6(t *testing.T) {
+	args, er := NfsOptions{}.mountArgs("[2001:db8::5]:/export")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if args[1].name != "addr" || len(args[1].value) != 28 || args[3].name != "dirpath" || string(args[3].value) != "/export\x00" {
+		t.Errorf("IPv6 NFS mount gave %q", args)
+	}
+}
@@ -0,0 +1,116 @@
+package fs
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// UnmountOpts are options for unmounting a filesystem.
+type UnmountOpts struct {
+	// Force unmounts the filesystem even if files on it are still open
+	// (MNT_FORCE).
+	Force bool
+
+	// ByFsid names the filesystem to the kernel by its fsid rather than its
+	// mount point (MNT_BYFSID), which reaches filesystems whose mount point
+	// has been mounted over.
+	ByFsid bool
+}
+
+// mountPoint is what unmounting needs to know about a mounted filesystem.
+type mountPoint struct {
+	path string
+	fsid [2]int32
+}
+
+// fsidPath is how unmount(2) takes an fsid with MNT_BYFSID.
+func fsidPath(fsid [2]int32) string {
+	return fmt.Sprintf("FSID:%d:%d", fsid[0], fsid[1])
+}
+
+// unmountTarget returns the path unmount(2) is passed for mp.
+func (mp mountPoint) unmountTarget(opts UnmountOpts) string {
+	if opts.ByFsid {
+		return fsidPath(mp.fsid)
+	}
+
+	return mp.path
+}
+
+func isBeneath(path, root string) bool {
+	if root == "/" {
+		return strings.HasPrefix(path, "/")
+	}
+
+	return path == root || strings.HasPrefix(path, root+"/")
+}
+
+func pathDepth(path string) int {
+	if path == "/" {
+		return 0
+	}
+
+	return strings.Count(path, "/")
+}
+
+// unmountOrder returns the mounts at or beneath root in the order they can
+// be unmounted: deepest mount points first, and filesystems stacked on the
+// same mount point from the top down. mounts must be in the order
+// getmntinfo(3) returns them, which is the order they were mounted in.
+func unmountOrder(mounts []mountPoint, root string) []mountPoint {
+	root = filepath.Clean(root)
+
+	type ordered struct {
+		mountPoint
+		depth int
+		idx   int
+	}
+
+	tree := []ordered{}
+	for i, mp := range mounts {
+		mp.path = filepath.Clean(mp.path)
+
+		if isBeneath(mp.path, root) {
+			tree = append(tree, ordered{mp, pathDepth(mp.path), i})
+		}
+	}
+
+	sort.Slice(tree, func(i, j int) bool {
+		if tree[i].depth != tree[j].depth {
+			return tree[i].depth > tree[j].depth
+		}
+
+		return tree[i].idx > tree[j].idx
+	})
+
+	order := make([]mountPoint, len(tree))
+	for i := range tree {
+		order[i] = tree[i].mountPoint
+	}
+
+	return order
+}
+
+// unmountTree unmounts each of order in turn. Failures don't stop it, so
+// as much of the tree as possible is torn down; they're all reported in an
+// *UnmountTreeError.
+func unmountTree(root string, order []mountPoint, unmount func(mountPoint) error) error {
+	treeEr := &UnmountTreeError{Root: root}
+
+	for _, mp := range order {
+		if er := unmount(mp); er != nil {
+			treeEr.Failed = append(treeEr.Failed, UnmountFailure{Target: mp.path, Err: er})
+
+		} else {
+			treeEr.Unmounted = append(treeEr.Unmounted, mp.path)
+		}
+	}
+
+	if len(treeEr.Failed) > 0 {
+		return treeEr
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package fs
+
+import (
+	"errors"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func mountPaths(mounts []mountPoint) []string {
+	paths := make([]string, len(mounts))
+	for i, mp := range mounts {
+		paths[i] = mp.path
+	}
+
+	return paths
+}
+
+func TestUnmountOrder(t *testing.T) {
+	/* In mount order, as getmntinfo returns them. */
+	mounts := []mountPoint{
+		{"/", [2]int32{1, 1}},
+		{"/dev", [2]int32{2, 2}},
+		{"/jails/web", [2]int32{3, 3}},
+		{"/jails/web/dev", [2]int32{4, 4}},
+		{"/jails/webmail", [2]int32{5, 5}},
+		{"/jails/web/usr/ports", [2]int32{6, 6}},
+		{"/jails/web/tmp", [2]int32{7, 7}},
+		{"/jails/web/", [2]int32{8, 8}},
+		{"/jails/web/tmp", [2]int32{9, 9}},
+	}
+
+	for _, tc := range []struct {
+		root     string
+		expected []string
+		fsids    []int32
+	}{
+		{
+			"/jails/web",
+			[]string{"/jails/web/usr/ports", "/jails/web/tmp", "/jails/web/tmp", "/jails/web/dev", "/jails/web", "/jails/web"},
+			[]int32{6, 9, 7, 4, 8, 3},
+		},
+		{"/jails/web/", []string{"/jails/web/usr/ports", "/jails/web/tmp", "/jails/web/tmp", "/jails/web/dev", "/jails/web", "/jails/web"}, nil},
+		{"/jails/web/tmp", []string{"/jails/web/tmp", "/jails/web/tmp"}, []int32{9, 7}},
+		{"/jails/webmail", []string{"/jails/webmail"}, nil},
+		{"/jails", []string{"/jails/web/usr/ports", "/jails/web/tmp", "/jails/web/tmp", "/jails/web/dev", "/jails/web", "/jails/webmail", "/jails/web"}, nil},
+		{"/usr", []string{}, nil},
+	} {
+		order := unmountOrder(mounts, tc.root)
+
+		if paths := mountPaths(order); !reflect.DeepEqual(paths, tc.expected) {
+			t.Errorf("Unmount order for %s is %v, expected %v", tc.root, paths, tc.expected)
+			continue
+		}
+
+		for i, fsid := range tc.fsids {
+			if order[i].fsid[0] != fsid {
+				t.Errorf("Unmount %d under %s is fsid %v, expected %d", i, tc.root, order[i].fsid, fsid)
+			}
+		}
+	}
+
+	if order := unmountOrder(mounts, "/"); len(order) != len(mounts) || order[len(order)-1].path != "/" {
+		t.Errorf("Unmounting / should unmount everything, / last: %v", mountPaths(order))
+	}
+}
+
+func TestUnmountTree(t *testing.T) {
+	order := unmountOrder([]mountPoint{
+		{"/jail", [2]int32{1, 0}},
+		{"/jail/dev", [2]int32{2, 0}},
+		{"/jail/tmp", [2]int32{3, 0}},
+	}, "/jail")
+
+	tried := []string{}
+	er := unmountTree("/jail", order, func(mp mountPoint) error {
+		tried = append(tried, mp.path)
+
+		if mp.path != "/jail/tmp" {
+			return syscall.EBUSY
+		}
+
+		return nil
+	})
+
+	if !reflect.DeepEqual(tried, []string{"/jail/tmp", "/jail/dev", "/jail"}) {
+		t.Errorf("Unmounting stopped early or out of order: %v", tried)
+	}
+
+	var treeEr *UnmountTreeError
+	if !errors.As(er, &treeEr) {
+		t.Fatalf("Expected an UnmountTreeError, got %v", er)
+	}
+
+	if !reflect.DeepEqual(treeEr.Unmounted, []string{"/jail/tmp"}) || len(treeEr.Failed) != 2 {
+		t.Errorf("Unexpected UnmountTreeError %+v", treeEr)
+	}
+
+	if !errors.Is(er, syscall.EBUSY) {
+		t.Error("UnmountTreeError doesn't match its failures")
+	}
+
+	expected := "unmount /jail: 2 of 3 mounts failed: /jail/dev: " + syscall.EBUSY.Error() + "; /jail: " + syscall.EBUSY.Error()
+	if er.Error() != expected {
+		t.Errorf("Unexpected message `%s'", er)
+	}
+
+	if er := unmountTree("/jail", order, func(mountPoint) error { return nil }); er != nil {
+		t.Errorf("Unexpected error when everything unmounted: %v", er)
+	}
+}
+
+func TestUnmountTarget(t *testing.T) {
+	mp := mountPoint{"/jail/tmp", [2]int32{-1258227436, 135}}
+
+	if target := mp.unmountTarget(UnmountOpts{}); target != "/jail/tmp" {
+		t.Errorf("Unexpected target %s", target)
+	}
+
+	if target := mp.unmountTarget(UnmountOpts{Force: true, ByFsid: true}); target != "FSID:-1258227436:135" {
+		t.Errorf("Unexpected fsid target %s", target)
+	}
+}
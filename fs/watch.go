@@ -0,0 +1,195 @@
+package fs
+
+import (
+	"context"
+	"time"
+)
+
+const defaultWatchInterval = time.Second
+
+// MountState is what the mount watcher knows about a mounted filesystem.
+// The events WatchMounts sends carry a *MountInfo.
+type MountState interface {
+	FilesystemId() []int32
+	FsTypeName() string
+	MntFromName() string
+	MntToName() string
+	Flags() uint64
+}
+
+func mountFsid(ms MountState) [2]int32 {
+	fsid := ms.FilesystemId()
+	return [2]int32{fsid[0], fsid[1]}
+}
+
+// MountEventType is the kind of change a MountEvent reports.
+type MountEventType int
+
+const (
+	// Mounted is sent the first time a filesystem is seen, including for
+	// filesystems that are already mounted when WatchMounts is called.
+	Mounted MountEventType = iota
+
+	// Remounted is sent when a filesystem's flags change, as happens when
+	// it's remounted with MntUpdate (e.g., read-only).
+	Remounted
+
+	// Unmounted is sent once a filesystem is gone.
+	Unmounted
+
+	// NotificationsLost is sent if the kernel's notices of mounts and
+	// unmounts stop arriving; changes are still found, but only as often
+	// as the mount table is polled. It has no Fsid or Mount, only Err.
+	NotificationsLost
+)
+
+func (ty MountEventType) String() string {
+	switch ty {
+	case Mounted:
+		return "mounted"
+	case Remounted:
+		return "remounted"
+	case Unmounted:
+		return "unmounted"
+	case NotificationsLost:
+		return "notifications lost"
+	}
+
+	return "unknown"
+}
+
+// MountEvent describes a change to a single mounted filesystem, which is
+// identified by its fsid.
+type MountEvent struct {
+	Type MountEventType
+	Fsid [2]int32
+
+	// Mount is the state of the filesystem as of the event. For Unmounted,
+	// it's the last state seen before the filesystem went away.
+	Mount MountState
+
+	// Err is why notifications were lost, for NotificationsLost.
+	Err error
+}
+
+// diffMountSnapshots returns the events that take prev to next. Both are in
+// mount order, as getmntinfo(3) returns them. Unmounts come first, most
+// recently mounted first, followed by mounts and remounts in mount order.
+func diffMountSnapshots(prev, next []MountState) []MountEvent {
+	prevByFsid := map[[2]int32]MountState{}
+	for _, ms := range prev {
+		prevByFsid[mountFsid(ms)] = ms
+	}
+
+	nextByFsid := map[[2]int32]MountState{}
+	for _, ms := range next {
+		nextByFsid[mountFsid(ms)] = ms
+	}
+
+	events := []MountEvent{}
+
+	for i := len(prev) - 1; i >= 0; i-- {
+		fsid := mountFsid(prev[i])
+
+		if _, ok := nextByFsid[fsid]; !ok {
+			events = append(events, MountEvent{Type: Unmounted, Fsid: fsid, Mount: prev[i]})
+		}
+	}
+
+	for _, cur := range next {
+		fsid := mountFsid(cur)
+
+		if old, ok := prevByFsid[fsid]; !ok {
+			events = append(events, MountEvent{Type: Mounted, Fsid: fsid, Mount: cur})
+
+		} else if old.Flags() != cur.Flags() {
+			events = append(events, MountEvent{Type: Remounted, Fsid: fsid, Mount: cur})
+		}
+	}
+
+	return events
+}
+
+// mountWatcher polls for snapshots of the mount table and turns them into
+// events. wake, if set, triggers a poll ahead of the interval (e.g., when
+// the kernel reports a mount or unmount), and failed reports whatever stops
+// wake from being triggered.
+type mountWatcher struct {
+	snapshot func() ([]MountState, error)
+	wake     <-chan struct{}
+	failed   <-chan error
+	interval time.Duration
+}
+
+// run sends events to events until ctx is done, then closes it. A snapshot
+// that fails is simply retried at the next poll.
+func (w *mountWatcher) run(ctx context.Context, prev []MountState, events chan<- MountEvent) {
+	defer close(events)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	failed := w.failed
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		case er := <-failed:
+			/* Carry on polling; there's nothing more to hear. */
+			failed = nil
+
+			select {
+			case events <- MountEvent{Type: NotificationsLost, Err: er}:
+			case <-ctx.Done():
+				return
+			}
+
+			continue
+		}
+
+		next, er := w.snapshot()
+		if er != nil {
+			continue
+		}
+
+		for _, event := range diffMountSnapshots(prev, next) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		prev = next
+	}
+}
+
+// start takes the initial snapshot (so that a failure can be reported up
+// front) and runs the watcher in the background.
+func (w *mountWatcher) start(ctx context.Context) (<-chan MountEvent, error) {
+	first, er := w.snapshot()
+	if er != nil {
+		return nil, er
+	}
+
+	events := make(chan MountEvent)
+
+	go func() {
+		/* Report what's already mounted, then carry on from it. */
+		for _, event := range diffMountSnapshots(nil, first) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				close(events)
+				return
+			}
+		}
+
+		w.run(ctx, first, events)
+	}()
+
+	return events, nil
+}
@@ -0,0 +1,261 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeMount struct {
+	fsid   [2]int32
+	fstype string
+	from   string
+	to     string
+	flags  uint64
+}
+
+func (fm *fakeMount) FilesystemId() []int32 { return fm.fsid[:] }
+func (fm *fakeMount) FsTypeName() string    { return fm.fstype }
+func (fm *fakeMount) MntFromName() string   { return fm.from }
+func (fm *fakeMount) MntToName() string     { return fm.to }
+func (fm *fakeMount) Flags() uint64         { return fm.flags }
+
+func mountSnapshot(mounts ...*fakeMount) []MountState {
+	snapshot := make([]MountState, len(mounts))
+	for i := range mounts {
+		snapshot[i] = mounts[i]
+	}
+
+	return snapshot
+}
+
+func mountEventSummary(events []MountEvent) []string {
+	summary := []string{}
+
+	for _, event := range events {
+		summary = append(summary, event.Type.String()+":"+event.Mount.MntToName())
+	}
+
+	return summary
+}
+
+func checkMountEvents(t *testing.T, events []MountEvent, expected ...string) {
+	t.Helper()
+
+	summary := mountEventSummary(events)
+
+	if len(summary) != len(expected) {
+		t.Errorf("Expected events %v, got %v", expected, summary)
+		return
+	}
+
+	for i := range summary {
+		if summary[i] != expected[i] {
+			t.Errorf("Expected events %v, got %v", expected, summary)
+			return
+		}
+	}
+}
+
+func TestDiffMountSnapshots(t *testing.T) {
+	root := &fakeMount{fsid: [2]int32{1, 222}, fstype: "ufs", from: "/dev/ada0p2", to: "/"}
+	dev := &fakeMount{fsid: [2]int32{2, 113}, fstype: "devfs", from: "devfs", to: "/dev"}
+	tmp := &fakeMount{fsid: [2]int32{3, 135}, fstype: "tmpfs", from: "tmpfs", to: "/tmp"}
+	jailDev := &fakeMount{fsid: [2]int32{4, 113}, fstype: "devfs", from: "devfs", to: "/jails/www/dev"}
+
+	checkMountEvents(t, diffMountSnapshots(nil, mountSnapshot(root, dev, tmp)), "mounted:/", "mounted:/dev", "mounted:/tmp")
+	checkMountEvents(t, diffMountSnapshots(mountSnapshot(root, dev), mountSnapshot(root, dev)))
+
+	/* The same filesystem re-read from the kernel isn't a change. */
+	devAgain := *dev
+	checkMountEvents(t, diffMountSnapshots(mountSnapshot(root, dev), mountSnapshot(root, &devAgain)))
+
+	readOnly := *root
+	readOnly.flags = 0x1
+	checkMountEvents(t, diffMountSnapshots(mountSnapshot(root, dev), mountSnapshot(&readOnly, dev)), "remounted:/")
+
+	events := diffMountSnapshots(mountSnapshot(root, dev, tmp, jailDev), mountSnapshot(root, dev))
+	checkMountEvents(t, events, "unmounted:/jails/www/dev", "unmounted:/tmp")
+
+	if events[0].Fsid != jailDev.fsid || events[0].Mount != jailDev {
+		t.Errorf("Unmounted event should carry the last state seen: %+v", events[0])
+	}
+
+	checkMountEvents(t,
+		diffMountSnapshots(mountSnapshot(root, tmp), mountSnapshot(&readOnly, dev, jailDev)),
+		"unmounted:/tmp", "remounted:/", "mounted:/dev", "mounted:/jails/www/dev")
+
+	/* Filesystems stacked on one mount point are told apart by fsid. */
+	overTmp := &fakeMount{fsid: [2]int32{5, 135}, fstype: "tmpfs", from: "tmpfs", to: "/tmp"}
+	checkMountEvents(t, diffMountSnapshots(mountSnapshot(root, tmp), mountSnapshot(root, tmp, overTmp)), "mounted:/tmp")
+
+	events = diffMountSnapshots(mountSnapshot(root, tmp, overTmp), mountSnapshot(root, overTmp))
+	if len(events) != 1 || events[0].Type != Unmounted || events[0].Fsid != tmp.fsid {
+		t.Errorf("Expected only the lower /tmp to be unmounted: %v", mountEventSummary(events))
+	}
+}
+
+func TestMountWatcher(t *testing.T) {
+	root := &fakeMount{fsid: [2]int32{1, 222}, to: "/"}
+	tmp := &fakeMount{fsid: [2]int32{3, 135}, to: "/tmp"}
+	readOnly := *tmp
+	readOnly.flags = 0x1
+
+	script := [][]MountState{
+		mountSnapshot(root),
+		mountSnapshot(root, tmp),
+		nil,
+		mountSnapshot(root, &readOnly),
+		mountSnapshot(root),
+	}
+
+	w := &mountWatcher{
+		snapshot: func() ([]MountState, error) {
+			if len(script) == 0 {
+				return nil, errors.New("out of script")
+			}
+
+			next := script[0]
+			script = script[1:]
+
+			if next == nil {
+				return nil, errors.New("scripted failure")
+			}
+
+			return next, nil
+		},
+		interval: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, er := w.start(ctx)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	seen := []MountEvent{}
+	for len(seen) < 4 {
+		select {
+		case event := <-events:
+			seen = append(seen, event)
+
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out after events %v", mountEventSummary(seen))
+		}
+	}
+
+	checkMountEvents(t, seen, "mounted:/", "mounted:/tmp", "remounted:/tmp", "unmounted:/tmp")
+
+	cancel()
+
+	for range events {
+	}
+}
+
+func TestMountWatcherWake(t *testing.T) {
+	polls := 0
+	wake := make(chan struct{}, 1)
+
+	w := &mountWatcher{
+		snapshot: func() ([]MountState, error) {
+			polls++
+			return nil, nil
+		},
+		wake:     wake,
+		interval: time.Hour,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, er := w.start(ctx)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	wake <- struct{}{}
+	wake <- struct{}{}
+	cancel()
+
+	for range events {
+	}
+
+	if polls < 2 {
+		t.Errorf("Waking the watcher should trigger a poll, got %d polls", polls)
+	}
+}
+
+func TestMountWatcherFailure(t *testing.T) {
+	w := &mountWatcher{
+		snapshot: func() ([]MountState, error) { return nil, errors.New("no mount table") },
+		interval: time.Millisecond,
+	}
+
+	if _, er := w.start(context.Background()); er == nil {
+		t.Error("A failed first snapshot should be reported")
+	}
+}
+
+func TestMountWatcherNotificationsLost(t *testing.T) {
+	root := &fakeMount{fsid: [2]int32{1, 222}, to: "/"}
+	tmp := &fakeMount{fsid: [2]int32{3, 135}, to: "/tmp"}
+
+	failed := make(chan error, 1)
+	lost := errors.New("kevent failed")
+
+	script := [][]MountState{mountSnapshot(root), mountSnapshot(root, tmp)}
+
+	w := &mountWatcher{
+		snapshot: func() ([]MountState, error) {
+			if len(script) == 0 {
+				return mountSnapshot(root, tmp), nil
+			}
+
+			next := script[0]
+			script = script[1:]
+
+			return next, nil
+		},
+		failed:   failed,
+		interval: 10 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, er := w.start(ctx)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if event := <-events; event.Type != Mounted {
+		t.Fatalf("Expected / to be mounted first, got %v", event.Type)
+	}
+
+	failed <- lost
+
+	seen := []MountEvent{}
+	for len(seen) < 2 {
+		select {
+		case event := <-events:
+			seen = append(seen, event)
+
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out after %d events", len(seen))
+		}
+	}
+
+	/* Which comes first depends on whether the ticker beat the failure. */
+	if seen[1].Type == NotificationsLost {
+		seen[0], seen[1] = seen[1], seen[0]
+	}
+
+	if seen[0].Type != NotificationsLost || seen[0].Err != lost || seen[0].Mount != nil {
+		t.Errorf("Unexpected event %+v", seen[0])
+	}
+
+	if seen[1].Type != Mounted || seen[1].Mount != tmp {
+		t.Errorf("Watcher should carry on polling after notifications are lost: %+v", seen[1])
+	}
+}
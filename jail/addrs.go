@@ -0,0 +1,72 @@
+package jail
+
+import (
+	"fmt"
+	"net"
+)
+
+// jailIPStride returns the size of a single address in the raw value of an
+// address parameter: a struct in_addr for ip4.addr, in6_addr for ip6.addr.
+func jailIPStride(name string) (int, error) {
+	if name == "ip4.addr" {
+		return net.IPv4len, nil
+
+	} else if name == "ip6.addr" {
+		return net.IPv6len, nil
+	}
+
+	return 0, fmt.Errorf("Parameter `%s' cannot be coerced to net.IP's", name)
+}
+
+// encodeJailIPs packs addrs into the raw value for the named address
+// parameter. Addresses of the wrong family are rejected rather than silently
+// mangled.
+func encodeJailIPs(name string, addrs []net.IP) ([]byte, error) {
+	stride, er := jailIPStride(name)
+	if er != nil {
+		return nil, er
+	}
+
+	buf := make([]byte, 0, len(addrs)*stride)
+
+	for _, addr := range addrs {
+		raw := addr.To16()
+
+		if stride == net.IPv4len {
+			raw = addr.To4()
+
+		} else if addr.To4() != nil {
+			raw = nil
+		}
+
+		if raw == nil {
+			return nil, fmt.Errorf("Parameter `%s' cannot hold address %s", name, addr)
+		}
+
+		buf = append(buf, raw...)
+	}
+
+	return buf, nil
+}
+
+// decodeJailIPs unpacks the raw value of the named address parameter.
+func decodeJailIPs(name string, raw []byte) ([]net.IP, error) {
+	stride, er := jailIPStride(name)
+	if er != nil {
+		return nil, er
+	}
+
+	if len(raw)%stride != 0 {
+		return nil, fmt.Errorf("Parameter `%s' has %d bytes, not a multiple of %d", name, len(raw), stride)
+	}
+
+	addrs := make([]net.IP, 0, len(raw)/stride)
+
+	for i := 0; i < len(raw); i += stride {
+		addr := make(net.IP, stride)
+		copy(addr, raw[i:i+stride])
+		addrs = append(addrs, addr)
+	}
+
+	return addrs, nil
+}
@@ -0,0 +1,93 @@
+package jail
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestDecodeJailIPs(t *testing.T) {
+	addrs, er := decodeJailIPs("ip4.addr", []byte{10, 0, 0, 1, 192, 168, 1, 254})
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if len(addrs) != 2 || !addrs[0].Equal(net.ParseIP("10.0.0.1")) || !addrs[1].Equal(net.ParseIP("192.168.1.254")) {
+		t.Errorf("Unexpected ip4.addr %v", addrs)
+	}
+
+	raw := []byte{0xfd, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x20}
+	addrs, er = decodeJailIPs("ip6.addr", raw)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if len(addrs) != 1 || !addrs[0].Equal(net.ParseIP("fd00::20")) {
+		t.Errorf("Unexpected ip6.addr %v", addrs)
+	}
+
+	/* The returned addresses mustn't alias the (C-owned) input. */
+	raw[15] = 0x21
+	if !addrs[0].Equal(net.ParseIP("fd00::20")) {
+		t.Errorf("Decoded address aliases its input")
+	}
+
+	if addrs, er := decodeJailIPs("ip6.addr", nil); er != nil || len(addrs) != 0 {
+		t.Errorf("Empty ip6.addr should decode to no addresses, got %v, %v", addrs, er)
+	}
+
+	if _, er := decodeJailIPs("ip4.addr", []byte{10, 0, 0}); er == nil {
+		t.Errorf("Truncated ip4.addr should be an error")
+	}
+
+	if _, er := decodeJailIPs("ip6.addr", make([]byte, 20)); er == nil {
+		t.Errorf("Truncated ip6.addr should be an error")
+	}
+
+	if _, er := decodeJailIPs("host.hostname", []byte{10, 0, 0, 1}); er == nil {
+		t.Errorf("Only address parameters should decode")
+	}
+}
+
+func TestEncodeJailIPs(t *testing.T) {
+	/* net.IPv4 returns the 16-byte form, which must still pack to 4. */
+	raw, er := encodeJailIPs("ip4.addr", []net.IP{net.IPv4(10, 0, 0, 1), net.ParseIP("10.0.0.2").To4()})
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if !bytes.Equal(raw, []byte{10, 0, 0, 1, 10, 0, 0, 2}) {
+		t.Errorf("Unexpected ip4.addr encoding %v", raw)
+	}
+
+	raw, er = encodeJailIPs("ip6.addr", []net.IP{net.ParseIP("fd00::20")})
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if !bytes.Equal(raw, []byte{0xfd, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x20}) {
+		t.Errorf("Unexpected ip6.addr encoding %v", raw)
+	}
+
+	if _, er := encodeJailIPs("ip4.addr", []net.IP{net.ParseIP("fd00::20")}); er == nil {
+		t.Errorf("IPv6 addresses shouldn't fit in ip4.addr")
+	}
+
+	if _, er := encodeJailIPs("ip6.addr", []net.IP{net.IPv4(10, 0, 0, 1)}); er == nil {
+		t.Errorf("IPv4 addresses shouldn't fit in ip6.addr")
+	}
+
+	/* And back again. */
+	addrs := []net.IP{net.ParseIP("fd00::1"), net.ParseIP("2001:db8::5")}
+	raw, _ = encodeJailIPs("ip6.addr", addrs)
+	decoded, er := decodeJailIPs("ip6.addr", raw)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	for i := range addrs {
+		if !decoded[i].Equal(addrs[i]) {
+			t.Errorf("Address %d changed from %s to %s", i, addrs[i], decoded[i])
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package jail
+
+/*
+#include <stdlib.h>
+#include <string.h>
+*/
+import "C"
+import (
+	"unsafe"
+)
+
+// paramArena owns the C memory that parameter values are handed to libjail
+// in. Values are copied in when they're bound, so libjail never sees a
+// pointer into the Go heap (which the collector is free to move or reclaim
+// before the call happens), and everything is freed at once when the
+// jailParamList is released.
+type paramArena struct {
+	blocks []unsafe.Pointer
+}
+
+// copyIn copies buf into C memory owned by the arena. An empty buf is
+// passed as a NULL pointer, which is how libjail expects empty arrays.
+func (arena *paramArena) copyIn(buf []byte) unsafe.Pointer {
+	if len(buf) == 0 {
+		return nil
+	}
+
+	ptr := C.malloc(C.size_t(len(buf)))
+	if ptr == nil {
+		panic("jail: out of memory for parameter values")
+	}
+
+	C.memcpy(ptr, unsafe.Pointer(&buf[0]), C.size_t(len(buf)))
+
+	arena.blocks = append(arena.blocks, ptr)
+	return ptr
+}
+
+func (arena *paramArena) release() {
+	for _, ptr := range arena.blocks {
+		C.free(ptr)
+	}
+
+	arena.blocks = nil
+}
+
+// arenaBytes copies size bytes of C memory at ptr back into Go.
+func arenaBytes(ptr unsafe.Pointer, size int) []byte {
+	if ptr == nil || size == 0 {
+		return []byte{}
+	}
+
+	return C.GoBytes(ptr, C.int(size))
+}
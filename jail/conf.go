@@ -0,0 +1,695 @@
+package jail
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Config is a parsed jail.conf(5) file. Besides the parameters themselves,
+// Config retains all of the comments and whitespace of the original text so
+// that it can be edited in place -- only the statements that are changed
+// through Set/Unset/AddJail/RemoveJail are reformatted when it is written
+// back out with WriteTo.
+//
+// Config itself doesn't interpret anything; call Jail or Jails to get the
+// resolved definitions.
+type Config struct {
+	items []*confItem
+	tail  string
+}
+
+type confItem struct {
+	lead  string
+	trail string
+	param *confParam
+	block *confBlock
+}
+
+type confParam struct {
+	raw    string
+	name   string
+	append bool
+	values []confValue
+}
+
+type confBlock struct {
+	header    string
+	name      string
+	items     []*confItem
+	closeLead string
+}
+
+// JailDef is a single jail definition resolved from a Config. Global
+// parameters are applied first, then any wildcard blocks that match the
+// jail's name (in the order they appear), then the jail's own block. All
+// variables have been expanded.
+type JailDef struct {
+	Name string
+
+	// Params holds the parameters this package knows about, typed according
+	// to the jail parameter table: int, string, bool or []net.IP.
+	Params map[string]interface{}
+
+	// Exec holds the exec.* parameters (exec.start, exec.stop, etc), which
+	// jail(8) runs itself rather than passing to the kernel.
+	Exec map[string][]string
+
+	// Extra holds any remaining parameters (mount.*, interface, etc) that
+	// aren't in the jail parameter table. They are expanded but left untyped.
+	Extra map[string][]string
+}
+
+// ParseConfig parses a jail.conf(5) formatted document.
+func ParseConfig(r io.Reader) (*Config, error) {
+	src, er := io.ReadAll(r)
+	if er != nil {
+		return nil, er
+	}
+
+	return parseConfig(string(src))
+}
+
+// ParseConfigFile parses the jail.conf(5) file at path (normally
+// /etc/jail.conf).
+func ParseConfigFile(path string) (*Config, error) {
+	f, er := os.Open(path)
+	if er != nil {
+		return nil, er
+	}
+	defer f.Close()
+
+	return ParseConfig(f)
+}
+
+// WriteTo writes the Config back out in jail.conf(5) format. An unmodified
+// Config reproduces its input byte-for-byte.
+func (c *Config) WriteTo(w io.Writer) (int64, error) {
+	buf := bytes.Buffer{}
+
+	for _, item := range c.items {
+		item.write(&buf)
+	}
+
+	buf.WriteString(c.tail)
+
+	return buf.WriteTo(w)
+}
+
+// String returns the Config in jail.conf(5) format.
+func (c *Config) String() string {
+	buf := bytes.Buffer{}
+	c.WriteTo(&buf)
+	return buf.String()
+}
+
+func (item *confItem) write(buf *bytes.Buffer) {
+	buf.WriteString(item.lead)
+
+	if item.param != nil {
+		buf.WriteString(item.param.raw)
+
+	} else {
+		buf.WriteString(item.block.header)
+
+		for _, child := range item.block.items {
+			child.write(buf)
+		}
+
+		buf.WriteString(item.block.closeLead)
+		buf.WriteString("}")
+	}
+
+	buf.WriteString(item.trail)
+}
+
+// JailNames returns the names of all jails defined in the Config, in the
+// order they first appear. Wildcard blocks are not included.
+func (c *Config) JailNames() []string {
+	names := []string{}
+	seen := map[string]bool{}
+
+	for _, item := range c.items {
+		if item.block == nil || isConfWildcard(item.block.name) || seen[item.block.name] {
+			continue
+		}
+
+		seen[item.block.name] = true
+		names = append(names, item.block.name)
+	}
+
+	return names
+}
+
+// Jails resolves every jail defined in the Config.
+func (c *Config) Jails() ([]*JailDef, error) {
+	defs := []*JailDef{}
+
+	for _, name := range c.JailNames() {
+		def, er := c.Jail(name)
+		if er != nil {
+			return nil, er
+		}
+
+		defs = append(defs, def)
+	}
+
+	return defs, nil
+}
+
+// Jail resolves the definition for the named jail.
+func (c *Config) Jail(name string) (*JailDef, error) {
+	if isConfWildcard(name) || c.findBlock(name) == nil {
+		return nil, fmt.Errorf("Jail `%s' not defined", name)
+	}
+
+	res := &confResolver{
+		vars:   map[string][]confValue{},
+		params: map[string][]confValue{},
+		active: map[string]bool{},
+	}
+
+	/* The name is taken literally, even if it looks like it has variables. */
+	res.params["name"] = []confValue{{raw: name, segs: []confSegment{{text: name}}}}
+
+	for _, item := range c.items {
+		if item.param != nil {
+			res.apply(item.param)
+		}
+	}
+
+	for _, item := range c.items {
+		if item.block != nil && isConfWildcard(item.block.name) {
+			if ok, _ := path.Match(item.block.name, name); ok {
+				res.applyAll(item.block.items)
+			}
+		}
+	}
+
+	for _, item := range c.items {
+		if item.block != nil && item.block.name == name {
+			res.applyAll(item.block.items)
+		}
+	}
+
+	return res.resolve(name)
+}
+
+func isConfWildcard(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+func (c *Config) findBlock(name string) *confBlock {
+	for _, item := range c.items {
+		if item.block != nil && item.block.name == name {
+			return item.block
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) scope(jail string) (*[]*confItem, error) {
+	if jail == "" {
+		return &c.items, nil
+	}
+
+	block := c.findBlock(jail)
+	if block == nil {
+		return nil, fmt.Errorf("Jail `%s' not defined", jail)
+	}
+
+	return &block.items, nil
+}
+
+// Set assigns values to the parameter name inside the block for jail, or to
+// the global parameters if jail is empty. The first existing assignment is
+// rewritten in place and any later assignments or appends of the same
+// parameter in that block are dropped; if there are none, a new statement
+// is added at the end of the block. A boolean parameter may be set by
+// passing no values.
+//
+// Values are written as given, so "$name" and the like will be expanded when
+// the Config is resolved.
+func (c *Config) Set(jail, name string, values ...string) error {
+	items, er := c.scope(jail)
+	if er != nil {
+		return er
+	}
+
+	param, er := newConfParam(name, false, values)
+	if er != nil {
+		return er
+	}
+
+	kept := []*confItem{}
+	replaced := false
+
+	for _, item := range *items {
+		if item.param == nil || item.param.name != name {
+			kept = append(kept, item)
+
+		} else if !replaced && !item.param.append {
+			item.param = param
+			kept = append(kept, item)
+			replaced = true
+		}
+	}
+
+	*items = kept
+
+	if !replaced {
+		c.insertParam(jail, items, param)
+	}
+
+	return nil
+}
+
+// Append adds a `name += values;' statement to the end of the block for jail
+// (or the globals, if jail is empty).
+func (c *Config) Append(jail, name string, values ...string) error {
+	items, er := c.scope(jail)
+	if er != nil {
+		return er
+	}
+
+	if len(values) == 0 {
+		return fmt.Errorf("Nothing to append to parameter `%s'", name)
+	}
+
+	param, er := newConfParam(name, true, values)
+	if er != nil {
+		return er
+	}
+
+	c.insertParam(jail, items, param)
+	return nil
+}
+
+// Unset removes every statement for the parameter name from the block for
+// jail (or the globals, if jail is empty). It returns false if there was
+// nothing to remove.
+func (c *Config) Unset(jail, name string) (bool, error) {
+	items, er := c.scope(jail)
+	if er != nil {
+		return false, er
+	}
+
+	kept := []*confItem{}
+
+	for _, item := range *items {
+		if item.param == nil || item.param.name != name {
+			kept = append(kept, item)
+		}
+	}
+
+	removed := len(kept) != len(*items)
+	*items = kept
+
+	return removed, nil
+}
+
+// AddJail adds a new, empty block for the named jail to the end of the
+// Config. Parameters can then be added to it with Set.
+func (c *Config) AddJail(name string) error {
+	if name == "" {
+		return fmt.Errorf("Jail name cannot be empty")
+	}
+
+	if c.findBlock(name) != nil {
+		return fmt.Errorf("Jail `%s' already defined", name)
+	}
+
+	item := &confItem{
+		block: &confBlock{
+			header:    formatConfValue(name) + " {",
+			name:      name,
+			closeLead: "\n",
+		},
+	}
+
+	if len(c.items) > 0 {
+		item.lead = "\n\n"
+	}
+
+	if c.tail == "" {
+		c.tail = "\n"
+	}
+
+	c.items = append(c.items, item)
+	return nil
+}
+
+// RemoveJail removes every block for the named jail, returning false if
+// there were none.
+func (c *Config) RemoveJail(name string) bool {
+	kept := []*confItem{}
+
+	for _, item := range c.items {
+		if item.block == nil || item.block.name != name {
+			kept = append(kept, item)
+		}
+	}
+
+	removed := len(kept) != len(c.items)
+	c.items = kept
+
+	return removed
+}
+
+func (c *Config) insertParam(jail string, items *[]*confItem, param *confParam) {
+	item := &confItem{param: param}
+
+	if jail != "" {
+		/* Match the indentation of the last statement in the block. */
+		indent := "\t"
+
+		if n := len(*items); n > 0 {
+			lead := (*items)[n-1].lead
+			indent = lead[strings.LastIndex(lead, "\n")+1:]
+		}
+
+		item.lead = "\n" + indent
+		*items = append(*items, item)
+		return
+	}
+
+	/* Globals go after the last global statement, ahead of any jails. */
+	idx := 0
+	for i, existing := range *items {
+		if existing.param != nil {
+			idx = i + 1
+		}
+	}
+
+	if idx > 0 {
+		item.lead = "\n"
+
+	} else if len(*items) > 0 {
+		next := (*items)[0]
+		if !strings.HasPrefix(next.lead, "\n") {
+			next.lead = "\n" + next.lead
+		}
+
+	} else if c.tail == "" {
+		c.tail = "\n"
+	}
+
+	*items = append(*items, nil)
+	copy((*items)[idx+1:], (*items)[idx:])
+	(*items)[idx] = item
+}
+
+func newConfParam(name string, appending bool, values []string) (*confParam, error) {
+	if name == "" || formatConfValue(name) != name {
+		return nil, fmt.Errorf("Invalid parameter name `%s'", name)
+	}
+
+	param := &confParam{name: name, append: appending}
+	raw := name
+
+	if len(values) > 0 {
+		if appending {
+			raw += " += "
+
+		} else {
+			raw += " = "
+		}
+
+		for i, value := range values {
+			if i > 0 {
+				raw += ", "
+			}
+
+			cv, er := newConfValue(value)
+			if er != nil {
+				return nil, er
+			}
+
+			param.values = append(param.values, cv)
+			raw += cv.raw
+		}
+	}
+
+	param.raw = raw + ";"
+	return param, nil
+}
+
+// newConfValue formats a value for writing and lexes it back into segments,
+// so the in-memory representation is exactly what a later parse would see.
+func newConfValue(value string) (confValue, error) {
+	lx := confLexer{src: formatConfValue(value), line: 1}
+	return lx.word()
+}
+
+func formatConfValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\r\n;,={}#\"'\\") &&
+		!strings.Contains(value, "+=") && !strings.Contains(value, "//") && !strings.Contains(value, "/*") {
+
+		return value
+	}
+
+	out := "\""
+	for _, c := range value {
+		switch c {
+		case '"', '\\':
+			out += "\\" + string(c)
+		case '\n':
+			out += "\\n"
+		case '\t':
+			out += "\\t"
+		case '\r':
+			out += "\\r"
+		default:
+			out += string(c)
+		}
+	}
+
+	return out + "\""
+}
+
+type confResolver struct {
+	vars   map[string][]confValue
+	params map[string][]confValue
+	order  []string
+	active map[string]bool
+}
+
+func (res *confResolver) applyAll(items []*confItem) {
+	for _, item := range items {
+		res.apply(item.param)
+	}
+}
+
+func (res *confResolver) apply(param *confParam) {
+	name := param.name
+	values := param.values
+
+	if strings.HasPrefix(name, "$") {
+		name = strings.Trim(name[1:], "{}")
+		res.vars[name] = mergeConfValues(res.vars[name], values, param.append)
+		return
+	}
+
+	if ty := paramTypeMapping[name]; ty != boolType && ty != jailSysType {
+		/* allow.noraw_sockets is shorthand for allow.raw_sockets = false,
+		 * and novnet for vnet = disable. */
+		idx := strings.LastIndex(name, ".") + 1
+
+		if yes := name[:idx] + strings.TrimPrefix(name[idx:], "no"); yes != name && paramTypeMapping[yes] == boolType {
+			name = yes
+			values = []confValue{{raw: "false", segs: []confSegment{{text: "false"}}}}
+
+		} else if yes != name && paramTypeMapping[yes] == jailSysType {
+			name = yes
+			values = []confValue{{raw: "disable", segs: []confSegment{{text: "disable"}}}}
+		}
+	}
+
+	if _, ok := res.params[name]; !ok {
+		res.order = append(res.order, name)
+	}
+
+	res.params[name] = mergeConfValues(res.params[name], values, param.append)
+}
+
+func mergeConfValues(prev, values []confValue, appending bool) []confValue {
+	if appending {
+		return append(append([]confValue{}, prev...), values...)
+	}
+
+	return append([]confValue{}, values...)
+}
+
+func (res *confResolver) lookup(name string) (string, error) {
+	values, ok := res.vars[name]
+	if !ok {
+		if values, ok = res.params[name]; !ok {
+			return "", fmt.Errorf("Undefined variable `%s'", name)
+		}
+	}
+
+	if res.active[name] {
+		return "", fmt.Errorf("Variable `%s' refers to itself", name)
+	}
+
+	res.active[name] = true
+	defer delete(res.active, name)
+
+	expanded, er := res.expandAll(values)
+	if er != nil {
+		return "", er
+	}
+
+	return strings.Join(expanded, ","), nil
+}
+
+func (res *confResolver) expand(cv confValue) (string, error) {
+	out := ""
+
+	for _, seg := range cv.segs {
+		if !seg.variable {
+			out += seg.text
+			continue
+		}
+
+		value, er := res.lookup(seg.text)
+		if er != nil {
+			return "", er
+		}
+
+		out += value
+	}
+
+	return out, nil
+}
+
+func (res *confResolver) expandAll(values []confValue) ([]string, error) {
+	out := make([]string, len(values))
+
+	for i, cv := range values {
+		var er error
+		if out[i], er = res.expand(cv); er != nil {
+			return nil, er
+		}
+	}
+
+	return out, nil
+}
+
+func (res *confResolver) resolve(name string) (*JailDef, error) {
+	def := &JailDef{
+		Params: map[string]interface{}{},
+		Exec:   map[string][]string{},
+		Extra:  map[string][]string{},
+	}
+
+	var er error
+	if def.Name, er = res.lookup("name"); er != nil {
+		return nil, er
+	}
+
+	def.Params["name"] = def.Name
+
+	for _, param := range res.order {
+		values, er := res.expandAll(res.params[param])
+		if er != nil {
+			return nil, fmt.Errorf("Jail `%s': %s", name, er)
+		}
+
+		if strings.HasPrefix(param, "exec.") {
+			def.Exec[param] = values
+
+		} else if ty := paramTypeMapping[param]; ty != nil {
+			if def.Params[param], er = confTypedValue(param, ty, values); er != nil {
+				return nil, fmt.Errorf("Jail `%s': %s", name, er)
+			}
+
+		} else {
+			def.Extra[param] = values
+		}
+	}
+
+	return def, nil
+}
+
+func confTypedValue(name string, ty reflect.Type, values []string) (interface{}, error) {
+	if ty == boolType {
+		if len(values) == 0 {
+			return true, nil
+		}
+
+		if len(values) == 1 {
+			if b, er := strconv.ParseBool(values[0]); er == nil {
+				return b, nil
+			}
+		}
+
+		return nil, fmt.Errorf("Parameter `%s' must be a bool", name)
+
+	} else if ty == intType {
+		if len(values) == 1 {
+			if i, er := strconv.Atoi(values[0]); er == nil {
+				return i, nil
+			}
+		}
+
+		return nil, fmt.Errorf("Parameter `%s' must be an int", name)
+
+	} else if ty == stringType {
+		return strings.Join(values, ","), nil
+
+	} else if ty == jailSysType {
+		/* Like jail(8), a bare "vnet;" means a new one. */
+		if len(values) == 0 {
+			return JailSysNew, nil
+		}
+
+		if len(values) == 1 {
+			switch sys := JailSys(values[0]); sys {
+			case JailSysNew, JailSysInherit, JailSysDisable:
+				return sys, nil
+			}
+		}
+
+		return nil, fmt.Errorf("Parameter `%s' must be one of new, inherit or disable", name)
+
+	} else if ty == ipSliceType {
+		ips := []net.IP{}
+
+		for _, value := range values {
+			/* Addresses may be written as iface|addr/mask; the interface
+			 * and netmask are only meaningful to jail(8). */
+			if idx := strings.IndexByte(value, '|'); idx >= 0 {
+				value = value[idx+1:]
+			}
+
+			if idx := strings.IndexByte(value, '/'); idx >= 0 {
+				value = value[:idx]
+			}
+
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("Parameter `%s' has invalid address `%s'", name, value)
+			}
+
+			if name == "ip4.addr" {
+				if ip = ip.To4(); ip == nil {
+					return nil, fmt.Errorf("Parameter `%s' has non-IPv4 address `%s'", name, value)
+				}
+			}
+
+			ips = append(ips, ip)
+		}
+
+		return ips, nil
+	}
+
+	return nil, fmt.Errorf("Unknown type for parameter `%s'", name)
+}
@@ -0,0 +1,202 @@
+package jail
+
+import (
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func loadTestConfig(t *testing.T) *Config {
+	conf, er := ParseConfigFile("testdata/jail.conf")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	return conf
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	src, er := os.ReadFile("testdata/jail.conf")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	conf := loadTestConfig(t)
+
+	if out := conf.String(); out != string(src) {
+		t.Errorf("Round trip changed the config:\n%s", out)
+	}
+}
+
+func TestConfigJailNames(t *testing.T) {
+	names := loadTestConfig(t).JailNames()
+
+	if !reflect.DeepEqual(names, []string{"www", "webdb"}) {
+		t.Errorf("Unexpected jail names %v", names)
+	}
+}
+
+func TestConfigResolve(t *testing.T) {
+	conf := loadTestConfig(t)
+
+	www, er := conf.Jail("www")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	expected := map[string]interface{}{
+		"name":          "www",
+		"path":          "/usr/jails/www",
+		"host.hostname": "www.example.org",
+		"securelevel":   3,
+		"ip4.addr":      []net.IP{net.IPv4(10, 0, 0, 10).To4(), net.IPv4(10, 0, 0, 11).To4()},
+	}
+
+	if !reflect.DeepEqual(www.Params, expected) {
+		t.Errorf("Unexpected params for www: %#v", www.Params)
+	}
+
+	if start := www.Exec["exec.start"]; !reflect.DeepEqual(start, []string{"/bin/sh /etc/rc", "/usr/local/bin/setup"}) {
+		t.Errorf("Unexpected exec.start for www: %#v", start)
+	}
+
+	if stop := www.Exec["exec.stop"]; !reflect.DeepEqual(stop, []string{"/bin/sh /etc/rc.shutdown"}) {
+		t.Errorf("Unexpected exec.stop for www: %#v", stop)
+	}
+
+	if _, ok := www.Extra["mount.devfs"]; !ok {
+		t.Errorf("mount.devfs missing from www")
+	}
+
+	/* The wildcard block applies before webdb's own block. */
+	webdb, er := conf.Jail("webdb")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if raw := webdb.Params["allow.raw_sockets"]; raw != false {
+		t.Errorf("allow.noraw_sockets should override the wildcard block, got %v", raw)
+	}
+
+	if persist := webdb.Params["persist"]; persist != true {
+		t.Errorf("persist should be true, got %v", persist)
+	}
+
+	if addrs := webdb.Params["ip6.addr"].([]net.IP); len(addrs) != 1 || !addrs[0].Equal(net.ParseIP("fd00::20")) {
+		t.Errorf("Unexpected ip6.addr for webdb: %v", addrs)
+	}
+
+	if _, er := conf.Jail("web*"); er == nil {
+		t.Errorf("Wildcard blocks should not resolve as jails")
+	}
+}
+
+func TestConfigJailSys(t *testing.T) {
+	conf, er := ParseConfig(strings.NewReader("a { vnet; }\nb { novnet; }\nc { vnet = inherit; }\n"))
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	for name, sys := range map[string]JailSys{"a": JailSysNew, "b": JailSysDisable, "c": JailSysInherit} {
+		def, er := conf.Jail(name)
+		if er != nil {
+			t.Fatal(er)
+		}
+
+		if def.Params["vnet"] != sys {
+			t.Errorf("Expected vnet = %s for %s, got %#v", sys, name, def.Params["vnet"])
+		}
+	}
+}
+
+func TestConfigEdit(t *testing.T) {
+	expected, er := os.ReadFile("testdata/jail-edited.conf")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	conf := loadTestConfig(t)
+
+	if er := conf.Set("www", "ip4.addr", "10.0.0.12"); er != nil {
+		t.Fatal(er)
+	}
+
+	if er := conf.Set("www", "host.hostname", "www and more"); er != nil {
+		t.Fatal(er)
+	}
+
+	if ok, er := conf.Unset("webdb", "children.max"); !ok || er != nil {
+		t.Fatalf("Unable to unset children.max: %v", er)
+	}
+
+	if er := conf.Set("", "enforce_statfs", "1"); er != nil {
+		t.Fatal(er)
+	}
+
+	if er := conf.AddJail("mail"); er != nil {
+		t.Fatal(er)
+	}
+
+	if er := conf.Set("mail", "path", "/jails/mail"); er != nil {
+		t.Fatal(er)
+	}
+
+	if out := conf.String(); out != string(expected) {
+		t.Errorf("Edited config doesn't match:\n%s", out)
+	}
+
+	if er := conf.AddJail("mail"); er == nil {
+		t.Errorf("Adding a duplicate jail should fail")
+	}
+
+	if er := conf.Set("nope", "path", "/"); er == nil {
+		t.Errorf("Setting a parameter on an undefined jail should fail")
+	}
+
+	/* The edited text must parse back to the same thing. */
+	reparsed, er := ParseConfig(strings.NewReader(conf.String()))
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	www, er := reparsed.Jail("www")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if hostname := www.Params["host.hostname"]; hostname != "www and more" {
+		t.Errorf("Unexpected hostname after edit: %v", hostname)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	bad := []string{
+		"foo {\n\tpath = /;\n",
+		"foo {\n\tbar {\n\t}\n}\n",
+		"path = /\n",
+		"/* unterminated\n",
+		"path = \"unterminated;\n",
+		"}\n",
+	}
+
+	for _, src := range bad {
+		if _, er := ParseConfig(strings.NewReader(src)); er == nil {
+			t.Errorf("Expected error parsing %q", src)
+		}
+	}
+
+	conf, er := ParseConfig(strings.NewReader("foo {\n\tpath = $nope;\n}\nbar {\n\t$a = $b;\n\t$b = $a;\n\tpath = $a;\n}\n"))
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if _, er := conf.Jail("foo"); er == nil {
+		t.Errorf("Undefined variables should be an error")
+	}
+
+	if _, er := conf.Jail("bar"); er == nil {
+		t.Errorf("Self-referential variables should be an error")
+	}
+}
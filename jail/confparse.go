@@ -0,0 +1,448 @@
+package jail
+
+import (
+	"fmt"
+	"strings"
+)
+
+type confTokenKind int
+
+const (
+	confEOF confTokenKind = iota
+	confWord
+	confLBrace
+	confRBrace
+	confSemi
+	confComma
+	confAssign
+	confAppend
+)
+
+// confToken is a single lexical token from a jail.conf file. Whitespace and
+// comments are not tokens; they're attached to the following token as lead
+// so that the original text can be reproduced exactly.
+type confToken struct {
+	kind  confTokenKind
+	lead  string
+	start int
+	end   int
+	line  int
+	value confValue
+}
+
+// confValue is a (possibly quoted) string from a jail.conf file, split into
+// literal text and variable references.
+type confValue struct {
+	raw  string
+	segs []confSegment
+}
+
+type confSegment struct {
+	text     string
+	variable bool
+}
+
+// literal returns the value with variable references left unexpanded, which
+// is what we want for names (jail names and parameter names).
+func (cv confValue) literal() string {
+	out := ""
+
+	for _, seg := range cv.segs {
+		if seg.variable {
+			out += "${" + seg.text + "}"
+
+		} else {
+			out += seg.text
+		}
+	}
+
+	return out
+}
+
+type confLexer struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (lx *confLexer) peekByte(off int) byte {
+	if lx.pos+off < len(lx.src) {
+		return lx.src[lx.pos+off]
+	}
+
+	return 0
+}
+
+func (lx *confLexer) advance(n int) {
+	for i := 0; i < n && lx.pos < len(lx.src); i++ {
+		if lx.src[lx.pos] == '\n' {
+			lx.line++
+		}
+
+		lx.pos++
+	}
+}
+
+// skipTrivia consumes whitespace and all three comment styles jail(8)
+// understands: "#", "//" and "/* */".
+func (lx *confLexer) skipTrivia() error {
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			lx.advance(1)
+
+		} else if c == '#' || (c == '/' && lx.peekByte(1) == '/') {
+			for lx.pos < len(lx.src) && lx.src[lx.pos] != '\n' {
+				lx.advance(1)
+			}
+
+		} else if c == '/' && lx.peekByte(1) == '*' {
+			line := lx.line
+			end := strings.Index(lx.src[lx.pos+2:], "*/")
+			if end < 0 {
+				return fmt.Errorf("Line %d: unterminated comment", line)
+			}
+
+			lx.advance(end + 4)
+
+		} else {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (lx *confLexer) next() (tok confToken, er error) {
+	leadStart := lx.pos
+
+	if er := lx.skipTrivia(); er != nil {
+		return tok, er
+	}
+
+	tok.lead = lx.src[leadStart:lx.pos]
+	tok.start = lx.pos
+	tok.line = lx.line
+
+	if lx.pos >= len(lx.src) {
+		tok.kind = confEOF
+		tok.end = lx.pos
+		return tok, nil
+	}
+
+	switch c := lx.src[lx.pos]; {
+	case c == '{':
+		tok.kind = confLBrace
+		lx.advance(1)
+
+	case c == '}':
+		tok.kind = confRBrace
+		lx.advance(1)
+
+	case c == ';':
+		tok.kind = confSemi
+		lx.advance(1)
+
+	case c == ',':
+		tok.kind = confComma
+		lx.advance(1)
+
+	case c == '=':
+		tok.kind = confAssign
+		lx.advance(1)
+
+	case c == '+' && lx.peekByte(1) == '=':
+		tok.kind = confAppend
+		lx.advance(2)
+
+	default:
+		tok.kind = confWord
+		if tok.value, er = lx.word(); er != nil {
+			return tok, er
+		}
+	}
+
+	tok.end = lx.pos
+	return tok, nil
+}
+
+func isConfVarByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func confEscape(c byte) string {
+	switch c {
+	case 'n':
+		return "\n"
+	case 't':
+		return "\t"
+	case 'r':
+		return "\r"
+	}
+
+	return string(c)
+}
+
+// word lexes a single string value, which may be made up of any mix of bare
+// text, "double-quoted" text (which undergoes variable expansion) and
+// 'single-quoted' text (which doesn't).
+func (lx *confLexer) word() (val confValue, er error) {
+	start := lx.pos
+	line := lx.line
+	lit := ""
+
+	flush := func() {
+		if lit != "" {
+			val.segs = append(val.segs, confSegment{text: lit})
+			lit = ""
+		}
+	}
+
+	variable := func() error {
+		lx.advance(1)
+
+		name := ""
+		if lx.peekByte(0) == '{' {
+			end := strings.IndexByte(lx.src[lx.pos:], '}')
+			if end < 0 {
+				return fmt.Errorf("Line %d: unterminated variable reference", lx.line)
+			}
+
+			name = lx.src[lx.pos+1 : lx.pos+end]
+			lx.advance(end + 1)
+
+		} else {
+			for lx.pos < len(lx.src) && isConfVarByte(lx.src[lx.pos]) {
+				name += string(lx.src[lx.pos])
+				lx.advance(1)
+			}
+		}
+
+		if name == "" {
+			return fmt.Errorf("Line %d: empty variable reference", lx.line)
+		}
+
+		flush()
+		val.segs = append(val.segs, confSegment{text: name, variable: true})
+		return nil
+	}
+
+	for lx.pos < len(lx.src) {
+		c := lx.src[lx.pos]
+
+		if strings.IndexByte(" \t\r\n;,={}#", c) >= 0 {
+			break
+
+		} else if c == '+' && lx.peekByte(1) == '=' {
+			break
+
+		} else if c == '/' && (lx.peekByte(1) == '/' || lx.peekByte(1) == '*') {
+			break
+
+		} else if c == '\\' && lx.pos+1 < len(lx.src) {
+			lit += confEscape(lx.src[lx.pos+1])
+			lx.advance(2)
+
+		} else if c == '$' {
+			if er := variable(); er != nil {
+				return val, er
+			}
+
+		} else if c == '\'' {
+			end := strings.IndexByte(lx.src[lx.pos+1:], '\'')
+			if end < 0 {
+				return val, fmt.Errorf("Line %d: unterminated string", line)
+			}
+
+			lit += lx.src[lx.pos+1 : lx.pos+1+end]
+			lx.advance(end + 2)
+
+		} else if c == '"' {
+			lx.advance(1)
+
+			for {
+				if lx.pos >= len(lx.src) {
+					return val, fmt.Errorf("Line %d: unterminated string", line)
+				}
+
+				c = lx.src[lx.pos]
+
+				if c == '"' {
+					lx.advance(1)
+					break
+
+				} else if c == '\\' && lx.pos+1 < len(lx.src) {
+					lit += confEscape(lx.src[lx.pos+1])
+					lx.advance(2)
+
+				} else if c == '$' {
+					if er := variable(); er != nil {
+						return val, er
+					}
+
+				} else {
+					lit += string(c)
+					lx.advance(1)
+				}
+			}
+
+		} else {
+			lit += string(c)
+			lx.advance(1)
+		}
+	}
+
+	flush()
+	val.raw = lx.src[start:lx.pos]
+
+	/* A pair of empty quotes is a perfectly valid (empty) value. */
+	if len(val.segs) == 0 {
+		val.segs = []confSegment{{text: ""}}
+	}
+
+	return val, nil
+}
+
+type confParser struct {
+	lx  confLexer
+	tok confToken
+}
+
+func (p *confParser) advance() error {
+	tok, er := p.lx.next()
+	if er != nil {
+		return er
+	}
+
+	p.tok = tok
+	return nil
+}
+
+func parseConfig(src string) (*Config, error) {
+	p := &confParser{lx: confLexer{src: src, line: 1}}
+
+	if er := p.advance(); er != nil {
+		return nil, er
+	}
+
+	items, er := p.parseItems(false)
+	if er != nil {
+		return nil, er
+	}
+
+	if p.tok.kind != confEOF {
+		return nil, fmt.Errorf("Line %d: unexpected `}'", p.tok.line)
+	}
+
+	return &Config{items: items, tail: p.tok.lead}, nil
+}
+
+// parseItems parses statements up until EOF or (inside a block) the closing
+// brace, which is left as the current token.
+func (p *confParser) parseItems(inBlock bool) (items []*confItem, er error) {
+	for p.tok.kind != confEOF && p.tok.kind != confRBrace {
+		item, er := p.parseItem(inBlock)
+		if er != nil {
+			return nil, er
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func (p *confParser) parseItem(inBlock bool) (*confItem, error) {
+	nameTok := p.tok
+	if nameTok.kind != confWord {
+		return nil, fmt.Errorf("Line %d: expected parameter or jail name", nameTok.line)
+	}
+
+	item := &confItem{lead: nameTok.lead}
+
+	if er := p.advance(); er != nil {
+		return nil, er
+	}
+
+	if p.tok.kind == confLBrace {
+		if inBlock {
+			return nil, fmt.Errorf("Line %d: jail blocks cannot be nested", p.tok.line)
+		}
+
+		block := &confBlock{
+			header: p.lx.src[nameTok.start:p.tok.end],
+			name:   nameTok.value.literal(),
+		}
+
+		if er := p.advance(); er != nil {
+			return nil, er
+		}
+
+		items, er := p.parseItems(true)
+		if er != nil {
+			return nil, er
+		}
+
+		if p.tok.kind != confRBrace {
+			return nil, fmt.Errorf("Line %d: missing `}' for jail `%s'", nameTok.line, block.name)
+		}
+
+		block.items = items
+		block.closeLead = p.tok.lead
+		item.block = block
+
+		return item, p.advanceTrail(item)
+	}
+
+	param := &confParam{name: p.lx.src[nameTok.start:nameTok.end]}
+
+	if p.tok.kind == confAssign || p.tok.kind == confAppend {
+		param.append = p.tok.kind == confAppend
+
+		for {
+			if er := p.advance(); er != nil {
+				return nil, er
+			}
+
+			if p.tok.kind != confWord {
+				return nil, fmt.Errorf("Line %d: expected value for parameter `%s'", p.tok.line, param.name)
+			}
+
+			param.values = append(param.values, p.tok.value)
+
+			if er := p.advance(); er != nil {
+				return nil, er
+			}
+
+			if p.tok.kind != confComma {
+				break
+			}
+		}
+	}
+
+	if p.tok.kind != confSemi {
+		return nil, fmt.Errorf("Line %d: expected `;' after parameter `%s'", p.tok.line, param.name)
+	}
+
+	param.raw = p.lx.src[nameTok.start:p.tok.end]
+	item.param = param
+
+	return item, p.advanceTrail(item)
+}
+
+// advanceTrail moves past the end of item, handing it any comment that
+// follows on the same line so the comment goes wherever the item does.
+func (p *confParser) advanceTrail(item *confItem) error {
+	if er := p.advance(); er != nil {
+		return er
+	}
+
+	idx := strings.IndexByte(p.tok.lead, '\n')
+	if idx >= 0 && !strings.Contains(p.tok.lead[:idx], "/*") {
+		item.trail = p.tok.lead[:idx]
+		p.tok.lead = p.tok.lead[idx:]
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package jail
+
+import (
+	"reflect"
+	"strings"
+)
+
+// The kernel describes every jail parameter it supports with a sysctl OID
+// under this node; it's the same metadata libjail uses to find out how to
+// marshal a parameter.
+const jailParamSysctl = "security.jail.param"
+
+// CTLTYPE_* values from <sys/sysctl.h>.
+const (
+	ctlTypeNode   = 1
+	ctlTypeInt    = 2
+	ctlTypeString = 3
+	ctlTypeS64    = 4
+	ctlTypeOpaque = 5
+	ctlTypeUint   = 6
+	ctlTypeLong   = 7
+	ctlTypeUlong  = 8
+	ctlTypeU64    = 9
+	ctlTypeU8     = 0xa
+	ctlTypeU16    = 0xb
+	ctlTypeS8     = 0xc
+	ctlTypeS16    = 0xd
+	ctlTypeS32    = 0xe
+	ctlTypeU32    = 0xf
+
+	ctlTypeMask = 0xf
+)
+
+// sysctlReader is the subset of sysctl(3) needed to discover the kernel's
+// jail parameters.
+type sysctlReader interface {
+	// list returns the names of all leaf OIDs below the named node.
+	list(node string) ([]string, error)
+
+	// format returns the CTLTYPE_* kind and format string of an OID.
+	format(name string) (kind int, format string, er error)
+}
+
+// discoverParamTypes walks the security.jail.param tree and returns the type
+// of every parameter found. Parameters with types this package can't
+// marshal are left out.
+func discoverParamTypes(sr sysctlReader) (map[string]reflect.Type, error) {
+	oids, er := sr.list(jailParamSysctl)
+	if er != nil {
+		return nil, er
+	}
+
+	types := map[string]reflect.Type{}
+
+	for _, oid := range oids {
+		if !strings.HasPrefix(oid, jailParamSysctl+".") {
+			continue
+		}
+
+		kind, format, er := sr.format(oid)
+		if er != nil {
+			return nil, er
+		}
+
+		/* Parameters that are also nodes (e.g., allow.mount, which has
+		 * allow.mount.* underneath it) are registered with a trailing dot. */
+		name := strings.TrimSuffix(strings.TrimPrefix(oid, jailParamSysctl+"."), ".")
+
+		if ty := sysctlParamType(kind, format); ty != nil && name != "" {
+			types[name] = ty
+		}
+	}
+
+	return types, nil
+}
+
+func sysctlParamType(kind int, format string) reflect.Type {
+	switch kind &= ctlTypeMask; {
+	case kind == ctlTypeNode:
+		return nil
+
+	case strings.HasPrefix(format, "E,jailsys"):
+		return jailSysType
+
+	case format == "B":
+		return boolType
+
+	case kind == ctlTypeString:
+		return stringType
+
+	case kind == ctlTypeOpaque:
+		if strings.HasPrefix(format, "S,in_addr") || strings.HasPrefix(format, "S,in6_addr") {
+			return ipSliceType
+		}
+
+		return nil
+
+	case kind == ctlTypeInt, kind == ctlTypeUint, kind == ctlTypeLong, kind == ctlTypeUlong,
+		kind == ctlTypeS64, kind == ctlTypeU64, kind == ctlTypeU8, kind == ctlTypeU16,
+		kind == ctlTypeS8, kind == ctlTypeS16, kind == ctlTypeS32, kind == ctlTypeU32:
+
+		return intType
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package jail
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// cannedSysctl is a sysctlReader backed by a dump in testdata.
+type cannedSysctl struct {
+	kinds   map[string]int
+	formats map[string]string
+	order   []string
+}
+
+func loadCannedSysctl(t *testing.T, path string) *cannedSysctl {
+	kinds := map[string]int{
+		"integer":       ctlTypeInt,
+		"string":        ctlTypeString,
+		"opaque":        ctlTypeOpaque,
+		"unsigned long": ctlTypeUlong,
+	}
+
+	f, er := os.Open(path)
+	if er != nil {
+		t.Fatal(er)
+	}
+	defer f.Close()
+
+	canned := &cannedSysctl{kinds: map[string]int{}, formats: map[string]string{}}
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, ": ", 3)
+		if len(fields) != 3 {
+			t.Fatalf("Bad line in %s: %s", path, line)
+		}
+
+		kind, ok := kinds[fields[1]]
+		if !ok {
+			t.Fatalf("Bad type in %s: %s", path, line)
+		}
+
+		canned.kinds[fields[0]] = kind
+		canned.formats[fields[0]] = fields[2]
+		canned.order = append(canned.order, fields[0])
+	}
+
+	return canned
+}
+
+func (cs *cannedSysctl) list(node string) ([]string, error) {
+	names := []string{}
+
+	for _, name := range cs.order {
+		if strings.HasPrefix(name, node+".") {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+func (cs *cannedSysctl) format(name string) (int, string, error) {
+	kind, ok := cs.kinds[name]
+	if !ok {
+		return 0, "", fmt.Errorf("No such OID %s", name)
+	}
+
+	return kind, cs.formats[name], nil
+}
+
+func TestDiscoverParamTypes(t *testing.T) {
+	canned := loadCannedSysctl(t, "testdata/jail-param.sysctl")
+
+	types, er := discoverParamTypes(canned)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	expected := map[string]reflect.Type{
+		"jid":                  intType,
+		"name":                 stringType,
+		"devfs_ruleset":        intType,
+		"enforce_statfs":       intType,
+		"persist":              boolType,
+		"vnet":                 jailSysType,
+		"osrelease":            stringType,
+		"osreldate":            intType,
+		"host":                 jailSysType,
+		"host.hostid":          intType,
+		"ip4":                  jailSysType,
+		"ip4.addr":             ipSliceType,
+		"ip6.addr":             ipSliceType,
+		"ip6.saddrsel":         boolType,
+		"allow.mlock":          boolType,
+		"allow.mount":          boolType,
+		"allow.mount.devfs":    boolType,
+		"allow.mount.zfs":      boolType,
+		"sysvmsg":              jailSysType,
+		"sysvshm":              jailSysType,
+		"linux":                jailSysType,
+		"linux.osname":         stringType,
+		"zfs.mount_snapshot":   intType,
+		"allow.reserved_ports": boolType,
+		"mac.label":            nil,
+	}
+
+	for name, ty := range expected {
+		if types[name] != ty {
+			t.Errorf("Parameter `%s' discovered as %v, expected %v", name, types[name], ty)
+		}
+	}
+
+	/* Only mac.label has a type we can't marshal. */
+	if len(types) != len(canned.order)-1 {
+		t.Errorf("Discovered %d parameters from %d OIDs", len(types), len(canned.order))
+	}
+
+	/* Everything in the static table should have been found. */
+	for name := range builtinParamTypes {
+		if _, ok := types[name]; !ok && name != "lastjid" {
+			t.Errorf("Static parameter `%s' not discovered", name)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+//go:build freebsd
+
+package jail
+
+/*
+#cgo LDFLAGS: -ljail
+#include <sys/param.h>
+#include <sys/jail.h>
+*/
+import "C"
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/lye/freebsd/netif"
+)
+
+func runIfconfigHelper(argv []string) int {
+	conf, er := parseIfconfigHelperArgs(argv)
+	if er != nil {
+		fmt.Fprintf(os.Stderr, "jail: %s\n", er)
+		return 1
+	}
+
+	if _, er := C.jail_attach(C.int(conf.Jid)); er != nil {
+		fmt.Fprintf(os.Stderr, "jail: jail_attach: %s\n", er)
+		return 1
+	}
+
+	if er := netif.SetUp(conf.Iface, true); er != nil {
+		fmt.Fprintf(os.Stderr, "jail: %s up: %s\n", conf.Iface, er)
+		return 1
+	}
+
+	for _, addr := range conf.Addrs {
+		if er := netif.AddAddr(conf.Iface, addr); er != nil {
+			fmt.Fprintf(os.Stderr, "jail: %s %s: %s\n", conf.Iface, addr, er)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// Epairs returns the epairs plumbed into the jail when it was created. Only
+// the Jail returned by CreateJail knows about them.
+func (j *Jail) Epairs() []Epair {
+	return j.epairs
+}
+
+func (j *Jail) plumbEpairs(epairs []VnetEpair) error {
+	for _, epair := range epairs {
+		host, jailed, er := netif.CreateEpair()
+		if er != nil {
+			return er
+		}
+
+		/* Record it straight away so that Destroy cleans it up if the
+		 * rest fails. */
+		j.epairs = append(j.epairs, Epair{Host: host, Jail: jailed})
+
+		for _, addr := range epair.HostAddrs {
+			if er := netif.AddAddr(host, addr); er != nil {
+				return er
+			}
+		}
+
+		if er := netif.SetUp(host, true); er != nil {
+			return er
+		}
+
+		if er := netif.MoveToJail(jailed, j.jid); er != nil {
+			return er
+		}
+
+		if er := j.configureJailedIface(jailed, epair.JailAddrs); er != nil {
+			return er
+		}
+	}
+
+	return nil
+}
+
+func (j *Jail) configureJailedIface(name string, addrs []netif.InterfaceAddr) error {
+	argv, er := ifconfigHelperArgs(j.jid, name, addrs)
+	if er != nil {
+		return er
+	}
+
+	self, er := os.Executable()
+	if er != nil {
+		return er
+	}
+
+	cmd := &exec.Cmd{Path: self, Args: argv}
+
+	if out, er := cmd.CombinedOutput(); er != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("Unable to configure `%s' in jail %d: %s", name, j.jid, msg)
+		}
+
+		return er
+	}
+
+	return nil
+}
+
+// reclaimEpairs moves the jailed ends of the jail's epairs back to the
+// host, which has to happen while the jail still exists. It's best effort:
+// unplumbEpairs takes the jailed end with the host end, wherever it is, so
+// an interface that can't be reclaimed isn't left behind.
+func (j *Jail) reclaimEpairs() {
+	for _, epair := range j.epairs {
+		netif.ReclaimFromJail(epair.Jail, j.jid)
+	}
+}
+
+// unplumbEpairs destroys the jail's epairs. Destroying the host end takes
+// the jailed end with it, wherever it is.
+func (j *Jail) unplumbEpairs() error {
+	var first error
+
+	for _, epair := range j.epairs {
+		if er := netif.DestroyInterface(epair.Host); er != nil && first == nil {
+			first = er
+		}
+	}
+
+	j.epairs = nil
+
+	return first
+}
@@ -0,0 +1,71 @@
+package jail
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+var (
+	// ErrJailNotFound is returned when no jail matches a JID or name (the
+	// kernel's ENOENT).
+	ErrJailNotFound = errors.New("jail: not found")
+
+	// ErrJailPermission is returned when the caller isn't allowed to see or
+	// change a jail (EPERM), usually because it isn't root or is itself
+	// jailed.
+	ErrJailPermission = errors.New("jail: permission denied")
+
+	// ErrJailInvalid is returned when the kernel rejects a parameter or its
+	// value (EINVAL).
+	ErrJailInvalid = errors.New("jail: invalid parameter")
+)
+
+// JailError describes a failed jail system call. It matches the Err*
+// sentinels above as well as the underlying errno with errors.Is.
+type JailError struct {
+	// Op is the libjail call that failed, e.g. "jailparam_get".
+	Op string
+
+	// Errno is the error the kernel returned.
+	Errno syscall.Errno
+
+	// Message is libjail's description of the failure, if it gave one.
+	Message string
+}
+
+func (je *JailError) Error() string {
+	if je.Message != "" {
+		return fmt.Sprintf("%s: %s", je.Op, je.Message)
+	}
+
+	return fmt.Sprintf("%s: %s", je.Op, je.Errno)
+}
+
+func (je *JailError) Unwrap() error {
+	return je.Errno
+}
+
+func (je *JailError) Is(target error) bool {
+	switch target {
+	case ErrJailNotFound:
+		return je.Errno == syscall.ENOENT
+	case ErrJailPermission:
+		return je.Errno == syscall.EPERM
+	case ErrJailInvalid:
+		return je.Errno == syscall.EINVAL
+	}
+
+	return false
+}
+
+// newJailError wraps an errno from op in a JailError; anything else is
+// returned untouched.
+func newJailError(op string, er error, msg string) error {
+	errno, ok := er.(syscall.Errno)
+	if !ok {
+		return er
+	}
+
+	return &JailError{Op: op, Errno: errno, Message: msg}
+}
@@ -0,0 +1,48 @@
+package jail
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+)
+
+func TestJailError(t *testing.T) {
+	er := newJailError("jailparam_get", syscall.ENOENT, "jail \"www\" not found")
+
+	if !errors.Is(er, ErrJailNotFound) {
+		t.Errorf("ENOENT should be ErrJailNotFound")
+	}
+
+	if !errors.Is(er, syscall.ENOENT) {
+		t.Errorf("JailError should unwrap to its errno")
+	}
+
+	if errors.Is(er, ErrJailPermission) || errors.Is(er, ErrJailInvalid) {
+		t.Errorf("ENOENT should only match ErrJailNotFound")
+	}
+
+	if er.Error() != "jailparam_get: jail \"www\" not found" {
+		t.Errorf("Unexpected message `%s'", er.Error())
+	}
+
+	var je *JailError
+	if !errors.As(er, &je) || je.Op != "jailparam_get" || je.Errno != syscall.ENOENT {
+		t.Errorf("Expected a *JailError, got %#v", er)
+	}
+
+	if er := newJailError("jailparam_set", syscall.EPERM, ""); !errors.Is(er, ErrJailPermission) {
+		t.Errorf("EPERM should be ErrJailPermission")
+
+	} else if er.Error() != "jailparam_set: "+syscall.EPERM.Error() {
+		t.Errorf("Unexpected message `%s'", er.Error())
+	}
+
+	if er := newJailError("jailparam_set", syscall.EINVAL, ""); !errors.Is(er, ErrJailInvalid) {
+		t.Errorf("EINVAL should be ErrJailInvalid")
+	}
+
+	other := errors.New("not an errno")
+	if newJailError("jailparam_get", other, "") != other {
+		t.Errorf("Non-errno errors should pass through untouched")
+	}
+}
@@ -0,0 +1,115 @@
+package jail
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+)
+
+// ExecOptions controls the identity a command takes on inside a jail,
+// mirroring the flags to jexec(8). With no options set, the command runs
+// as root (though jailed).
+type ExecOptions struct {
+	// User is looked up in the jail's password database after attaching,
+	// like jexec -u. Its groups, gid, uid and login class are applied.
+	User string
+
+	// HostUser is looked up in the host's password database before
+	// attaching, like jexec -U.
+	HostUser string
+
+	// Credential sets the uid, gid and supplementary groups directly, for
+	// when there's no password entry to look up.
+	Credential *syscall.Credential
+
+	// LoginClass overrides the login class used for resource limits,
+	// priority, umask and so on; by default it's the user's own class.
+	LoginClass string
+
+	// Login runs the command with a clean environment, like jexec -l: only
+	// TERM is kept, and HOME, SHELL and USER are set for the user.
+	Login bool
+}
+
+func (opts *ExecOptions) validate() error {
+	set := 0
+
+	if opts.User != "" {
+		set++
+	}
+
+	if opts.HostUser != "" {
+		set++
+	}
+
+	if opts.Credential != nil {
+		set++
+	}
+
+	if set > 1 {
+		return fmt.Errorf("Only one of User, HostUser and Credential may be set")
+	}
+
+	return nil
+}
+
+// The re-exec'd helper is recognized by its argv[0]; argv[1] is the encoded
+// execHelperConf and the rest is the command to run.
+const execHelperArg0 = "freebsd-jail-exec"
+
+type execHelperConf struct {
+	Jid  int
+	Opts ExecOptions
+}
+
+func execHelperArgs(jid int, opts ExecOptions, name string, args []string) ([]string, error) {
+	if er := opts.validate(); er != nil {
+		return nil, er
+	}
+
+	conf, er := json.Marshal(execHelperConf{Jid: jid, Opts: opts})
+	if er != nil {
+		return nil, er
+	}
+
+	argv := []string{execHelperArg0, string(conf), name}
+	return append(argv, args...), nil
+}
+
+func parseExecHelperArgs(argv []string) (conf execHelperConf, cmd []string, er error) {
+	if len(argv) < 3 || argv[0] != execHelperArg0 {
+		return conf, nil, fmt.Errorf("Malformed exec helper arguments")
+	}
+
+	if er := json.Unmarshal([]byte(argv[1]), &conf); er != nil {
+		return conf, nil, er
+	}
+
+	if er := conf.Opts.validate(); er != nil {
+		return conf, nil, er
+	}
+
+	return conf, argv[2:], nil
+}
+
+// exitStatus turns the result of waiting for a command into its exit
+// status. Exiting non-zero isn't an error; a command killed by a signal
+// gets 128 plus the signal number, as in the shell.
+func exitStatus(er error) (int, error) {
+	if er == nil {
+		return 0, nil
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(er, &exitErr) {
+		return -1, er
+	}
+
+	if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal()), nil
+	}
+
+	return exitErr.ExitCode(), nil
+}
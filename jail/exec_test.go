@@ -0,0 +1,79 @@
+package jail
+
+import (
+	"os/exec"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestExecHelperArgs(t *testing.T) {
+	opts := ExecOptions{
+		Credential: &syscall.Credential{Uid: 80, Gid: 80, Groups: []uint32{5, 6}},
+		LoginClass: "daemon",
+		Login:      true,
+	}
+
+	argv, er := execHelperArgs(12, opts, "/bin/sh", []string{"-c", "echo hi"})
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if argv[0] != execHelperArg0 {
+		t.Errorf("Helper argv[0] is `%s'", argv[0])
+	}
+
+	conf, cmd, er := parseExecHelperArgs(argv)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if conf.Jid != 12 || !reflect.DeepEqual(conf.Opts, opts) {
+		t.Errorf("Options didn't survive the round trip: %#v", conf)
+	}
+
+	if !reflect.DeepEqual(cmd, []string{"/bin/sh", "-c", "echo hi"}) {
+		t.Errorf("Unexpected command %v", cmd)
+	}
+}
+
+func TestExecHelperArgsInvalid(t *testing.T) {
+	if _, er := execHelperArgs(1, ExecOptions{User: "www", HostUser: "www"}, "/bin/sh", nil); er == nil {
+		t.Errorf("User and HostUser together should be rejected")
+	}
+
+	if _, er := execHelperArgs(1, ExecOptions{User: "www", Credential: &syscall.Credential{}}, "/bin/sh", nil); er == nil {
+		t.Errorf("User and Credential together should be rejected")
+	}
+
+	for _, argv := range [][]string{
+		nil,
+		{execHelperArg0, "{}"},
+		{"sh", "{}", "/bin/sh"},
+		{execHelperArg0, "not json", "/bin/sh"},
+	} {
+		if _, _, er := parseExecHelperArgs(argv); er == nil {
+			t.Errorf("Expected error parsing %v", argv)
+		}
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	for script, expected := range map[string]int{
+		"exit 0":     0,
+		"exit 3":     3,
+		"kill -9 $$": 128 + int(syscall.SIGKILL),
+	} {
+		status, er := exitStatus(exec.Command("/bin/sh", "-c", script).Run())
+		if er != nil {
+			t.Errorf("%s: %s", script, er)
+
+		} else if status != expected {
+			t.Errorf("%s: exited with %d, expected %d", script, status, expected)
+		}
+	}
+
+	if _, er := exitStatus(exec.Command("/nonexistent").Run()); er == nil {
+		t.Errorf("A command that never started should be an error")
+	}
+}
@@ -0,0 +1,134 @@
+//go:build freebsd
+
+package jail
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/lye/freebsd/cpuset"
+	"github.com/lye/freebsd/fs"
+	"github.com/lye/freebsd/rctl"
+)
+
+// Snapshot captures the jail's parameters, resource limits, CPUs and the
+// filesystems mounted under its root. The parameters are read in a single
+// call, so they're consistent with each other.
+func (j *Jail) Snapshot() (*Snapshot, error) {
+	/* Not every kernel has every parameter in the table. */
+	params, er := j.getParams(snapshotParamNames(), true)
+	if er != nil {
+		return nil, er
+	}
+
+	snap := &Snapshot{
+		Version: SnapshotVersion,
+		Params:  params,
+	}
+
+	rules, er := j.Limits()
+	if er != nil && er != rctl.ErrNotEnabled {
+		return nil, er
+	}
+
+	for _, rule := range rules {
+		snap.Limits = append(snap.Limits, rule.String())
+	}
+
+	cpus, er := j.CPUs()
+	if er != nil {
+		return nil, er
+	}
+
+	snap.CPUs = cpus.String()
+
+	root := filepath.Clean(j.path)
+
+	for _, mi := range fs.GetMountInfo() {
+		target := mi.MntToName()
+
+		if target != root && !strings.HasPrefix(target, root+"/") {
+			continue
+		}
+
+		rel, er := filepath.Rel(root, target)
+		if er != nil {
+			return nil, er
+		}
+
+		snap.Mounts = append(snap.Mounts, SnapshotMount{
+			FsType: mi.FsTypeName(),
+			Source: mi.MntFromName(),
+			Target: "/" + strings.TrimPrefix(rel, "."),
+			Flags:  mi.Flags(),
+		})
+	}
+
+	return snap, nil
+}
+
+// RestoreSnapshot creates a jail from a snapshot, then applies its resource
+// limits and CPUs. The snapshot's parameters are checked against the
+// parameter table before anything is created; mounts are not restored.
+func RestoreSnapshot(snap *Snapshot) (*Jail, error) {
+	if er := snap.validate(); er != nil {
+		return nil, er
+	}
+
+	limits := []rctl.Rule{}
+
+	for _, limit := range snap.Limits {
+		rule, er := rctl.ParseRule(limit)
+		if er != nil {
+			return nil, er
+		}
+
+		limits = append(limits, rule)
+	}
+
+	jpps := jailParamList{}
+	defer jpps.release()
+
+	if er := jpps.bindParameters(snap.Params); er != nil {
+		return nil, er
+	}
+
+	jid, er := jpps.set(jailCreate)
+	if er != nil {
+		return nil, er
+	}
+
+	jail := &Jail{
+		jid: jid,
+	}
+
+	if er := jail.Refresh(); er != nil {
+		jail.Destroy()
+		return nil, er
+	}
+
+	for _, rule := range limits {
+		/* The jail's name may have been changed on the way. */
+		rule.Subject = rctl.SubjectJail
+		rule.SubjectId = jail.name
+
+		if er := rctl.AddRule(rule); er != nil {
+			jail.Destroy()
+			return nil, er
+		}
+	}
+
+	if snap.CPUs != "" {
+		cpus, er := cpuset.ParseCPUMask(snap.CPUs)
+		if er == nil {
+			er = jail.PinToCPUs(cpus.CPUs())
+		}
+
+		if er != nil {
+			jail.Destroy()
+			return nil, er
+		}
+	}
+
+	return jail, nil
+}
@@ -3,34 +3,55 @@ package jail
 import (
 	"net"
 	"reflect"
+	"sort"
 )
 
+var (
+	intType, stringType, ipType, ipSliceType, boolType, jailSysType reflect.Type
+
+	// builtinParamTypes is the parameter table this package ships with;
+	// paramTypeMapping adds whatever else the running kernel reports.
+	builtinParamTypes, paramTypeMapping map[string]reflect.Type
+)
+
+// readOnlyParams are reported by the kernel but can't be set.
+var readOnlyParams = map[string]bool{
+	"lastjid":      true,
+	"parent":       true,
+	"children.cur": true,
+	"cpuset.id":    true,
+	"dying":        true,
+}
+
 func init() {
 	intType = reflect.TypeOf(int(1))
 	stringType = reflect.TypeOf("")
 	ipType = reflect.TypeOf(net.IP{})
 	ipSliceType = reflect.TypeOf([]net.IP{})
 	boolType = reflect.TypeOf(true)
+	jailSysType = reflect.TypeOf(JailSys(""))
 
-	paramTypeMapping = map[string]reflect.Type{
+	builtinParamTypes = map[string]reflect.Type{
 		"jid":     intType,
 		"lastjid": intType,
 		"name":    stringType,
 		"path":    stringType,
 
-		"ip4":          stringType,
+		"ip4":          jailSysType,
 		"ip4.addr":     ipSliceType,
 		"ip4.saddrsel": boolType,
 
-		"ip6":          stringType,
+		"ip6":          jailSysType,
 		"ip6.addr":     ipSliceType,
 		"ip6.saddrsel": boolType,
 
-		"host":            stringType,
+		"vnet": jailSysType,
+
+		"host":            jailSysType,
 		"host.hostname":   stringType,
 		"host.domainname": stringType,
 		"host.hostuuid":   stringType,
-		"host.hostid":     stringType,
+		"host.hostid":     intType,
 
 		"securelevel": intType,
 
@@ -38,7 +59,7 @@ func init() {
 		"children.cur": intType,
 		"parent":       intType,
 
-		"enforce_statfs": boolType,
+		"enforce_statfs": intType,
 		"persist":        boolType,
 		"cpuset.id":      intType,
 		"dying":          boolType,
@@ -51,4 +72,33 @@ func init() {
 		"allow.quotas":       boolType,
 		"allow.socket_af":    boolType,
 	}
+
+	paramTypeMapping = map[string]reflect.Type{}
+	for name, ty := range builtinParamTypes {
+		paramTypeMapping[name] = ty
+	}
+
+	/* The table above is only a fallback; the kernel knows exactly which
+	 * parameters it supports (including those from modules), so ask it. */
+	if paramSysctl != nil {
+		if types, er := discoverParamTypes(paramSysctl); er == nil {
+			for name, ty := range types {
+				paramTypeMapping[name] = ty
+			}
+		}
+	}
+}
+
+// ParamNames returns the names of every jail parameter the package knows how
+// to marshal, sorted. On FreeBSD that's whatever the running kernel reports,
+// as well as the built-in table.
+func ParamNames() []string {
+	names := []string{}
+
+	for name := range paramTypeMapping {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
 }
@@ -1,3 +1,5 @@
+//go:build freebsd
+
 package jail
 
 /*
@@ -9,35 +11,18 @@ package jail
 */
 import "C"
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net"
 	"os/exec"
-	"strconv"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"syscall"
-)
-
-// Jail provides a wrapper around a single jail's metadata. Older versions of
-// FreeBSD represented jails as a simple struct, however there's been so much
-// added to them that you have to use an iovec to access most functionality.
-// As such, there's not much corresponding documentation -- the best thing is
-// jail(8) which provides the name and description of most iovec keys.
-//
-// Jail exposes some of the jail functionality, but not all (since there's a lot
-// of it, and most of it is off the beaten path). One big difference is that
-// all functionality is for persistent jails -- transient jails (e.g., a jail
-// that exists until the spawned process terminates) are not supported. This is
-// because that's the direction the jails have been moving the past several years.
-type Jail struct {
-	jid    int
-	parent int
-	name   string
 
-	hostname string
-
-	path     string
-	cpusetId int
-
-	addrs []net.IP
-}
+	"github.com/lye/freebsd/cpuset"
+)
 
 // NewJail allocates a new persistent jail with the specified name/path. Name
 // should be a unique identifier on this system for the jail; if empty, it will
@@ -46,28 +31,53 @@ type Jail struct {
 //
 // Nil will not be returned without error.
 func NewJail(name string, path string) (*Jail, error) {
+	return CreateJail(&JailSpec{Name: name, Path: path})
+}
+
+// CreateJail allocates a new jail as described by spec. All of the spec's
+// parameters are set atomically as the jail is created, so there's no window
+// in which the jail is running with weaker restrictions than requested.
+//
+// Nil will not be returned without error.
+func CreateJail(spec *JailSpec) (*Jail, error) {
+	if er := spec.validateVnet(); er != nil {
+		return nil, er
+	}
+
+	if er := spec.validateSecurity(); er != nil {
+		return nil, er
+	}
+
 	jpps := jailParamList{}
 	defer jpps.release()
 
-	params := map[string]interface{}{
-		"name":          name,
-		"host.hostname": name,
-		"path":          path,
-		"persist":       true,
+	if er := jpps.bindParameters(spec.params()); er != nil {
+		return nil, er
 	}
 
-	jpps.bindParameters(params)
+	mounted, er := mountPlan(&spec.Mounts, spec.Path)
+	if er != nil {
+		return nil, er
+	}
 
-	jid, er := C.jailparam_set(&jpps.params[0], jpps.numParams(), C.JAIL_CREATE)
+	jid, er := jpps.set(jailCreate)
 	if er != nil {
+		unwindMounts(mounted, unmountTarget)
 		return nil, er
 	}
 
 	jail := &Jail{
-		jid: int(jid),
+		jid:    jid,
+		mounts: mounted,
 	}
 
 	if er := jail.Refresh(); er != nil {
+		jail.Destroy()
+		return nil, er
+	}
+
+	if er := jail.plumbEpairs(spec.Epairs); er != nil {
+		jail.Destroy()
 		return nil, er
 	}
 
@@ -80,39 +90,97 @@ func NewJail(name string, path string) (*Jail, error) {
 // data will not be reflected on the returned objects. Calling Refresh will sync
 // the Jail instances with the current values.
 func EnumerateJails() (jails []Jail, er error) {
+	return enumerateJails(0)
+}
+
+// LookupByJid returns the jail with the given jail ID. If there isn't one,
+// the error matches ErrJailNotFound with errors.Is.
+func LookupByJid(jid int) (*Jail, error) {
+	jail := &Jail{
+		jid: jid,
+	}
+
+	if er := jail.Refresh(); er != nil {
+		return nil, er
+	}
+
+	return jail, nil
+}
+
+// LookupByName returns the jail with the given name, which for child jails
+// is the full hierarchical name. If there isn't one, the error matches
+// ErrJailNotFound with errors.Is.
+func LookupByName(name string) (*Jail, error) {
 	jpps := jailParamList{}
 	defer jpps.release()
 
-	var lastjid C.int = 0
+	if er := jpps.bindParameter("name", &name); er != nil {
+		return nil, er
+	}
 
-	if er := jpps.bindParameter("lastjid", &lastjid); er != nil {
+	jid, er := jpps.get(0)
+	if er != nil {
 		return nil, er
 	}
 
-	for lastjid >= 0 {
-		lastjid, er = C.jailparam_get(&jpps.params[0], jpps.numParams(), 0)
+	return LookupByJid(jid)
+}
 
-		if er == nil {
-			jails = append(jails, Jail{jid: int(lastjid)})
+// enumerateJails lists jails as EnumerateJails does; with JAIL_DYING in
+// flags, jails that are in the process of being removed are included.
+func enumerateJails(flags int) (jails []Jail, er error) {
+	for lastjid := 0; ; {
+		jid, er := nextJid(lastjid, flags)
 
-		} else if er != syscall.ENOENT {
+		if errors.Is(er, ErrJailNotFound) {
+			break
+
+		} else if er != nil {
 			return nil, er
 		}
+
+		jails = append(jails, Jail{jid: jid})
+		lastjid = jid
 	}
 
+	refreshed := jails[:0]
+
 	for i := range jails {
-		if er := jails[i].Refresh(); er != nil {
+		/* Jails can go away while we're looking at them. */
+		if er := jails[i].refresh(flags); errors.Is(er, ErrJailNotFound) {
+			continue
+
+		} else if er != nil {
 			return nil, er
 		}
+
+		refreshed = append(refreshed, jails[i])
 	}
 
-	return jails, nil
+	return refreshed, nil
+}
+
+// nextJid returns the JID of the jail after lastjid, in the kernel's order;
+// when there are no more, the error matches ErrJailNotFound.
+func nextJid(lastjid, flags int) (int, error) {
+	jpps := jailParamList{}
+	defer jpps.release()
+
+	if er := jpps.bindParameter("lastjid", lastjid); er != nil {
+		return 0, er
+	}
+
+	return jpps.get(flags)
 }
 
 // Refresh synchronizes the cached values for the Jail fields with the actual
 // current state by querying the OS. In general, you probably shouldn't be
 // touching other people's jails, so they shouldn't be changing under you.
 func (j *Jail) Refresh() error {
+	return j.refresh(0)
+}
+
+func (j *Jail) refresh(flags int) error {
 	jpps := jailParamList{}
 	defer jpps.release()
 
@@ -120,15 +188,29 @@ func (j *Jail) Refresh() error {
 		return er
 	}
 
-	if er := jpps.bindOutputs("parent", "name", "host.hostname", "path", "cpuset.id", "ip4.addr"); er != nil {
+	if er := jpps.bindOutputs("parent", "name", "host.hostname", "path", "cpuset.id", "dying"); er != nil {
+		return er
+	}
+
+	/* Either address family may have been left out of the kernel. */
+	hasIp4, er := jpps.bindOptionalOutput("ip4.addr")
+	if er != nil {
 		return er
 	}
 
-	_, er := C.jailparam_get(&jpps.params[0], jpps.numParams(), 0)
+	hasIp6, er := jpps.bindOptionalOutput("ip6.addr")
 	if er != nil {
 		return er
 	}
 
+	if _, er := jpps.get(flags); er != nil {
+		return er
+	}
+
+	if er := jpps.grabOutput("parent", &j.parent); er != nil {
+		return er
+	}
+
 	if er := jpps.grabOutput("name", &j.name); er != nil {
 		return er
 	}
@@ -141,13 +223,153 @@ func (j *Jail) Refresh() error {
 		return er
 	}
 
-	if er := jpps.grabOutput("ip4.addr", &j.addrs); er != nil {
+	if er := jpps.grabOutput("cpuset.id", &j.cpusetId); er != nil {
 		return er
 	}
 
+	if er := jpps.grabOutput("dying", &j.dying); er != nil {
+		return er
+	}
+
+	addrs := []net.IP{}
+
+	for _, family := range []struct {
+		name  string
+		bound bool
+	}{{"ip4.addr", hasIp4}, {"ip6.addr", hasIp6}} {
+		if !family.bound {
+			continue
+		}
+
+		var familyAddrs []net.IP
+		if er := jpps.grabOutput(family.name, &familyAddrs); er != nil {
+			return er
+		}
+
+		addrs = append(addrs, familyAddrs...)
+	}
+
+	j.addrs = addrs
+
 	return nil
 }
 
+// Get reads the current value of the named jail parameter (as listed in
+// jail(8)) into out, which must be a pointer to the Go type used for the
+// parameter: int, string, bool, JailSys or []net.IP.
+func (j *Jail) Get(name string, out interface{}) error {
+	if reflect.ValueOf(out).Kind() != reflect.Ptr {
+		return fmt.Errorf("Output for parameter `%s' must be a pointer", name)
+	}
+
+	jpps := jailParamList{}
+	defer jpps.release()
+
+	if er := jpps.bindParameter("jid", &j.jid); er != nil {
+		return er
+	}
+
+	if er := jpps.bindOutput(name); er != nil {
+		return er
+	}
+
+	if _, er := jpps.get(0); er != nil {
+		return er
+	}
+
+	return jpps.grabOutput(name, out)
+}
+
+// GetParams reads the named jail parameters in a single call, so they're
+// consistent with each other, and returns them keyed by name with the Go
+// types Get uses. With no names, every parameter in ParamNames that the
+// kernel has is read.
+func (j *Jail) GetParams(names ...string) (map[string]interface{}, error) {
+	if len(names) == 0 {
+		return j.getParams(ParamNames(), true)
+	}
+
+	return j.getParams(names, false)
+}
+
+// getParams is GetParams; with optional set, parameters the kernel doesn't
+// have are left out rather than failing the call.
+func (j *Jail) getParams(names []string, optional bool) (map[string]interface{}, error) {
+	jpps := jailParamList{}
+	defer jpps.release()
+
+	if er := jpps.bindParameter("jid", &j.jid); er != nil {
+		return nil, er
+	}
+
+	params := map[string]interface{}{}
+	bound := []string{}
+
+	for _, name := range names {
+		/* The jid is already bound as the key. */
+		if name == "jid" {
+			params[name] = j.jid
+			continue
+		}
+
+		if jailParamType(name) == nil {
+			return nil, fmt.Errorf("Invalid parameter `%s'", name)
+		}
+
+		if !optional {
+			if er := jpps.bindOutput(name); er != nil {
+				return nil, er
+			}
+
+		} else if ok, er := jpps.bindOptionalOutput(name); er != nil {
+			return nil, er
+
+		} else if !ok {
+			continue
+		}
+
+		bound = append(bound, name)
+	}
+
+	if _, er := jpps.get(0); er != nil {
+		return nil, er
+	}
+
+	for _, name := range bound {
+		out := reflect.New(jailParamType(name))
+
+		if er := jpps.grabOutput(name, out.Interface()); er != nil {
+			return nil, er
+		}
+
+		params[name] = out.Elem().Interface()
+	}
+
+	return params, nil
+}
+
+// Set updates any number of jail parameters in a single call, keyed by their
+// jail(8) names. Either all of the parameters are changed or none are. The
+// cached values returned by the other accessors are refreshed afterwards.
+func (j *Jail) Set(params map[string]interface{}) error {
+	jpps := jailParamList{}
+	defer jpps.release()
+
+	if er := jpps.bindParameter("jid", &j.jid); er != nil {
+		return er
+	}
+
+	if er := jpps.bindParameters(params); er != nil {
+		return er
+	}
+
+	if _, er := jpps.set(jailUpdate); er != nil {
+		return er
+	}
+
+	return j.Refresh()
+}
+
 // Jid returns the OS-assigned jail ID for this Jail. This ID is not stable, but
 // is generally monotonically incrementing.
 func (j *Jail) Jid() int {
@@ -160,11 +382,72 @@ func (j *Jail) Parent() int {
 	return j.parent
 }
 
-// Name returns the unique identifier used to create the Jail.
+// Name returns the unique identifier used to create the Jail. For child
+// jails this is the full hierarchical name, e.g. "www.db" for the jail "db"
+// inside "www".
 func (j *Jail) Name() string {
 	return j.name
 }
 
+// ShortName returns the Jail's name relative to its parent, i.e. the last
+// component of its hierarchical name.
+func (j *Jail) ShortName() string {
+	_, child := splitJailName(j.name)
+	return child
+}
+
+// CreateChild creates a new jail nested inside this one, as described by
+// spec. The spec's Name is relative to this jail and is required; its Path
+// is relative to this jail's root. This jail's children.max must leave room
+// for the child.
+//
+// The kernel creates the child as if from inside this jail, so the calling
+// process doesn't need to attach to it.
+func (j *Jail) CreateChild(spec *JailSpec) (*Jail, error) {
+	if spec.Name == "" || strings.Contains(spec.Name, jailNameSeparator) {
+		return nil, fmt.Errorf("Invalid child jail name `%s'", spec.Name)
+	}
+
+	child := *spec
+	child.Name = j.name + jailNameSeparator + spec.Name
+	child.Path = filepath.Join(j.path, spec.Path)
+
+	/* The hostname is the child's own business; don't let it pick up the
+	 * hierarchical name. */
+	if child.HostName == "" {
+		child.HostName = spec.Name
+	}
+
+	return CreateJail(&child)
+}
+
+// Children returns the jails directly inside this one.
+func (j *Jail) Children() ([]Jail, error) {
+	jails, er := EnumerateJails()
+	if er != nil {
+		return nil, er
+	}
+
+	return jailTree(jails)[j.jid], nil
+}
+
+// EnumerateJailTree returns all jails on the system (as EnumerateJails does)
+// grouped by the JID of their parent. Top-level jails are listed under 0.
+func EnumerateJailTree() (map[int][]Jail, error) {
+	jails, er := EnumerateJails()
+	if er != nil {
+		return nil, er
+	}
+
+	return jailTree(jails), nil
+}
+
+// Dying returns true if the jail was in the process of being removed as of
+// the last Refresh. Dying jails only show up through Watch.
+func (j *Jail) Dying() bool {
+	return j.dying
+}
+
 // Hostname returns the current hostname of the Jail. When first created, the
 // hostname is the same as the Jail name.
 func (j *Jail) Hostname() string {
@@ -185,7 +468,7 @@ func (j *Jail) SetHostname(hostname string) error {
 		return er
 	}
 
-	if _, er := C.jailparam_set(&jpps.params[0], jpps.numParams(), C.JAIL_UPDATE); er != nil {
+	if _, er := jpps.set(jailUpdate); er != nil {
 		return er
 	}
 
@@ -194,46 +477,90 @@ func (j *Jail) SetHostname(hostname string) error {
 	return nil
 }
 
+// SecureLevel returns the jail's current securelevel. The level in effect is
+// the higher of this and the host's kern.securelevel.
+func (j *Jail) SecureLevel() (int, error) {
+	var level int
+
+	if er := j.Get("securelevel", &level); er != nil {
+		return 0, er
+	}
+
+	return level, nil
+}
+
+// SetSecureLevel raises the jail's securelevel. Lowering it is refused, even
+// though the host could, since a jail is meant to stay at least as locked
+// down as it was started.
+func (j *Jail) SetSecureLevel(level int) error {
+	current, er := j.SecureLevel()
+	if er != nil {
+		return er
+	}
+
+	if er := checkSecureLevelRaise(current, level); er != nil {
+		return er
+	}
+
+	return j.Set(map[string]interface{}{"securelevel": level})
+}
+
+// EnforceStatfs returns the jail's current enforce_statfs setting.
+func (j *Jail) EnforceStatfs() (EnforceStatfs, error) {
+	var es EnforceStatfs
+
+	if er := j.Get("enforce_statfs", &es); er != nil {
+		return 0, er
+	}
+
+	return es, nil
+}
+
+// SetEnforceStatfs changes which mount points are visible inside the jail.
+func (j *Jail) SetEnforceStatfs(es EnforceStatfs) error {
+	if er := checkEnforceStatfs(es); er != nil {
+		return er
+	}
+
+	return j.Set(map[string]interface{}{"enforce_statfs": es})
+}
+
 // Path returns the path specified when the jail was created. 
 func (j *Jail) Path() string {
 	return j.path
 }
 
-// CpusetId returns the cpuset id assigned to this jail, if any.
-//
-// XXX: Should have a separate package that exposes this functionality.
+// CpusetId returns the ID of the jail's cpuset. Every jail gets a set of its
+// own when it's created, which its processes are confined to.
 func (j *Jail) CpusetId() int {
 	return j.cpusetId
 }
 
-// SetCpusetId assigns a cpuset id to the jail. 
-//
-// XXX: Need cpuset functionality.
+// SetCpusetId restricts the jail to the CPUs of the cpuset id. The kernel
+// doesn't allow a jail to be moved to another set, so it's the CPU mask that
+// is copied to the jail's own set; CpusetId doesn't change.
 func (j *Jail) SetCpusetId(id int) error {
-	jpps := jailParamList{}
-	defer jpps.release()
-
-	params := map[string]interface{}{
-		"jid":       &j.jid,
-		"cpuset.id": id,
-	}
-
-	if er := jpps.bindParameters(params); er != nil {
+	mask, er := cpuset.GetAffinity(cpuset.LevelCpuset, cpuset.WhichCpuset, id)
+	if er != nil {
 		return er
 	}
 
-	if _, er := C.jailparam_set(&jpps.params[0], jpps.numParams(), C.JAIL_UPDATE); er != nil {
-		return er
-	}
+	return cpuset.SetAffinity(cpuset.LevelWhich, cpuset.WhichJail, j.jid, mask)
+}
 
-	j.cpusetId = id
+// PinToCPUs restricts the jail's processes to the given CPUs, like `cpuset
+// -l cpus -j jid`.
+func (j *Jail) PinToCPUs(cpus []int) error {
+	return cpuset.SetAffinity(cpuset.LevelWhich, cpuset.WhichJail, j.jid, cpuset.NewCPUMask(cpus...))
+}
 
-	return nil
+// CPUs returns the CPUs the jail's processes may run on.
+func (j *Jail) CPUs() (cpuset.CPUMask, error) {
+	return cpuset.GetAffinity(cpuset.LevelWhich, cpuset.WhichJail, j.jid)
 }
 
-// IpAddrs returns the IP addresses assigned to this jail.
-//
-// XXX: Currently only returns IPv4 addresses, due to how Refresh works.
+// IpAddrs returns the IP addresses assigned to this jail, IPv4 addresses
+// first and then IPv6.
 func (j *Jail) IpAddrs() []net.IP {
 	return j.addrs
 }
@@ -257,55 +584,93 @@ func (j *Jail) SetIpAddrs(addrs []net.IP) error {
 		}
 	}
 
-	params := map[string]interface{}{
-		"jid":      &j.jid,
-		"ip4.addr": ip4addrs,
-		"ip6.addr": ip6addrs,
+	if er := jpps.bindParameter("jid", &j.jid); er != nil {
+		return er
 	}
 
-	if er := jpps.bindParameters(params); er != nil {
-		return er
+	for _, family := range []struct {
+		name  string
+		addrs []net.IP
+	}{{"ip4.addr", ip4addrs}, {"ip6.addr", ip6addrs}} {
+		/* A kernel without the address family has nothing to clear. */
+		if er := jpps.bindParameter(family.name, family.addrs); er == syscall.ENOENT && len(family.addrs) == 0 {
+			continue
+
+		} else if er != nil {
+			return er
+		}
 	}
 
-	if _, er := C.jailparam_set(&jpps.params[0], jpps.numParams(), C.JAIL_UPDATE); er != nil {
+	if _, er := jpps.set(jailUpdate); er != nil {
 		return er
 	}
 
-	j.addrs = addrs
+	j.addrs = append(ip4addrs, ip6addrs...)
 
 	return nil
 }
 
-// Exec wraps a command with `jexec` such that it can be spawned within the
-// receiving jail. Since much of the Command functionality is exposed via
-// settable fields before starting the command (e.g., env, stdin/out, etc)
-// starting the command is left to the caller. Note that by default, the
-// command is started with uid/gid=0 (though jailed), and must setuid away 
-// the privledges.
+// Exec prepares a command to be spawned within the receiving jail. Since much
+// of the Command functionality is exposed via settable fields before starting
+// the command (e.g., env, stdin/out, etc) starting the command is left to the
+// caller. Note that by default, the command is started with uid/gid=0 (though
+// jailed), and must setuid away the privledges; use Command to start it as
+// another user instead.
 func (j *Jail) Exec(cmd string, args ...string) *exec.Cmd {
-	/* This is kind of a hack, but implementing this in Go is a non-trivial amount of code;
-	 * basically, we need to fork+jail_attach+execvp, but forking has ... strange implications.
-	 * Instead, we rely on another binary to leverage Go's built-in Exec stuff. */
-	newArgs := make([]string, len(args)+2)
-	newArgs[0] = strconv.FormatInt(int64(j.jid), 10)
-	newArgs[1] = cmd
-	copy(newArgs[2:], args)
-
-	return exec.Command("jexec", newArgs...)
+	return j.Command(ExecOptions{}, cmd, args...)
 }
 
 // Attach locks the current process in the specified jail.
 func (j *Jail) Attach() error {
-	_, er := C.jail_attach(C.int(j.jid))
-	return er
+	if _, er := C.jail_attach(C.int(j.jid)); er != nil {
+		return newJailError("jail_attach", er, "")
+	}
+
+	return nil
 }
 
 // Destroy shuts down the jail. This is very harsh -- it is equivalent to a 
 // `killall -9 *` in the jail, and could result in bad things happening if
-// there are things that aren't yet shut down cleanly.
+// there are things that aren't yet shut down cleanly. Stop is the nicer
+// version.
 //
-// XXX: Make a nicer version that sends SIGTERM, waits, then SIGKILL.
+// Any epairs plumbed into the jail by CreateJail are reclaimed from it and
+// destroyed, and the filesystems it mounted are unmounted.
 func (j *Jail) Destroy() error {
-	_, er := C.jail_remove(C.int(j.jid))
+	j.reclaimEpairs()
+
+	if er := j.remove(); er != nil {
+		return er
+	}
+
+	return j.releaseResources()
+}
+
+func (j *Jail) remove() error {
+	if _, er := C.jail_remove(C.int(j.jid)); er != nil {
+		return newJailError("jail_remove", er, "")
+	}
+
+	return nil
+}
+
+// releaseResources tears down what CreateJail set up alongside the jail.
+func (j *Jail) releaseResources() error {
+	er := j.unplumbEpairs()
+
+	if mer := j.unmountAll(); er == nil {
+		er = mer
+	}
+
 	return er
 }
+
+// Stop shuts down the jail gracefully, the way jail(8) does: it runs the
+// optional exec.stop command, sends SIGTERM to every process in the jail
+// (and in the jails nested inside it) and waits for them to exit, sending
+// SIGKILL to whatever is left once the timeout expires (or ctx is done). The
+// jail is then removed. The returned StopStage says which step emptied the
+// jail.
+func (j *Jail) Stop(ctx context.Context, opts StopOptions) (StopStage, error) {
+	return stopJail(ctx, hostProcs{jail: j}, opts)
+}
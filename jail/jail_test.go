@@ -1,9 +1,20 @@
+//go:build freebsd
+
 package jail
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/lye/freebsd/fs"
+	"github.com/lye/freebsd/netif"
+	"github.com/lye/freebsd/rctl"
 )
 
 func init() {
@@ -45,3 +56,388 @@ func TestCreateJail(t *testing.T) {
 		t.Errorf("Jail JIDs don't match")
 	}
 }
+
+func TestGetSetParams(t *testing.T) {
+	newJail, er := NewJail("getset", "/tmp")
+	if er != nil {
+		t.Fatal(er)
+	}
+	defer newJail.Destroy()
+
+	er = newJail.Set(map[string]interface{}{
+		"host.domainname": "example.org",
+		"children.max":    2,
+	})
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	var domain string
+	if er := newJail.Get("host.domainname", &domain); er != nil {
+		t.Fatal(er)
+	}
+
+	if domain != "example.org" {
+		t.Errorf("host.domainname is `%s'", domain)
+	}
+
+	var childrenMax int
+	if er := newJail.Get("children.max", &childrenMax); er != nil {
+		t.Fatal(er)
+	}
+
+	if childrenMax != 2 {
+		t.Errorf("children.max is %d", childrenMax)
+	}
+
+	if er := newJail.Get("children.max", childrenMax); er == nil {
+		t.Errorf("Get should require a pointer")
+	}
+}
+
+func TestCreateChild(t *testing.T) {
+	parent, er := CreateJail(&JailSpec{Name: "parent", Path: "/", ChildrenMax: 1})
+	if er != nil {
+		t.Fatal(er)
+	}
+	defer parent.Destroy()
+
+	child, er := parent.CreateChild(&JailSpec{Name: "child", Path: "/tmp"})
+	if er != nil {
+		t.Fatal(er)
+	}
+	defer child.Destroy()
+
+	if child.Name() != "parent.child" || child.ShortName() != "child" {
+		t.Errorf("Unexpected child names `%s' and `%s'", child.Name(), child.ShortName())
+	}
+
+	if child.Parent() != parent.Jid() {
+		t.Errorf("Child's parent is %d, expected %d", child.Parent(), parent.Jid())
+	}
+
+	children, er := parent.Children()
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if len(children) != 1 || children[0].Jid() != child.Jid() {
+		t.Errorf("Child not listed under its parent")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	newJail, er := NewJail("lookup", "/tmp")
+	if er != nil {
+		t.Fatal(er)
+	}
+	defer newJail.Destroy()
+
+	byName, er := LookupByName("lookup")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if byName.Jid() != newJail.Jid() {
+		t.Errorf("Looked up JID %d, expected %d", byName.Jid(), newJail.Jid())
+	}
+
+	byJid, er := LookupByJid(newJail.Jid())
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if byJid.Name() != "lookup" {
+		t.Errorf("Looked up name `%s', expected `lookup'", byJid.Name())
+	}
+
+	if _, er := LookupByName("no-such-jail"); !errors.Is(er, ErrJailNotFound) {
+		t.Errorf("Expected ErrJailNotFound, got %v", er)
+	}
+}
+
+func TestVnetJail(t *testing.T) {
+	hostAddr, _ := netif.ParseInterfaceAddr("192.0.2.1/24")
+	jailAddr, _ := netif.ParseInterfaceAddr("192.0.2.2/24")
+
+	newJail, er := CreateJail(&JailSpec{
+		Name: "vnet",
+		Path: "/",
+		Vnet: JailSysNew,
+		Epairs: []VnetEpair{{
+			HostAddrs: []netif.InterfaceAddr{hostAddr},
+			JailAddrs: []netif.InterfaceAddr{jailAddr},
+		}},
+	})
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	epairs := newJail.Epairs()
+	if len(epairs) != 1 {
+		newJail.Destroy()
+		t.Fatalf("Expected one epair, got %v", epairs)
+	}
+
+	out, er := newJail.Exec("/sbin/ifconfig", epairs[0].Jail).CombinedOutput()
+	if er != nil {
+		t.Error(er)
+
+	} else if !strings.Contains(string(out), "192.0.2.2") {
+		t.Errorf("Jailed end not configured:\n%s", out)
+	}
+
+	if er := newJail.Destroy(); er != nil {
+		t.Fatal(er)
+	}
+
+	if er := netif.DestroyInterface(epairs[0].Host); er == nil {
+		t.Errorf("Epair %s should have been destroyed with the jail", epairs[0].Host)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	newJail, er := NewJail("limits", "/tmp")
+	if er != nil {
+		t.Fatal(er)
+	}
+	defer newJail.Destroy()
+
+	if er := newJail.SetLimit(rctl.ResourceMaxProc, rctl.ActionDeny, 10); er == rctl.ErrNotEnabled {
+		t.Skip(er)
+
+	} else if er != nil {
+		t.Fatal(er)
+	}
+	defer newJail.ClearLimit("")
+
+	rules, er := newJail.Limits()
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if len(rules) != 1 || rules[0].Resource != rctl.ResourceMaxProc || rules[0].Amount != 10 {
+		t.Errorf("Unexpected rules %v", rules)
+	}
+
+	usage, er := newJail.Usage()
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if _, ok := usage[rctl.ResourceMaxProc]; !ok {
+		t.Errorf("No maxproc usage in %v", usage)
+	}
+}
+
+func TestPinToCPUs(t *testing.T) {
+	newJail, er := NewJail("pinned", "/tmp")
+	if er != nil {
+		t.Fatal(er)
+	}
+	defer newJail.Destroy()
+
+	if newJail.CpusetId() == 0 {
+		t.Errorf("Jail has no cpuset")
+	}
+
+	if er := newJail.PinToCPUs([]int{0}); er != nil {
+		t.Fatal(er)
+	}
+
+	cpus, er := newJail.CPUs()
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if cpus.String() != "0" {
+		t.Errorf("Jail pinned to CPUs %s, expected 0", cpus)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	newJail, er := CreateJail(&JailSpec{Name: "snapped", Path: "/tmp", AllowSysvIpc: true})
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	snap, er := newJail.Snapshot()
+	newJail.Destroy()
+
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	data, er := json.Marshal(snap)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	decoded := &Snapshot{}
+	if er := json.Unmarshal(data, decoded); er != nil {
+		t.Fatal(er)
+	}
+
+	restored, er := RestoreSnapshot(decoded)
+	if er != nil {
+		t.Fatal(er)
+	}
+	defer restored.Destroy()
+
+	var sysvipc bool
+	if er := restored.Get("allow.sysvipc", &sysvipc); er != nil {
+		t.Fatal(er)
+	}
+
+	if restored.Name() != "snapped" || restored.Path() != "/tmp" || !sysvipc {
+		t.Errorf("Restored jail doesn't match: %s at %s (sysvipc: %v)", restored.Name(), restored.Path(), sysvipc)
+	}
+}
+
+func TestMountPlan(t *testing.T) {
+	root := t.TempDir()
+
+	if er := os.Mkdir(filepath.Join(root, "dev"), 0755); er != nil {
+		t.Fatal(er)
+	}
+
+	if er := os.Mkdir(filepath.Join(root, "tmp"), 0755); er != nil {
+		t.Fatal(er)
+	}
+
+	newJail, er := CreateJail(&JailSpec{
+		Name: "mounted",
+		Path: root,
+		Mounts: MountPlan{
+			Entries: []MountEntry{{Source: "tmpfs", Target: "/tmp", FsType: "tmpfs"}},
+			Devfs:   true,
+		},
+	})
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if _, er := os.Stat(filepath.Join(root, "dev", "null")); er != nil {
+		t.Errorf("devfs not mounted: %s", er)
+	}
+
+	if er := newJail.Destroy(); er != nil {
+		t.Fatal(er)
+	}
+
+	if _, er := os.Stat(filepath.Join(root, "dev", "null")); er == nil {
+		t.Errorf("devfs still mounted after Destroy")
+	}
+
+	/* A mount that fails takes the ones before it down with it. */
+	_, er = CreateJail(&JailSpec{
+		Name: "unmounted",
+		Path: root,
+		Mounts: MountPlan{
+			Entries: []MountEntry{
+				{Source: "tmpfs", Target: "/tmp", FsType: "tmpfs"},
+				{Source: "tmpfs", Target: "/missing", FsType: "tmpfs"},
+			},
+		},
+	})
+	if er == nil {
+		t.Fatal("Expected the mount on a missing directory to fail")
+	}
+
+	if mi, er := fs.MountInfoForPath(filepath.Join(root, "tmp")); er == nil && mi.FsTypeName() == "tmpfs" {
+		t.Errorf("tmpfs left mounted after a failed plan")
+	}
+}
+
+func TestRunInNewJail(t *testing.T) {
+	status, er := RunInNewJail(context.Background(), &JailSpec{Name: "transient", Path: "/"}, ExecOptions{}, "/bin/sh", "-c", "exit 3")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if status != 3 {
+		t.Errorf("Exited with %d, expected 3", status)
+	}
+
+	if _, er := LookupByName("transient"); !errors.Is(er, ErrJailNotFound) {
+		t.Errorf("Transient jail outlived its command: %v", er)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tj := NewTransientJail(&JailSpec{Name: "cancelled", Path: "/"}, ExecOptions{}, "/bin/sleep", "60")
+
+	if er := tj.Start(ctx); er != nil {
+		t.Fatal(er)
+	}
+
+	if _, er := LookupByJid(tj.Jid()); er != nil {
+		t.Errorf("Transient jail not running: %s", er)
+	}
+
+	cancel()
+
+	if _, er := tj.Wait(); er != context.Canceled {
+		t.Errorf("Expected the jail to be cancelled, got %v", er)
+	}
+
+	if _, er := LookupByJid(tj.Jid()); !errors.Is(er, ErrJailNotFound) {
+		t.Errorf("Cancelled jail still running: %v", er)
+	}
+}
+
+func TestProcesses(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tj := NewTransientJail(&JailSpec{Name: "processes", Path: "/"}, ExecOptions{}, "/bin/sleep", "60")
+
+	if er := tj.Start(ctx); er != nil {
+		t.Fatal(er)
+	}
+
+	procs, er := tj.Jail().Processes()
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if len(procs) != 1 {
+		t.Fatalf("Expected one process in the jail, got %+v", procs)
+	}
+
+	if procs[0].Pid != tj.Cmd.Process.Pid || procs[0].Command != "sleep" || procs[0].RSS == 0 {
+		t.Errorf("Unexpected process %+v", procs[0])
+	}
+
+	cancel()
+	tj.Wait()
+}
+
+func TestSecurity(t *testing.T) {
+	es := EnforceStatfsBelowRoot
+
+	jail, er := CreateJail(&JailSpec{Name: "hardened", Path: "/", EnforceStatfs: &es})
+	if er != nil {
+		t.Fatal(er)
+	}
+	defer jail.Destroy()
+
+	if got, er := jail.EnforceStatfs(); er != nil || got != EnforceStatfsBelowRoot {
+		t.Errorf("enforce_statfs is %v, %v", got, er)
+	}
+
+	if er := jail.SetEnforceStatfs(EnforceStatfsRoot); er != nil {
+		t.Error(er)
+	}
+
+	if er := jail.SetSecureLevel(2); er != nil {
+		t.Fatal(er)
+	}
+
+	if level, er := jail.SecureLevel(); er != nil || level != 2 {
+		t.Errorf("securelevel is %d, %v", level, er)
+	}
+
+	if er := jail.SetSecureLevel(1); er == nil {
+		t.Error("Lowered the securelevel")
+	}
+}
@@ -0,0 +1,126 @@
+package jail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+)
+
+// Process describes a process running in a jail.
+type Process struct {
+	Pid  int
+	Ppid int
+
+	// Uid is the effective user ID, as seen from the host.
+	Uid int
+
+	// Command is the process's name (at most 19 characters), not its full
+	// command line.
+	Command string
+
+	// RSS is the resident set size in bytes.
+	RSS uint64
+}
+
+// kinfoProcLayout locates the fields of a struct kinfo_proc that Processes
+// needs. On FreeBSD it's taken from the C headers; kinfoProcAmd64 is the
+// amd64 layout from <sys/user.h>, which the decoder's tests use.
+type kinfoProcLayout struct {
+	order binary.ByteOrder
+	size  int
+
+	pid, ppid, uid, jid int
+	rssize, rssizeLen   int
+	comm, commLen       int
+}
+
+var kinfoProcAmd64 = kinfoProcLayout{
+	order:     binary.LittleEndian,
+	size:      1088,
+	pid:       72,
+	ppid:      76,
+	uid:       168,
+	jid:       592,
+	rssize:    264,
+	rssizeLen: 8,
+	comm:      447,
+	commLen:   20,
+}
+
+// jailedProcess is a Process along with the JID it's in.
+type jailedProcess struct {
+	Process
+	jid int
+}
+
+// decodeKinfoProcs decodes the array of struct kinfo_proc returned by the
+// kern.proc sysctls. RSS is reported by the kernel in pages.
+func decodeKinfoProcs(buf []byte, layout *kinfoProcLayout, pageSize uint64) ([]jailedProcess, error) {
+	if len(buf)%layout.size != 0 {
+		return nil, fmt.Errorf("kinfo_proc buffer of %d bytes isn't a multiple of %d", len(buf), layout.size)
+	}
+
+	procs := []jailedProcess{}
+
+	for off := 0; off < len(buf); off += layout.size {
+		rec := buf[off : off+layout.size]
+		i32 := func(at int) int {
+			return int(int32(layout.order.Uint32(rec[at:])))
+		}
+
+		/* ki_structsize comes first, and guards against a mismatched
+		 * layout. */
+		if size := i32(0); size != layout.size {
+			return nil, fmt.Errorf("kinfo_proc has size %d, expected %d", size, layout.size)
+		}
+
+		var rssize uint64
+		if layout.rssizeLen == 8 {
+			rssize = layout.order.Uint64(rec[layout.rssize:])
+
+		} else {
+			rssize = uint64(layout.order.Uint32(rec[layout.rssize:]))
+		}
+
+		comm := rec[layout.comm : layout.comm+layout.commLen]
+		if idx := bytes.IndexByte(comm, 0); idx >= 0 {
+			comm = comm[:idx]
+		}
+
+		procs = append(procs, jailedProcess{
+			Process: Process{
+				Pid:     i32(layout.pid),
+				Ppid:    i32(layout.ppid),
+				Uid:     int(layout.order.Uint32(rec[layout.uid:])),
+				Command: string(comm),
+				RSS:     rssize * pageSize,
+			},
+			jid: i32(layout.jid),
+		})
+	}
+
+	return procs, nil
+}
+
+// processesInJail picks out the processes in the jail jid.
+func processesInJail(procs []jailedProcess, jid int) []Process {
+	inJail := []Process{}
+
+	for _, proc := range procs {
+		if proc.jid == jid {
+			inJail = append(inJail, proc.Process)
+		}
+	}
+
+	return inJail
+}
+
+func nativeOrder() binary.ByteOrder {
+	one := uint16(1)
+	if *(*byte)(unsafe.Pointer(&one)) == 1 {
+		return binary.LittleEndian
+	}
+
+	return binary.BigEndian
+}
@@ -0,0 +1,66 @@
+package jail
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// testdata/kinfo_proc.amd64 is synthetic, not captured from a host: four
+// 1088-byte struct kinfo_proc records laid out by hand from the amd64
+// offsets in <sys/user.h>. Only ki_structsize, ki_layout, ki_pid, ki_ppid,
+// ki_pgid, ki_sid, ki_uid, ki_ruid, ki_size, ki_rssize, ki_tdname, ki_comm,
+// ki_jid, ki_numthreads and ki_tid are filled in; everything else is zero.
+func TestDecodeKinfoProcs(t *testing.T) {
+	buf, er := os.ReadFile("testdata/kinfo_proc.amd64")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	procs, er := decodeKinfoProcs(buf, &kinfoProcAmd64, 4096)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	expected := []jailedProcess{
+		{Process{Pid: 1, Ppid: 0, Uid: 0, Command: "init", RSS: 300 * 4096}, 0},
+		{Process{Pid: 4242, Ppid: 1, Uid: 0, Command: "sh", RSS: 512 * 4096}, 3},
+		{Process{Pid: 4250, Ppid: 4242, Uid: 80, Command: "nginx-worker-proc", RSS: 2048 * 4096}, 3},
+		{Process{Pid: 5000, Ppid: 1, Uid: 1001, Command: "sleep", RSS: 10 * 4096}, 7},
+	}
+
+	if !reflect.DeepEqual(procs, expected) {
+		t.Errorf("Decoded %+v", procs)
+	}
+
+	inJail := processesInJail(procs, 3)
+	if len(inJail) != 2 || inJail[0].Pid != 4242 || inJail[1].Pid != 4250 {
+		t.Errorf("Processes in jail 3: %+v", inJail)
+	}
+
+	if inJail := processesInJail(procs, 12); len(inJail) != 0 {
+		t.Errorf("Processes in jail 12: %+v", inJail)
+	}
+}
+
+func TestDecodeKinfoProcsInvalid(t *testing.T) {
+	buf, er := os.ReadFile("testdata/kinfo_proc.amd64")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if _, er := decodeKinfoProcs(buf[:len(buf)-1], &kinfoProcAmd64, 4096); er == nil {
+		t.Error("Truncated buffer decoded")
+	}
+
+	layout := kinfoProcAmd64
+	layout.size = 544
+
+	if _, er := decodeKinfoProcs(buf, &layout, 4096); er == nil {
+		t.Error("Buffer decoded with the wrong ki_structsize")
+	}
+
+	if procs, er := decodeKinfoProcs(nil, &kinfoProcAmd64, 4096); er != nil || len(procs) != 0 {
+		t.Errorf("Empty buffer decoded to %v, %v", procs, er)
+	}
+}
@@ -0,0 +1,182 @@
+//go:build freebsd
+
+package jail
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"syscall"
+)
+
+// procTracker uses kqueue to notice jailed processes exiting, which is
+// usually the first sign that a jail is going away, so the watcher can poll
+// right away instead of waiting out the interval. The loop owns the kqueue
+// and closes it when it stops, whether it's told to or kevent fails.
+type procTracker struct {
+	kq   int
+	wake chan struct{}
+
+	// failed receives the error that stopped the loop, if it wasn't
+	// stopped by close.
+	failed chan error
+
+	lock   sync.Mutex
+	closed bool
+}
+
+var errProcTrackerClosed = errors.New("jail: process tracker is closed")
+
+func newProcTracker() (*procTracker, error) {
+	kq, er := syscall.Kqueue()
+	if er != nil {
+		return nil, er
+	}
+
+	/* The user event is only used to tell the loop to stop. */
+	change := syscall.Kevent_t{}
+	syscall.SetKevent(&change, 0, syscall.EVFILT_USER, syscall.EV_ADD|syscall.EV_CLEAR)
+
+	if _, er := syscall.Kevent(kq, []syscall.Kevent_t{change}, nil, nil); er != nil {
+		syscall.Close(kq)
+		return nil, er
+	}
+
+	pt := &procTracker{kq: kq, wake: make(chan struct{}, 1), failed: make(chan error, 1)}
+	go pt.loop()
+
+	return pt, nil
+}
+
+// track registers for the exit of every process in the snapshot's jails.
+// Registering an already-registered process is harmless, and processes
+// that have already exited are skipped.
+func (pt *procTracker) track(jails map[int]Jail) error {
+	pids, er := allJailPids()
+	if er != nil {
+		return er
+	}
+
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+
+	if pt.closed {
+		return errProcTrackerClosed
+	}
+
+	for jid := range jails {
+		for _, pid := range pids[jid] {
+			change := syscall.Kevent_t{}
+			syscall.SetKevent(&change, pid, syscall.EVFILT_PROC, syscall.EV_ADD|syscall.EV_ONESHOT)
+			change.Fflags = syscall.NOTE_EXIT
+
+			if _, er := syscall.Kevent(pt.kq, []syscall.Kevent_t{change}, nil, nil); er != nil && er != syscall.ESRCH {
+				return er
+			}
+		}
+	}
+
+	return nil
+}
+
+func (pt *procTracker) loop() {
+	events := make([]syscall.Kevent_t, 64)
+
+	for {
+		n, er := syscall.Kevent(pt.kq, nil, events, nil)
+		if er == syscall.EINTR {
+			continue
+
+		} else if er != nil {
+			pt.release()
+			pt.failed <- er
+			return
+		}
+
+		for _, event := range events[:n] {
+			if event.Filter == syscall.EVFILT_USER {
+				pt.release()
+				return
+			}
+		}
+
+		select {
+		case pt.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// release closes the kqueue; once it has, track and close leave the
+// descriptor (which may have been reused by then) alone.
+func (pt *procTracker) release() {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+
+	pt.closed = true
+	syscall.Close(pt.kq)
+}
+
+func (pt *procTracker) close() {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+
+	if pt.closed {
+		return
+	}
+
+	change := syscall.Kevent_t{}
+	syscall.SetKevent(&change, 0, syscall.EVFILT_USER, 0)
+	change.Fflags = syscall.NOTE_TRIGGER
+
+	syscall.Kevent(pt.kq, []syscall.Kevent_t{change}, nil, nil)
+}
+
+func snapshotJails() (map[int]Jail, error) {
+	jails, er := enumerateJails(jailDying)
+	if er != nil {
+		return nil, er
+	}
+
+	snapshot := map[int]Jail{}
+	for _, jail := range jails {
+		snapshot[jail.jid] = jail
+	}
+
+	return snapshot, nil
+}
+
+// Watch reports jails appearing, changing, starting to die and finally
+// disappearing until ctx is done, at which point the returned channel is
+// closed. Jails that already exist are reported as created first.
+//
+// Changes are found by comparing successive snapshots of the system's jails,
+// taken every second. Where kqueue is available, the exit of any jailed
+// process triggers a snapshot straight away, so jails going away are
+// noticed promptly. Should tracking processes fail, a JailNotificationsLost
+// event is sent and the watcher carries on polling.
+func Watch(ctx context.Context) (<-chan JailEvent, error) {
+	w := &jailWatcher{snapshot: snapshotJails, interval: defaultWatchInterval}
+
+	pt, er := newProcTracker()
+	if er != nil {
+		return w.start(ctx)
+	}
+
+	w.track = pt.track
+	w.wake = pt.wake
+	w.failed = pt.failed
+
+	events, er := w.start(ctx)
+	if er != nil {
+		pt.close()
+		return nil, er
+	}
+
+	go func() {
+		<-ctx.Done()
+		pt.close()
+	}()
+
+	return events, nil
+}
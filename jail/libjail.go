@@ -0,0 +1,114 @@
+//go:build freebsd
+
+package jail
+
+/*
+#cgo LDFLAGS: -ljail
+#include <sys/param.h>
+#include <sys/jail.h>
+#include <jail.h>
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"unsafe"
+)
+
+// hostLibjail is the real libjail.
+type hostLibjail struct{}
+
+var jailLib libjail = hostLibjail{}
+
+/* The flags and jailsys values are copied out of <sys/jail.h> so the
+ * marshaling can be built without it; this fails to compile if they ever
+ * drift. */
+var _ = [1]struct{}{}[(jailCreate-C.JAIL_CREATE)|(jailUpdate-C.JAIL_UPDATE)|
+	(jailAttach-C.JAIL_ATTACH)|(jailDying-C.JAIL_DYING)|
+	(jailSysDisable-C.JAIL_SYS_DISABLE)|(jailSysNew-C.JAIL_SYS_NEW)|
+	(jailSysInherit-C.JAIL_SYS_INHERIT)]
+
+func initJailParam(jp *C.struct_jailparam, name string) error {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	if rv, er := C.jailparam_init(jp, cname); rv != 0 {
+		return er
+	}
+
+	return nil
+}
+
+func (hostLibjail) lookup(name string) (int, error) {
+	var jp C.struct_jailparam
+
+	if er := initJailParam(&jp, name); er != nil {
+		return 0, er
+	}
+	defer C.jailparam_free(&jp, 1)
+
+	return int(jp.jp_valuelen), nil
+}
+
+func (lib hostLibjail) set(params []*jailParam, flags int) (int, error) {
+	return lib.call(params, flags, false)
+}
+
+func (lib hostLibjail) get(params []*jailParam, flags int) (int, error) {
+	return lib.call(params, flags, true)
+}
+
+func (hostLibjail) call(params []*jailParam, flags int, get bool) (int, error) {
+	/* The array lives in Go memory, but only ever points at C memory:
+	 * names from jailparam_init, and values from the arena or libjail. */
+	jps := make([]C.struct_jailparam, 0, len(params))
+
+	defer func() {
+		if len(jps) > 0 {
+			C.jailparam_free(&jps[0], C.uint(len(jps)))
+		}
+	}()
+
+	for _, param := range params {
+		var jp C.struct_jailparam
+
+		if er := initJailParam(&jp, param.name); er != nil {
+			return 0, er
+		}
+
+		if param.input {
+			jp.jp_value = param.value
+			jp.jp_valuelen = C.size_t(param.valueLen)
+			jp.jp_flags |= C.JP_RAWVALUE
+		}
+
+		jps = append(jps, jp)
+	}
+
+	var jid C.int
+	var er error
+
+	if get {
+		jid, er = C.jailparam_get(&jps[0], C.uint(len(jps)), C.int(flags))
+
+	} else {
+		jid, er = C.jailparam_set(&jps[0], C.uint(len(jps)), C.int(flags))
+	}
+
+	if jid < 0 {
+		return 0, er
+	}
+
+	if get {
+		for i, param := range params {
+			if !param.input {
+				param.out = arenaBytes(jps[i].jp_value, int(jps[i].jp_valuelen))
+			}
+		}
+	}
+
+	return int(jid), nil
+}
+
+func (hostLibjail) errmsg() string {
+	return C.GoString(&C.jail_errmsg[0])
+}
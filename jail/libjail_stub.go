@@ -0,0 +1,7 @@
+//go:build !freebsd
+
+package jail
+
+// There's no libjail here, so a jailParamList only works with the backend
+// the tests give it.
+var jailLib libjail
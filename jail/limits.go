@@ -0,0 +1,43 @@
+//go:build freebsd
+
+package jail
+
+import (
+	"github.com/lye/freebsd/rctl"
+)
+
+func (j *Jail) rctlRule(resource rctl.Resource, action rctl.Action, amount uint64) rctl.Rule {
+	return rctl.Rule{
+		Subject:   rctl.SubjectJail,
+		SubjectId: j.name,
+		Resource:  resource,
+		Action:    action,
+		Amount:    amount,
+	}
+}
+
+// SetLimit adds an rctl(8) rule limiting the jail's use of resource to
+// amount, taking action when it's exceeded (rctl.ActionDeny to refuse the
+// allocation, rctl.ActionThrottle for rate limits and so on). Setting the
+// same resource and action again replaces the previous amount.
+func (j *Jail) SetLimit(resource rctl.Resource, action rctl.Action, amount uint64) error {
+	return rctl.AddRule(j.rctlRule(resource, action, amount))
+}
+
+// ClearLimit removes the jail's rules on resource. If resource is empty,
+// all of the jail's rules are removed.
+func (j *Jail) ClearLimit(resource rctl.Resource) error {
+	return rctl.RemoveRules(j.rctlRule(resource, "", 0))
+}
+
+// Limits returns the rctl rules that apply to the jail.
+func (j *Jail) Limits() ([]rctl.Rule, error) {
+	return rctl.Rules(j.rctlRule("", "", 0))
+}
+
+// Usage returns the jail's current resource usage, as accounted by
+// racct(9). Resource accounting must be enabled with the kern.racct.enable
+// tunable.
+func (j *Jail) Usage() (map[rctl.Resource]uint64, error) {
+	return rctl.Usage(rctl.SubjectJail, j.name)
+}
@@ -1,27 +1,29 @@
 package jail
 
-/*
-#cgo LDFLAGS: -ljail
-#include <sys/param.h>
-#include <sys/jail.h>
-#include <jail.h>
-#include <stdlib.h>
-*/
-import "C"
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"net"
 	"reflect"
-	"strings"
-	"unsafe"
 )
 
-var (
-	intType, stringType, ipType, ipSliceType, boolType reflect.Type
-	paramTypeMapping                                   map[string]reflect.Type
+// Raw values of the jailsys parameters, from <sys/jail.h>.
+const (
+	jailSysDisable = 0
+	jailSysNew     = 1
+	jailSysInherit = 2
 )
 
+var jailSysValues = map[JailSys]int32{
+	JailSysDisable: jailSysDisable,
+	JailSysNew:     jailSysNew,
+	JailSysInherit: jailSysInherit,
+}
+
+// nativeEndian is the byte order libjail and the kernel use for integers.
+var nativeEndian = nativeOrder()
+
 func jailParamType(name string) reflect.Type {
 	if ty, ok := paramTypeMapping[name]; ok {
 		return ty
@@ -40,72 +42,163 @@ func deref(iface interface{}) reflect.Value {
 	return val
 }
 
-func jailParamTypeCoerce(name string, iface interface{}) (ptr unsafe.Pointer, ptrLen int, er error) {
+func isIntKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+
+	return false
+}
+
+// encodeInt packs an integer parameter in size bytes, the size of its C type
+// as libjail describes it: 1, 2, 4 (an int) or 8 (a long).
+func encodeInt(name string, ival int64, size int) ([]byte, error) {
+	var min, max int64
+
+	switch size {
+	case 1:
+		min, max = math.MinInt8, math.MaxUint8
+
+	case 2:
+		min, max = math.MinInt16, math.MaxUint16
+
+	case 4:
+		min, max = math.MinInt32, math.MaxUint32
+
+	case 8:
+		buf := make([]byte, 8)
+		nativeEndian.PutUint64(buf, uint64(ival))
+		return buf, nil
+
+	default:
+		return nil, fmt.Errorf("Parameter `%s' is a %d byte integer, which isn't supported", name, size)
+	}
+
+	/* Unsigned parameters are passed the same way, so allow for both. */
+	if ival < min || ival > max {
+		return nil, fmt.Errorf("Parameter `%s' value %d doesn't fit in %d bytes", name, ival, size)
+	}
+
+	buf := make([]byte, size)
+
+	switch size {
+	case 1:
+		buf[0] = byte(ival)
+
+	case 2:
+		nativeEndian.PutUint16(buf, uint16(ival))
+
+	default:
+		nativeEndian.PutUint32(buf, uint32(ival))
+	}
+
+	return buf, nil
+}
+
+func decodeInt(name string, raw []byte) (int64, error) {
+	switch len(raw) {
+	case 1:
+		return int64(int8(raw[0])), nil
+
+	case 2:
+		return int64(int16(nativeEndian.Uint16(raw))), nil
+
+	case 4:
+		return int64(int32(nativeEndian.Uint32(raw))), nil
+
+	case 8:
+		return int64(nativeEndian.Uint64(raw)), nil
+	}
+
+	return 0, fmt.Errorf("Parameter `%s' has %d bytes, expected a 1, 2, 4 or 8 byte integer", name, len(raw))
+}
+
+// encodeParam marshals a value into the raw form the kernel takes for the
+// named parameter. The value may be a pointer to one of the Go types
+// listed for Jail.Get; size is the size libjail reported for the
+// parameter.
+func encodeParam(name string, iface interface{}, size int) ([]byte, error) {
 	val := deref(iface)
+	if !val.IsValid() {
+		return nil, fmt.Errorf("Parameter `%s' has no value", name)
+	}
+
 	kind := val.Kind()
 
 	ty := jailParamType(name)
 	if ty == nil {
-		return nil, 0, fmt.Errorf("Invalid parameter `%s'", name)
+		return nil, fmt.Errorf("Invalid parameter `%s'", name)
 	}
 
 	if ty == intType {
-		if kind != reflect.Int && kind != reflect.Int32 && kind != reflect.Int64 {
-			return nil, 0, fmt.Errorf("Parameter `%s' must be a string", name)
+		if !isIntKind(kind) {
+			return nil, fmt.Errorf("Parameter `%s' must be an int", name)
 		}
 
-		return unsafe.Pointer(val.UnsafeAddr()), int(val.Type().Size()), nil
+		return encodeInt(name, val.Int(), size)
 
 	} else if ty == stringType {
 		if kind != reflect.String {
-			return nil, 0, fmt.Errorf("Parameter `%s' must be a string", name)
+			return nil, fmt.Errorf("Parameter `%s' must be a string", name)
+		}
+
+		sval := val.String()
+		if bytes.IndexByte([]byte(sval), 0) >= 0 {
+			return nil, fmt.Errorf("Parameter `%s' cannot contain a NUL byte", name)
 		}
 
-		sval := []byte(val.String())
-		return unsafe.Pointer(&sval[0]), len(sval), nil
+		/* libjail and the kernel both expect the terminator. */
+		return append([]byte(sval), 0), nil
 
 	} else if ty == boolType {
 		if kind != reflect.Bool {
-			return nil, 0, fmt.Errorf("Parameter `%s' must be a bool", name)
+			return nil, fmt.Errorf("Parameter `%s' must be a bool", name)
 		}
 
-		bval := val.Bool()
-		return unsafe.Pointer(&bval), int(unsafe.Sizeof(bval)), nil
-
-	} else if ty == ipType {
-		if val, ok := val.Interface().(net.IP); ok {
-			sval := []byte(val)
-			return unsafe.Pointer(&sval[0]), len(sval), nil
+		/* Booleans are C ints, not a single byte. */
+		var ival int64
+		if val.Bool() {
+			ival = 1
 		}
 
-		return nil, 0, fmt.Errorf("Parameter `%s' must be a net.IP", name)
-
-	} else if ty == ipSliceType {
-		buf := bytes.Buffer{}
+		return encodeInt(name, ival, 4)
 
-		if ips, ok := val.Interface().([]net.IP); ok {
-			for _, ip := range ips {
-				buf.Write([]byte(ip))
-			}
+	} else if ty == jailSysType {
+		if kind != reflect.String {
+			return nil, fmt.Errorf("Parameter `%s' must be a JailSys", name)
+		}
 
-		} else {
-			return nil, 0, fmt.Errorf("Parameter `%s' must be a []net.IP or []*net.IP", name)
+		ival, ok := jailSysValues[JailSys(val.String())]
+		if !ok {
+			return nil, fmt.Errorf("Parameter `%s' cannot be `%s'", name, val.String())
 		}
 
-		if buf.Len() > 0 {
-			return unsafe.Pointer(&buf.Bytes()[0]), buf.Len(), nil
+		return encodeInt(name, int64(ival), 4)
+
+	} else if ty == ipType || ty == ipSliceType {
+		switch ips := val.Interface().(type) {
+		case net.IP:
+			return encodeJailIPs(name, []net.IP{ips})
 
-		} else {
-			/* XXX: Not sure if this is how we encode an empty slice? */
-			return nil, 0, nil
+		case []net.IP:
+			return encodeJailIPs(name, ips)
 		}
+
+		return nil, fmt.Errorf("Parameter `%s' must be a net.IP or []net.IP", name)
 	}
 
-	return nil, 0, fmt.Errorf("Unknown type for parameter `%s'", name)
+	return nil, fmt.Errorf("Unknown type for parameter `%s'", name)
 }
 
-func jailParamTypeExtract(name string, val *C.struct_jailparam, out interface{}) error {
+// decodeParam unmarshals the raw value of the named parameter into out,
+// which must be a pointer to the parameter's Go type.
+func decodeParam(name string, raw []byte, out interface{}) error {
 	outVal := deref(out)
+	if !outVal.CanSet() {
+		return fmt.Errorf("Output for parameter `%s' must be a pointer", name)
+	}
+
 	kind := outVal.Kind()
 
 	ty := jailParamType(name)
@@ -114,66 +207,83 @@ func jailParamTypeExtract(name string, val *C.struct_jailparam, out interface{})
 	}
 
 	if ty == intType {
-		if kind != reflect.Int && kind != reflect.Int32 && kind != reflect.Int64 {
-			return fmt.Errorf("Parameter %s must be an int")
+		if !isIntKind(kind) {
+			return fmt.Errorf("Parameter `%s' must be an int", name)
+		}
+
+		ival, er := decodeInt(name, raw)
+		if er != nil {
+			return er
+		}
+
+		if outVal.OverflowInt(ival) {
+			return fmt.Errorf("Parameter `%s' value %d doesn't fit in a %s", name, ival, outVal.Type())
 		}
 
-		intVal := int64(*(*C.int)(val.jp_value))
-		outVal.SetInt(intVal)
+		outVal.SetInt(ival)
 
 	} else if ty == stringType {
 		if kind != reflect.String {
-			return fmt.Errorf("Parameter %s must be a string")
+			return fmt.Errorf("Parameter `%s' must be a string", name)
+		}
+
+		if idx := bytes.IndexByte(raw, 0); idx >= 0 {
+			raw = raw[:idx]
 		}
 
-		strVal := string(C.GoBytes(val.jp_value, C.int(val.jp_valuelen)))
-		strVal = strings.Trim(strVal, "\x00")
-		outVal.SetString(strVal)
+		outVal.SetString(string(raw))
 
 	} else if ty == boolType {
 		if kind != reflect.Bool {
-			return fmt.Errorf("Parameter %s must be a bool")
+			return fmt.Errorf("Parameter `%s' must be a bool", name)
 		}
 
-		boolVal := byte(*(*C.char)(val.jp_value))
-		outVal.SetBool(boolVal != 0)
-
-	} else if ty == ipType || ty == ipSliceType {
-		buf := bytes.NewBuffer(C.GoBytes(val.jp_value, C.int(val.jp_valuelen)))
-		newSlice := reflect.ValueOf([]net.IP{})
-		stride := 0
-
-		if name == "ip4.addr" {
-			stride = 4
+		ival, er := decodeInt(name, raw)
+		if er != nil {
+			return er
+		}
 
-		} else if name == "ip6.addr" {
-			stride = 16
+		outVal.SetBool(ival != 0)
 
-		} else {
-			return fmt.Errorf("Parameter `%s' cannot be coerced to net.IP's", name)
+	} else if ty == jailSysType {
+		if kind != reflect.String {
+			return fmt.Errorf("Parameter `%s' must be a JailSys", name)
 		}
 
-		for buf.Len() >= stride {
-			b := make([]byte, stride)
+		ival, er := decodeInt(name, raw)
+		if er != nil {
+			return er
+		}
 
-			if _, er := buf.Read(b); er != nil {
-				return er
+		for sys, sysVal := range jailSysValues {
+			if int64(sysVal) == ival {
+				outVal.SetString(string(sys))
+				return nil
 			}
+		}
 
-			fmt.Printf("%#v\n", b)
+		return fmt.Errorf("Parameter `%s' has unknown value %d", name, ival)
 
-			ip := net.IP(b)
-			newSlice = reflect.Append(newSlice, reflect.ValueOf(ip))
+	} else if ty == ipType || ty == ipSliceType {
+		ips, er := decodeJailIPs(name, raw)
+		if er != nil {
+			return er
 		}
 
-		if _, ok := outVal.Interface().([]net.IP); ok {
-			outVal.Set(newSlice)
+		switch outVal.Interface().(type) {
+		case []net.IP:
+			outVal.Set(reflect.ValueOf(ips))
+
+		case net.IP:
+			if len(ips) > 0 {
+				outVal.Set(reflect.ValueOf(ips[0]))
 
-		} else if _, ok := outVal.Interface().(net.IP); ok {
-			outVal.Set(newSlice.Index(0))
+			} else {
+				outVal.Set(reflect.ValueOf(net.IP(nil)))
+			}
 
-		} else {
-			fmt.Printf("Parameter `%s' must be a net.IP or []net.IP", name)
+		default:
+			return fmt.Errorf("Parameter `%s' must be a net.IP or []net.IP", name)
 		}
 
 	} else {
@@ -0,0 +1,235 @@
+package jail
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func int32Bytes(v int32) []byte {
+	buf := make([]byte, 4)
+	nativeEndian.PutUint32(buf, uint32(v))
+	return buf
+}
+
+func int16Bytes(v int16) []byte {
+	buf := make([]byte, 2)
+	nativeEndian.PutUint16(buf, uint16(v))
+	return buf
+}
+
+func int64Bytes(v int64) []byte {
+	buf := make([]byte, 8)
+	nativeEndian.PutUint64(buf, uint64(v))
+	return buf
+}
+
+func TestEncodeParam(t *testing.T) {
+	level := -1
+	var nilInt *int
+	hostid := int64(1 << 40)
+
+	for _, tc := range []struct {
+		name  string
+		value interface{}
+		size  int
+		raw   []byte
+	}{
+		{"jid", 5, 4, int32Bytes(5)},
+		{"jid", &level, 4, int32Bytes(-1)},
+		{"children.max", int64(3), 4, int32Bytes(3)},
+		{"children.max", int8(3), 1, []byte{3}},
+		{"children.max", 255, 1, []byte{255}},
+		{"children.max", -2, 2, int16Bytes(-2)},
+		{"children.max", 65535, 2, int16Bytes(-1)},
+		{"host.hostid", &hostid, 8, int64Bytes(1 << 40)},
+		{"host.hostid", int64(1<<32 - 1), 4, int32Bytes(-1)},
+		{"enforce_statfs", EnforceStatfsRoot, 4, int32Bytes(2)},
+
+		{"name", "www", 256, []byte("www\x00")},
+		{"name", "", 256, []byte{0}},
+		{"host.hostname", strPtr("www.example.org"), 256, []byte("www.example.org\x00")},
+
+		{"persist", true, 4, int32Bytes(1)},
+		{"persist", false, 4, int32Bytes(0)},
+		{"allow.mount", boolPtr(true), 4, int32Bytes(1)},
+
+		{"ip4", JailSysNew, 4, int32Bytes(1)},
+		{"ip6", JailSysInherit, 4, int32Bytes(2)},
+		{"vnet", JailSysDisable, 4, int32Bytes(0)},
+		{"host", "new", 4, int32Bytes(1)},
+
+		{"ip4.addr", []net.IP{net.ParseIP("192.0.2.1"), net.IPv4(192, 0, 2, 2).To4()}, 0, []byte{192, 0, 2, 1, 192, 0, 2, 2}},
+		{"ip4.addr", []net.IP{}, 0, []byte{}},
+		{"ip4.addr", net.ParseIP("198.51.100.7"), 0, []byte{198, 51, 100, 7}},
+		{"ip6.addr", []net.IP{net.ParseIP("2001:db8::1")}, 0, net.ParseIP("2001:db8::1")},
+	} {
+		raw, er := encodeParam(tc.name, tc.value, tc.size)
+		if er != nil {
+			t.Errorf("Encoding %v for `%s': %s", tc.value, tc.name, er)
+			continue
+		}
+
+		if !bytes.Equal(raw, tc.raw) {
+			t.Errorf("Encoded %v for `%s' as %v, expected %v", tc.value, tc.name, raw, tc.raw)
+		}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		value interface{}
+		size  int
+	}{
+		{"bogus", 1, 4},
+		{"jid", nilInt, 4},
+		{"jid", nil, 4},
+		{"jid", "5", 4},
+		{"jid", 5.0, 4},
+		{"children.max", int64(1 << 40), 4},
+		{"children.max", int64(-1 << 40), 4},
+		{"children.max", 256, 1},
+		{"children.max", -129, 1},
+		{"children.max", 1 << 16, 2},
+		{"children.max", 3, 0},
+		{"children.max", 3, 3},
+		{"name", 5, 256},
+		{"name", []byte("www"), 256},
+		{"name", "w\x00w", 256},
+		{"persist", 1, 4},
+		{"persist", "true", 4},
+		{"ip4", JailSys("sometimes"), 4},
+		{"ip4", 1, 4},
+		{"ip4.addr", "192.0.2.1", 0},
+		{"ip4.addr", []net.IP{net.ParseIP("2001:db8::1")}, 0},
+		{"ip6.addr", []net.IP{net.ParseIP("192.0.2.1")}, 0},
+		{"ip6.addr", []string{"2001:db8::1"}, 0},
+	} {
+		_, er := encodeParam(tc.name, tc.value, tc.size)
+		if er == nil {
+			t.Errorf("Encoding %#v for `%s' should have failed", tc.value, tc.name)
+
+		} else if !strings.Contains(er.Error(), tc.name) {
+			t.Errorf("Error for `%s' doesn't name it: %s", tc.name, er)
+		}
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestDecodeParam(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		raw      []byte
+		expected interface{}
+	}{
+		{"jid", int32Bytes(12), 12},
+		{"securelevel", int32Bytes(-1), -1},
+		{"host.hostid", int64Bytes(1 << 40), 1 << 40},
+		{"children.max", int32Bytes(7), int32(7)},
+		{"children.max", []byte{7}, 7},
+		{"children.max", []byte{0xff}, -1},
+		{"children.max", int16Bytes(-300), int16(-300)},
+		{"enforce_statfs", int32Bytes(1), EnforceStatfsBelowRoot},
+
+		{"name", []byte("www\x00\x00\x00\x00"), "www"},
+		{"name", []byte("www"), "www"},
+		{"name", []byte{0}, ""},
+		{"path", []byte{}, ""},
+
+		{"persist", int32Bytes(1), true},
+		{"persist", int32Bytes(0), false},
+		{"dying", int64Bytes(1), true},
+
+		{"ip4", int32Bytes(0), JailSysDisable},
+		{"ip6", int32Bytes(1), JailSysNew},
+		{"host", int32Bytes(2), JailSysInherit},
+
+		{"ip4.addr", []byte{192, 0, 2, 1, 192, 0, 2, 2}, []net.IP{net.IPv4(192, 0, 2, 1).To4(), net.IPv4(192, 0, 2, 2).To4()}},
+		{"ip4.addr", []byte{}, []net.IP{}},
+		{"ip4.addr", []byte{198, 51, 100, 7}, net.IPv4(198, 51, 100, 7).To4()},
+		{"ip4.addr", []byte{}, net.IP(nil)},
+		{"ip6.addr", []byte(net.ParseIP("2001:db8::1")), []net.IP{net.ParseIP("2001:db8::1")}},
+	} {
+		out := reflect.New(reflect.TypeOf(tc.expected))
+
+		if er := decodeParam(tc.name, tc.raw, out.Interface()); er != nil {
+			t.Errorf("Decoding %v for `%s': %s", tc.raw, tc.name, er)
+			continue
+		}
+
+		if got := out.Elem().Interface(); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("Decoded %v for `%s' as %#v, expected %#v", tc.raw, tc.name, got, tc.expected)
+		}
+	}
+
+	var (
+		i  int
+		i8 int8
+		s  string
+		b  bool
+		ip []net.IP
+	)
+
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+		out  interface{}
+	}{
+		{"bogus", int32Bytes(1), &i},
+		{"jid", int32Bytes(1), i},
+		{"jid", int32Bytes(1), &s},
+		{"jid", []byte{1, 2, 3}, &i},
+		{"children.max", int32Bytes(1000), &i8},
+		{"name", []byte("www\x00"), &i},
+		{"persist", int32Bytes(1), &i},
+		{"persist", []byte{}, &b},
+		{"ip4", int32Bytes(7), &s},
+		{"ip4", int32Bytes(1), &i},
+		{"ip4.addr", []byte{192, 0, 2, 1, 192}, &ip},
+		{"ip6.addr", []byte{192, 0, 2, 1}, &ip},
+		{"ip4.addr", []byte{192, 0, 2, 1}, &s},
+	} {
+		er := decodeParam(tc.name, tc.raw, tc.out)
+		if er == nil {
+			t.Errorf("Decoding %v for `%s' into %T should have failed", tc.raw, tc.name, tc.out)
+
+		} else if !strings.Contains(er.Error(), tc.name) {
+			t.Errorf("Error for `%s' doesn't name it: %s", tc.name, er)
+		}
+	}
+}
+
+func TestParamRoundTrip(t *testing.T) {
+	lib := newFakeLibjail()
+
+	/* Every type of parameter, at the size the fake kernel reports. */
+	for _, value := range []interface{}{0, -1, 1 << 30, "", "www", true, false, JailSysNew, JailSysInherit, JailSysDisable} {
+		for name, ty := range builtinParamTypes {
+			if ty != reflect.TypeOf(value) {
+				continue
+			}
+
+			raw, er := encodeParam(name, value, lib.sizes[name])
+			if er != nil {
+				t.Errorf("Encoding %v for `%s': %s", value, name, er)
+				continue
+			}
+
+			out := reflect.New(ty)
+			if er := decodeParam(name, raw, out.Interface()); er != nil {
+				t.Errorf("Decoding %v for `%s': %s", value, name, er)
+
+			} else if out.Elem().Interface() != value {
+				t.Errorf("`%s' went in as %v and came out as %v", name, value, out.Elem().Interface())
+			}
+		}
+	}
+}
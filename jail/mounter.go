@@ -0,0 +1,65 @@
+//go:build freebsd
+
+package jail
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/lye/freebsd/fs"
+)
+
+// mountPlan mounts the plan's filesystems under root, rolling back if any
+// of them fail, and returns the targets mounted.
+func mountPlan(plan *MountPlan, root string) ([]string, error) {
+	steps, er := plan.steps(root)
+	if er != nil || len(steps) == 0 {
+		return nil, er
+	}
+
+	realRoot, er := filepath.EvalSymlinks(root)
+	if er != nil {
+		return nil, er
+	}
+
+	return applyMountSteps(steps, func(step mountStep) error {
+		/* The lexical check in jailPath doesn't stop a symlink in the
+		 * jail's tree from pointing the mount somewhere else. */
+		target, er := filepath.EvalSymlinks(step.target)
+		if er != nil {
+			return er
+		}
+
+		if !withinRoot(realRoot, target) {
+			return fmt.Errorf("`%s' leads outside of the jail's root", step.target)
+		}
+
+		_, er = fs.Mount(step.fstype, step.source, target, step.opts, 0)
+		return er
+	}, unmountTarget)
+}
+
+func unmountTarget(target string) error {
+	if real, er := filepath.EvalSymlinks(target); er == nil {
+		target = real
+	}
+
+	mi, er := fs.MountInfoForPath(target)
+	if er != nil {
+		return er
+	}
+
+	if mi.MntToName() != target {
+		return fmt.Errorf("Nothing is mounted on `%s'", target)
+	}
+
+	return mi.Unmount()
+}
+
+// unmountAll unmounts the filesystems CreateJail mounted for the jail.
+func (j *Jail) unmountAll() error {
+	er := unwindMounts(j.mounts, unmountTarget)
+	j.mounts = nil
+
+	return er
+}
@@ -0,0 +1,198 @@
+package jail
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// The devfs ruleset jail(8) applies by default: devfsrules_jail from
+// /etc/defaults/devfs.rules.
+const defaultDevfsRuleset = 4
+
+// MountEntry is a filesystem to mount under a jail's root, described the
+// way a line of an fstab(5) file is.
+type MountEntry struct {
+	// Source is the device or directory to mount, or just a name for
+	// filesystems such as tmpfs that aren't backed by anything.
+	Source string
+
+	// Target is where to mount it, relative to the jail's root.
+	Target string
+
+	FsType string
+
+	// Options are as for `mount -o`: flags such as "ro" and "nosuid", and
+	// name=value pairs such as "size=64m".
+	Options []string
+}
+
+// MountPlan describes the filesystems to mount under a jail's root before
+// it's created, like jail(8)'s mount.fstab and mount.devfs. Entries are
+// mounted in order, then devfs; they're unmounted in the reverse order when
+// the jail is destroyed.
+type MountPlan struct {
+	Entries []MountEntry
+
+	// Devfs mounts a devfs on the jail's /dev, with DevfsRuleset applied.
+	// If DevfsRuleset is 0, ruleset 4 (devfsrules_jail) is used, as with
+	// jail(8).
+	Devfs        bool
+	DevfsRuleset int
+}
+
+// ParseMountEntries reads entries in fstab(5) format. As with jail(8)'s
+// mount.fstab, the dump and pass fields are optional and ignored; unlike
+// it, targets are taken relative to the jail's root.
+func ParseMountEntries(r io.Reader) ([]MountEntry, error) {
+	entries := []MountEntry{}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+
+	for scanner.Scan() {
+		lineNo++
+
+		line := scanner.Text()
+		if idx := strings.IndexByte(line, '#'); idx >= 0 {
+			line = line[:idx]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) < 4 || len(fields) > 6 {
+			return nil, fmt.Errorf("Malformed fstab entry on line %d", lineNo)
+		}
+
+		entry := MountEntry{
+			Source: fields[0],
+			Target: fields[1],
+			FsType: fields[2],
+		}
+
+		for _, opt := range strings.Split(fields[3], ",") {
+			/* "rw" is the default, and fstab uses it as a placeholder. */
+			if opt != "" && opt != "rw" {
+				entry.Options = append(entry.Options, opt)
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if er := scanner.Err(); er != nil {
+		return nil, er
+	}
+
+	return entries, nil
+}
+
+// mountStep is a single mount, ready to be handed to fs.Mount.
+type mountStep struct {
+	fstype string
+	source string
+	target string
+	opts   map[string]string
+}
+
+// jailPath returns the host path of path inside a jail rooted at root.
+// It's purely lexical, so ".." can't climb out of the root.
+func jailPath(root, path string) string {
+	return filepath.Join(root, filepath.Clean("/"+path))
+}
+
+// withinRoot returns true if path is root or somewhere beneath it.
+func withinRoot(root, path string) bool {
+	root = filepath.Clean(root)
+	path = filepath.Clean(path)
+
+	return root == "/" || path == root || strings.HasPrefix(path, root+"/")
+}
+
+// steps turns the plan into the mounts to make under root, in order.
+func (plan *MountPlan) steps(root string) ([]mountStep, error) {
+	steps := []mountStep{}
+
+	for _, entry := range plan.Entries {
+		if entry.FsType == "" || entry.Source == "" || entry.Target == "" {
+			return nil, fmt.Errorf("Mount entry `%s %s' needs a source, target and filesystem type", entry.Source, entry.Target)
+		}
+
+		step := mountStep{
+			fstype: entry.FsType,
+			source: entry.Source,
+			target: jailPath(root, entry.Target),
+			opts:   map[string]string{},
+		}
+
+		for _, opt := range entry.Options {
+			name, value := opt, ""
+
+			if idx := strings.IndexByte(opt, '='); idx >= 0 {
+				name, value = opt[:idx], opt[idx+1:]
+			}
+
+			if name == "" {
+				return nil, fmt.Errorf("Invalid option `%s' for mount on `%s'", opt, entry.Target)
+			}
+
+			step.opts[name] = value
+		}
+
+		steps = append(steps, step)
+	}
+
+	if plan.Devfs {
+		ruleset := plan.DevfsRuleset
+		if ruleset == 0 {
+			ruleset = defaultDevfsRuleset
+		}
+
+		steps = append(steps, mountStep{
+			fstype: "devfs",
+			source: "devfs",
+			target: jailPath(root, "/dev"),
+			opts:   map[string]string{"ruleset": fmt.Sprint(ruleset)},
+		})
+	}
+
+	return steps, nil
+}
+
+// applyMountSteps mounts each step in turn, returning the targets mounted.
+// If one fails, those already mounted are unmounted again in reverse order
+// and nothing is returned but the error.
+func applyMountSteps(steps []mountStep, mount func(mountStep) error, unmount func(string) error) ([]string, error) {
+	mounted := []string{}
+
+	for _, step := range steps {
+		if er := mount(step); er != nil {
+			/* Whatever can't be unmounted is lost track of, but the
+			 * mount's failure is the more useful error. */
+			unwindMounts(mounted, unmount)
+			return nil, fmt.Errorf("Unable to mount %s on `%s': %s", step.fstype, step.target, er)
+		}
+
+		mounted = append(mounted, step.target)
+	}
+
+	return mounted, nil
+}
+
+// unwindMounts unmounts targets in reverse order. It carries on past
+// failures, returning the first.
+func unwindMounts(targets []string, unmount func(string) error) error {
+	var first error
+
+	for i := len(targets) - 1; i >= 0; i-- {
+		if er := unmount(targets[i]); er != nil && first == nil {
+			first = fmt.Errorf("Unable to unmount `%s': %s", targets[i], er)
+		}
+	}
+
+	return first
+}
@@ -0,0 +1,153 @@
+package jail
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMountEntries(t *testing.T) {
+	file, er := os.Open("testdata/jail.fstab")
+	if er != nil {
+		t.Fatal(er)
+	}
+	defer file.Close()
+
+	entries, er := ParseMountEntries(file)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	expected := []MountEntry{
+		{Source: "/usr/ports", Target: "/usr/ports", FsType: "nullfs", Options: []string{"ro"}},
+		{Source: "tmpfs", Target: "/tmp", FsType: "tmpfs", Options: []string{"size=64m", "mode=1777"}},
+		{Source: "/dev/md0", Target: "/data", FsType: "ufs", Options: []string{"noatime"}},
+	}
+
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Unexpected entries %#v", entries)
+	}
+
+	if _, er := ParseMountEntries(strings.NewReader("tmpfs /tmp tmpfs\n")); er == nil {
+		t.Errorf("Expected an entry without options to be rejected")
+	}
+}
+
+func TestMountPlanSteps(t *testing.T) {
+	plan := &MountPlan{
+		Entries: []MountEntry{
+			{Source: "/usr/ports", Target: "/usr/ports", FsType: "nullfs", Options: []string{"ro"}},
+			{Source: "tmpfs", Target: "../../tmp", FsType: "tmpfs", Options: []string{"size=64m"}},
+		},
+		Devfs: true,
+	}
+
+	steps, er := plan.steps("/jails/www")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	expected := []mountStep{
+		{"nullfs", "/usr/ports", "/jails/www/usr/ports", map[string]string{"ro": ""}},
+		{"tmpfs", "tmpfs", "/jails/www/tmp", map[string]string{"size": "64m"}},
+		{"devfs", "devfs", "/jails/www/dev", map[string]string{"ruleset": "4"}},
+	}
+
+	if !reflect.DeepEqual(steps, expected) {
+		t.Errorf("Unexpected steps %#v", steps)
+	}
+
+	plan.DevfsRuleset = 10
+	if steps, _ := plan.steps("/"); steps[2].opts["ruleset"] != "10" || steps[2].target != "/dev" {
+		t.Errorf("Unexpected devfs step %#v", steps[2])
+	}
+
+	for _, bad := range []MountEntry{
+		{Target: "/tmp", FsType: "tmpfs"},
+		{Source: "tmpfs", Target: "/tmp", FsType: "tmpfs", Options: []string{"=64m"}},
+	} {
+		if _, er := (&MountPlan{Entries: []MountEntry{bad}}).steps("/jails/www"); er == nil {
+			t.Errorf("Expected %#v to be rejected", bad)
+		}
+	}
+}
+
+func TestWithinRoot(t *testing.T) {
+	for _, test := range []struct {
+		root, path string
+		within     bool
+	}{
+		{"/jails/www", "/jails/www", true},
+		{"/jails/www", "/jails/www/dev", true},
+		{"/jails/www/", "/jails/www/dev", true},
+		{"/jails/www", "/jails/www2", false},
+		{"/jails/www", "/etc", false},
+		{"/", "/etc", true},
+	} {
+		if withinRoot(test.root, test.path) != test.within {
+			t.Errorf("withinRoot(%s, %s) should be %v", test.root, test.path, test.within)
+		}
+	}
+}
+
+func TestApplyMountSteps(t *testing.T) {
+	steps := []mountStep{{target: "/a"}, {target: "/b"}, {target: "/c"}}
+	log := []string{}
+
+	mount := func(step mountStep) error {
+		if step.target == "/c" {
+			return errors.New("no such filesystem")
+		}
+
+		log = append(log, "mount "+step.target)
+		return nil
+	}
+
+	unmount := func(target string) error {
+		log = append(log, "unmount "+target)
+		return nil
+	}
+
+	if mounted, er := applyMountSteps(steps, mount, unmount); er == nil || mounted != nil {
+		t.Errorf("Expected the failed mount to be reported, got %v", mounted)
+	}
+
+	expected := []string{"mount /a", "mount /b", "unmount /b", "unmount /a"}
+	if !reflect.DeepEqual(log, expected) {
+		t.Errorf("Expected %v, got %v", expected, log)
+	}
+
+	log = []string{}
+	mounted, er := applyMountSteps(steps[:2], mount, unmount)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if !reflect.DeepEqual(mounted, []string{"/a", "/b"}) {
+		t.Errorf("Unexpected mounts %v", mounted)
+	}
+}
+
+func TestUnwindMounts(t *testing.T) {
+	log := []string{}
+
+	er := unwindMounts([]string{"/a", "/b", "/c"}, func(target string) error {
+		log = append(log, target)
+
+		if target != "/a" {
+			return errors.New("busy")
+		}
+
+		return nil
+	})
+
+	if er == nil || !strings.Contains(er.Error(), "/c") {
+		t.Errorf("Expected the first failure (/c) to be reported, got %v", er)
+	}
+
+	if !reflect.DeepEqual(log, []string{"/c", "/b", "/a"}) {
+		t.Errorf("Expected every mount to be tried in reverse, got %v", log)
+	}
+}
@@ -1,38 +1,128 @@
 package jail
 
-/*
-#cgo LDFLAGS: -ljail
-#include <sys/param.h>
-#include <sys/jail.h>
-#include <jail.h>
-#include <stdlib.h>
-*/
-import "C"
 import (
+	"errors"
 	"fmt"
+	"syscall"
 	"unsafe"
 )
 
+// Flags for jailparam_set and jailparam_get, from <sys/jail.h>.
+const (
+	jailCreate = 0x01
+	jailUpdate = 0x02
+	jailAttach = 0x04
+	jailDying  = 0x08
+)
+
+// jailParam is a parameter bound into a jailParamList. An input's value is
+// already marshaled into the list's arena; an output's is filled in by get.
+type jailParam struct {
+	name string
+
+	// size is jp_valuelen as libjail reports it after looking the
+	// parameter up: the width of an integer, or the most a string can hold
+	// (terminator included). It isn't used for arrays such as ip4.addr.
+	size int
+
+	input    bool
+	value    unsafe.Pointer
+	valueLen int
+
+	out []byte
+}
+
+// libjail is the part of libjail(3) the parameter layer is built on, with
+// values passed raw (JP_RAWVALUE). hostLibjail is the real library; the
+// tests swap in a fake kernel, so marshaling can be exercised anywhere.
+type libjail interface {
+	// lookup returns the size of the named parameter's value (see
+	// jailParam.size), or ENOENT if the kernel doesn't have it.
+	lookup(name string) (int, error)
+
+	// set calls jailparam_set with params, which are all inputs, and
+	// returns the JID of the jail created or updated.
+	set(params []*jailParam, flags int) (int, error)
+
+	// get calls jailparam_get on the jail chosen by the input params
+	// (jid, name or lastjid), fills in the outputs and returns its JID.
+	get(params []*jailParam, flags int) (int, error)
+
+	// errmsg returns jail_errmsg, which describes the last failure.
+	errmsg() string
+}
+
+var errNoLibjail = errors.New("jail: libjail isn't available on this system")
+
+// jailParamList is a set of parameters for a single jailparam_set or
+// jailparam_get call. It owns the memory the values are passed in, so it
+// must be released once the call is done.
 type jailParamList struct {
-	params      []C.struct_jailparam
-	nameMapping map[string]int
+	// lib defaults to jailLib.
+	lib libjail
+
+	arena       paramArena
+	params      []*jailParam
+	nameMapping map[string]*jailParam
+}
+
+func (jpps *jailParamList) backend() libjail {
+	if jpps.lib != nil {
+		return jpps.lib
+	}
+
+	return jailLib
+}
+
+// newParam checks that name can be bound, and asks libjail about it; the
+// caller adds it to the list once it's filled in.
+func (jpps *jailParamList) newParam(name string) (*jailParam, error) {
+	lib := jpps.backend()
+	if lib == nil {
+		return nil, errNoLibjail
+	}
+
+	if jailParamType(name) == nil {
+		return nil, fmt.Errorf("Invalid parameter `%s'", name)
+	}
+
+	if _, ok := jpps.nameMapping[name]; ok {
+		return nil, fmt.Errorf("Cannot bind parameter `%s' twice", name)
+	}
+
+	size, er := lib.lookup(name)
+	if er != nil {
+		return nil, er
+	}
+
+	return &jailParam{name: name, size: size}, nil
+}
+
+func (jpps *jailParamList) add(jp *jailParam) {
+	if jpps.nameMapping == nil {
+		jpps.nameMapping = map[string]*jailParam{}
+	}
+
+	jpps.nameMapping[jp.name] = jp
+	jpps.params = append(jpps.params, jp)
 }
 
 func (jpps *jailParamList) bindParameter(name string, value interface{}) error {
-	valuePtr, valueLen, er := jailParamTypeCoerce(name, value)
+	jp, er := jpps.newParam(name)
 	if er != nil {
 		return er
 	}
 
-	if er := jpps.bindOutput(name); er != nil {
+	raw, er := encodeParam(name, value, jp.size)
+	if er != nil {
 		return er
 	}
 
-	jpp := &jpps.params[len(jpps.params)-1]
-	jpp.jp_value = valuePtr
-	jpp.jp_valuelen = C.size_t(valueLen)
-	jpp.jp_flags |= C.JP_RAWVALUE
+	jp.input = true
+	jp.value = jpps.arena.copyIn(raw)
+	jp.valueLen = len(raw)
 
+	jpps.add(jp)
 	return nil
 }
 
@@ -47,26 +137,27 @@ func (jpps *jailParamList) bindParameters(params map[string]interface{}) error {
 }
 
 func (jpps *jailParamList) bindOutput(name string) error {
-	if jpps.nameMapping == nil {
-		jpps.nameMapping = map[string]int{}
-	}
-
-	if _, ok := jpps.nameMapping[name]; ok {
-		return fmt.Errorf("Cannot bind parameter `%s' twice", name)
+	jp, er := jpps.newParam(name)
+	if er != nil {
+		return er
 	}
 
-	jpps.nameMapping[name] = len(jpps.params)
+	jpps.add(jp)
+	return nil
+}
 
-	nameStr := C.CString(name)
-	defer C.free(unsafe.Pointer(nameStr))
+// bindOptionalOutput is bindOutput for parameters the kernel may not have at
+// all, such as ip6.addr on a kernel built without INET6. It reports whether
+// the parameter was bound.
+func (jpps *jailParamList) bindOptionalOutput(name string) (bool, error) {
+	if er := jpps.bindOutput(name); er == syscall.ENOENT {
+		return false, nil
 
-	var jpp C.struct_jailparam
-	if _, er := C.jailparam_init(&jpp, nameStr); er != nil {
-		return er
+	} else if er != nil {
+		return false, er
 	}
 
-	jpps.params = append(jpps.params, jpp)
-	return nil
+	return true, nil
 }
 
 func (jpps *jailParamList) bindOutputs(names ...string) error {
@@ -79,23 +170,63 @@ func (jpps *jailParamList) bindOutputs(names ...string) error {
 	return nil
 }
 
+// set calls jailparam_set with the bound parameters, which must all be
+// inputs, and returns the JID.
+func (jpps *jailParamList) set(flags int) (int, error) {
+	for _, jp := range jpps.params {
+		if !jp.input {
+			return 0, fmt.Errorf("Parameter `%s' has no value to set", jp.name)
+		}
+	}
+
+	if len(jpps.params) == 0 {
+		return 0, fmt.Errorf("No parameters to set")
+	}
+
+	jid, er := jpps.backend().set(jpps.params, flags)
+	if er != nil {
+		return 0, jpps.callError("jailparam_set", er)
+	}
+
+	return jid, nil
+}
+
+// get calls jailparam_get with the bound parameters, after which the
+// outputs can be grabbed. It returns the JID.
+func (jpps *jailParamList) get(flags int) (int, error) {
+	if len(jpps.params) == 0 {
+		return 0, fmt.Errorf("No parameters to get")
+	}
+
+	jid, er := jpps.backend().get(jpps.params, flags)
+	if er != nil {
+		return 0, jpps.callError("jailparam_get", er)
+	}
+
+	return jid, nil
+}
+
 func (jpps *jailParamList) grabOutput(name string, out interface{}) error {
-	idx, ok := jpps.nameMapping[name]
+	jp, ok := jpps.nameMapping[name]
 	if !ok {
 		return fmt.Errorf("Parameter `%s' not in passed jailParamList", name)
 	}
 
-	jpp := &jpps.params[idx]
+	if jp.out == nil {
+		return fmt.Errorf("Parameter `%s' has no value to grab", name)
+	}
 
-	return jailParamTypeExtract(name, jpp, out)
+	return decodeParam(name, jp.out, out)
 }
 
-func (jpps *jailParamList) numParams() C.uint {
-	return C.uint(len(jpps.params))
+// callError wraps an error from the libjail call op in a JailError, along
+// with whatever libjail left in jail_errmsg.
+func (jpps *jailParamList) callError(op string, er error) error {
+	return newJailError(op, er, jpps.backend().errmsg())
 }
 
 func (jpps *jailParamList) release() {
-	if len(jpps.params) > 0 {
-		C.jailparam_free(&jpps.params[0], C.uint(len(jpps.params)))
-	}
+	jpps.arena.release()
+	jpps.params = nil
+	jpps.nameMapping = nil
 }
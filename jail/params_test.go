@@ -0,0 +1,483 @@
+package jail
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// fakeLibjail is a libjail backed by a fake kernel, which checks raw values
+// the way the real one does: strings must be NUL-terminated, and fixed-size
+// values must be exactly the size of their C type.
+type fakeLibjail struct {
+	sizes map[string]int
+	jails map[int]map[string][]byte
+	last  string
+}
+
+const fakeStringSize = 256
+
+func newFakeLibjail() *fakeLibjail {
+	lib := &fakeLibjail{
+		sizes: map[string]int{},
+		jails: map[int]map[string][]byte{},
+	}
+
+	for name, ty := range builtinParamTypes {
+		switch ty {
+		case stringType:
+			lib.sizes[name] = fakeStringSize
+
+		case ipSliceType:
+			lib.sizes[name] = 0
+
+		default:
+			lib.sizes[name] = 4
+		}
+	}
+
+	/* host.hostid is an unsigned long. */
+	lib.sizes["host.hostid"] = 8
+
+	return lib
+}
+
+func (lib *fakeLibjail) fail(errno syscall.Errno, format string, args ...interface{}) error {
+	lib.last = fmt.Sprintf(format, args...)
+	return errno
+}
+
+func (lib *fakeLibjail) lookup(name string) (int, error) {
+	size, ok := lib.sizes[name]
+	if !ok {
+		return 0, lib.fail(syscall.ENOENT, "unknown parameter: %s", name)
+	}
+
+	return size, nil
+}
+
+func (lib *fakeLibjail) intValue(raw []byte) int {
+	return int(int32(nativeEndian.Uint32(raw)))
+}
+
+// inputs checks the raw input values, as the kernel would.
+func (lib *fakeLibjail) inputs(params []*jailParam) (map[string][]byte, error) {
+	values := map[string][]byte{}
+
+	for _, param := range params {
+		if !param.input {
+			continue
+		}
+
+		raw := arenaBytes(param.value, param.valueLen)
+		size := lib.sizes[param.name]
+
+		if builtinParamTypes[param.name] == stringType {
+			if len(raw) == 0 || raw[len(raw)-1] != 0 || len(raw) > size {
+				return nil, lib.fail(syscall.EINVAL, "%s: invalid string", param.name)
+			}
+
+		} else if size != 0 && len(raw) != size {
+			return nil, lib.fail(syscall.EINVAL, "%s: %d bytes, expected %d", param.name, len(raw), size)
+		}
+
+		values[param.name] = raw
+	}
+
+	return values, nil
+}
+
+// find returns the JID of the jail named by the key parameters.
+func (lib *fakeLibjail) find(values map[string][]byte) (int, error) {
+	if raw, ok := values["lastjid"]; ok {
+		jids := []int{}
+		for jid := range lib.jails {
+			jids = append(jids, jid)
+		}
+
+		sort.Ints(jids)
+
+		for _, jid := range jids {
+			if jid > lib.intValue(raw) {
+				return jid, nil
+			}
+		}
+
+		return 0, lib.fail(syscall.ENOENT, "no more jails")
+	}
+
+	if raw, ok := values["jid"]; ok && lib.intValue(raw) != 0 {
+		jid := lib.intValue(raw)
+
+		if _, ok := lib.jails[jid]; !ok {
+			return 0, lib.fail(syscall.ENOENT, "jail %d not found", jid)
+		}
+
+		return jid, nil
+	}
+
+	if raw, ok := values["name"]; ok {
+		for jid, jail := range lib.jails {
+			if string(jail["name"]) == string(raw) {
+				return jid, nil
+			}
+		}
+
+		return 0, lib.fail(syscall.ENOENT, "jail \"%s\" not found", strings.TrimRight(string(raw), "\x00"))
+	}
+
+	return 0, lib.fail(syscall.ENOENT, "no jail specified")
+}
+
+func (lib *fakeLibjail) set(params []*jailParam, flags int) (int, error) {
+	values, er := lib.inputs(params)
+	if er != nil {
+		return 0, er
+	}
+
+	jid, er := lib.find(values)
+
+	if er == nil && flags&jailUpdate == 0 {
+		return 0, lib.fail(syscall.EEXIST, "jail %d already exists", jid)
+
+	} else if er != nil && flags&jailCreate == 0 {
+		return 0, er
+
+	} else if er != nil {
+		for jid = 1; lib.jails[jid] != nil; jid++ {
+		}
+
+		if raw, ok := values["jid"]; ok && lib.intValue(raw) != 0 {
+			jid = lib.intValue(raw)
+		}
+
+		lib.jails[jid] = map[string][]byte{}
+	}
+
+	delete(values, "jid")
+
+	for name, raw := range values {
+		lib.jails[jid][name] = raw
+	}
+
+	return jid, nil
+}
+
+func (lib *fakeLibjail) get(params []*jailParam, flags int) (int, error) {
+	values, er := lib.inputs(params)
+	if er != nil {
+		return 0, er
+	}
+
+	jid, er := lib.find(values)
+	if er != nil {
+		return 0, er
+	}
+
+	for _, param := range params {
+		if param.input {
+			continue
+		}
+
+		raw, ok := lib.jails[jid][param.name]
+		if param.name == "jid" {
+			raw = int32Bytes(int32(jid))
+
+		} else if !ok {
+			raw = make([]byte, lib.sizes[param.name])
+		}
+
+		/* Like libjail, strings come back in a buffer of the
+		 * parameter's full size. */
+		if builtinParamTypes[param.name] == stringType {
+			padded := make([]byte, fakeStringSize)
+			copy(padded, raw)
+			raw = padded
+		}
+
+		param.out = raw
+	}
+
+	return jid, nil
+}
+
+func (lib *fakeLibjail) errmsg() string {
+	return lib.last
+}
+
+// sampleParamValue returns a valid value for the named parameter.
+func sampleParamValue(name string) interface{} {
+	switch builtinParamTypes[name] {
+	case intType:
+		if name == "host.hostid" {
+			return 1 << 40
+		}
+
+		return len(name)
+
+	case stringType:
+		return "value of " + name
+
+	case boolType:
+		return len(name)%2 == 0
+
+	case jailSysType:
+		return JailSysInherit
+
+	case ipSliceType:
+		if name == "ip6.addr" {
+			return []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")}
+		}
+
+		return []net.IP{net.IPv4(192, 0, 2, 1).To4(), net.IPv4(192, 0, 2, 2).To4()}
+	}
+
+	return nil
+}
+
+func TestJailParamListAllParams(t *testing.T) {
+	lib := newFakeLibjail()
+
+	create := jailParamList{lib: lib}
+	defer create.release()
+
+	settable := []string{}
+
+	for name := range builtinParamTypes {
+		if readOnlyParams[name] || name == "jid" {
+			continue
+		}
+
+		settable = append(settable, name)
+
+		if er := create.bindParameter(name, sampleParamValue(name)); er != nil {
+			t.Fatalf("Binding `%s': %s", name, er)
+		}
+	}
+
+	jid, er := create.set(jailCreate)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	query := jailParamList{lib: lib}
+	defer query.release()
+
+	if er := query.bindParameter("jid", jid); er != nil {
+		t.Fatal(er)
+	}
+
+	if er := query.bindOutputs(settable...); er != nil {
+		t.Fatal(er)
+	}
+
+	if got, er := query.get(0); er != nil || got != jid {
+		t.Fatalf("Got jail %d, %v", got, er)
+	}
+
+	for _, name := range settable {
+		out := reflect.New(builtinParamTypes[name])
+
+		if er := query.grabOutput(name, out.Interface()); er != nil {
+			t.Errorf("Grabbing `%s': %s", name, er)
+
+		} else if got := out.Elem().Interface(); !reflect.DeepEqual(got, sampleParamValue(name)) {
+			t.Errorf("`%s' went in as %v and came out as %v", name, sampleParamValue(name), got)
+		}
+	}
+}
+
+func TestJailParamListLookups(t *testing.T) {
+	lib := newFakeLibjail()
+
+	for _, name := range []string{"www", "db", "mail"} {
+		jpps := jailParamList{lib: lib}
+
+		if er := jpps.bindParameter("name", name); er != nil {
+			t.Fatal(er)
+		}
+
+		if _, er := jpps.set(jailCreate); er != nil {
+			t.Fatal(er)
+		}
+
+		jpps.release()
+	}
+
+	byName := jailParamList{lib: lib}
+	defer byName.release()
+
+	if er := byName.bindParameter("name", "db"); er != nil {
+		t.Fatal(er)
+	}
+
+	if er := byName.bindOutput("jid"); er != nil {
+		t.Fatal(er)
+	}
+
+	if jid, er := byName.get(0); er != nil || jid != 2 {
+		t.Errorf("Found db at %d, %v", jid, er)
+	}
+
+	var jid int
+	if er := byName.grabOutput("jid", &jid); er != nil || jid != 2 {
+		t.Errorf("Grabbed jid %d, %v", jid, er)
+	}
+
+	/* Walk the jails the way enumerateJails does. */
+	jids := []int{}
+
+	for lastjid := 0; ; {
+		jpps := jailParamList{lib: lib}
+
+		if er := jpps.bindParameter("lastjid", lastjid); er != nil {
+			t.Fatal(er)
+		}
+
+		jid, er := jpps.get(0)
+		jpps.release()
+
+		if errors.Is(er, ErrJailNotFound) {
+			break
+
+		} else if er != nil {
+			t.Fatal(er)
+		}
+
+		jids = append(jids, jid)
+		lastjid = jid
+	}
+
+	if !reflect.DeepEqual(jids, []int{1, 2, 3}) {
+		t.Errorf("Enumerated %v", jids)
+	}
+}
+
+func TestJailParamListErrors(t *testing.T) {
+	lib := newFakeLibjail()
+	delete(lib.sizes, "ip6.addr")
+
+	jpps := jailParamList{lib: lib}
+	defer jpps.release()
+
+	if er := jpps.bindParameter("jid", 12); er != nil {
+		t.Fatal(er)
+	}
+
+	if er := jpps.bindParameter("jid", 13); er == nil {
+		t.Error("Bound jid twice")
+	}
+
+	if er := jpps.bindOutput("bogus"); er == nil {
+		t.Error("Bound an unknown parameter")
+	}
+
+	if er := jpps.bindParameter("persist", "yes"); er == nil {
+		t.Error("Bound a string to a bool")
+	}
+
+	if er := jpps.bindOutput("ip6.addr"); er != syscall.ENOENT {
+		t.Errorf("Binding a parameter the kernel doesn't have gave %v", er)
+	}
+
+	if ok, er := jpps.bindOptionalOutput("ip6.addr"); ok || er != nil {
+		t.Errorf("Optional parameter bound: %v, %v", ok, er)
+	}
+
+	if ok, er := jpps.bindOptionalOutput("ip4.addr"); !ok || er != nil {
+		t.Errorf("Optional parameter not bound: %v, %v", ok, er)
+	}
+
+	var addrs []net.IP
+	if er := jpps.grabOutput("ip4.addr", &addrs); er == nil {
+		t.Error("Grabbed an output before get")
+	}
+
+	if er := jpps.grabOutput("path", &addrs); er == nil {
+		t.Error("Grabbed an unbound parameter")
+	}
+
+	if _, er := jpps.set(jailUpdate); er == nil {
+		t.Error("Set with an output bound")
+	}
+
+	_, er := jpps.get(0)
+
+	var je *JailError
+	if !errors.As(er, &je) || !errors.Is(er, ErrJailNotFound) {
+		t.Fatalf("Missing jail gave %v", er)
+	}
+
+	if je.Op != "jailparam_get" || je.Message != "jail 12 not found" {
+		t.Errorf("Unexpected JailError %+v", je)
+	}
+
+	empty := jailParamList{lib: lib}
+	if _, er := empty.get(0); er == nil {
+		t.Error("Get with no parameters")
+	}
+}
+
+func TestJailParamListArena(t *testing.T) {
+	lib := newFakeLibjail()
+
+	jpps := jailParamList{lib: lib}
+	defer jpps.release()
+
+	name := "www"
+	addrs := []net.IP{net.IPv4(192, 0, 2, 1).To4()}
+
+	if er := jpps.bindParameter("name", &name); er != nil {
+		t.Fatal(er)
+	}
+
+	if er := jpps.bindParameter("ip4.addr", addrs); er != nil {
+		t.Fatal(er)
+	}
+
+	if er := jpps.bindParameter("ip6.addr", []net.IP{}); er != nil {
+		t.Fatal(er)
+	}
+
+	/* The values were copied when they were bound. */
+	name = "changed"
+	addrs[0][3] = 99
+
+	if raw := arenaBytes(jpps.nameMapping["name"].value, jpps.nameMapping["name"].valueLen); string(raw) != "www\x00" {
+		t.Errorf("name is %q in the arena", raw)
+	}
+
+	if raw := arenaBytes(jpps.nameMapping["ip4.addr"].value, 4); raw[3] != 1 {
+		t.Errorf("ip4.addr is %v in the arena", raw)
+	}
+
+	if jp := jpps.nameMapping["ip6.addr"]; jp.value != nil || jp.valueLen != 0 {
+		t.Errorf("Empty ip6.addr should be passed as NULL, got %v/%d", jp.value, jp.valueLen)
+	}
+
+	if len(jpps.arena.blocks) != 2 {
+		t.Errorf("Arena has %d blocks, expected 2", len(jpps.arena.blocks))
+	}
+
+	jpps.release()
+
+	if len(jpps.arena.blocks) != 0 || jpps.params != nil {
+		t.Error("Release left values behind")
+	}
+}
+
+func TestJailParamListNoLibjail(t *testing.T) {
+	if jailLib != nil {
+		t.Skip("libjail is available")
+	}
+
+	jpps := jailParamList{}
+	if er := jpps.bindParameter("jid", 1); er != errNoLibjail {
+		t.Errorf("Binding without libjail gave %v", er)
+	}
+}
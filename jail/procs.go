@@ -0,0 +1,222 @@
+//go:build freebsd
+
+package jail
+
+/*
+#cgo LDFLAGS: -lutil
+#include <sys/param.h>
+#include <sys/jail.h>
+#include <sys/types.h>
+#include <sys/sysctl.h>
+#include <sys/user.h>
+#include <libutil.h>
+#include <stdlib.h>
+
+struct kinfo_proc* kinfo_offset(struct kinfo_proc *v, int i) {
+	return v + i;
+}
+*/
+import "C"
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// hostProcs implements jailProcs for a real jail.
+type hostProcs struct {
+	jail *Jail
+}
+
+func (hp hostProcs) exec(ctx context.Context, args []string) error {
+	cmd := hp.jail.Exec(args[0], args[1:]...)
+
+	if er := cmd.Start(); er != nil {
+		return er
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case er := <-done:
+		return er
+
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// pids lists the processes in the jail and the jails nested inside it. It's
+// only used to tell whether the jail has emptied out; signals are sent by
+// signalAll.
+func (hp hostProcs) pids() ([]int, error) {
+	pids, er := allJailPids()
+	if er != nil {
+		return nil, er
+	}
+
+	jails, er := enumerateJails(jailDying)
+	if er != nil {
+		return nil, er
+	}
+
+	inJail := append([]int{}, pids[hp.jail.jid]...)
+
+	for _, jid := range descendantJids(jailTree(jails), hp.jail.jid) {
+		inJail = append(inJail, pids[jid]...)
+	}
+
+	return inJail, nil
+}
+
+// allJailPids returns the PIDs of every jailed process, keyed by JID.
+func allJailPids() (map[int][]int, error) {
+	var count C.int
+
+	procs, er := C.kinfo_getallproc(&count)
+	if procs == nil {
+		return nil, er
+	}
+	defer C.free(unsafe.Pointer(procs))
+
+	pids := map[int][]int{}
+
+	for i := 0; i < int(count); i++ {
+		proc := C.kinfo_offset(procs, C.int(i))
+
+		if jid := int(proc.ki_jid); jid != 0 {
+			pids[jid] = append(pids[jid], int(proc.ki_pid))
+		}
+	}
+
+	return pids, nil
+}
+
+// procJid returns the JID of the jail a process is in, or 0 if it isn't
+// jailed.
+func procJid(pid int) (int, error) {
+	proc, er := C.kinfo_getproc(C.pid_t(pid))
+	if proc == nil {
+		return 0, er
+	}
+	defer C.free(unsafe.Pointer(proc))
+
+	return int(proc.ki_jid), nil
+}
+
+// hostKinfoLayout is the layout of struct kinfo_proc on this machine.
+var hostKinfoLayout = kinfoProcLayout{
+	order:     nativeEndian,
+	size:      int(C.sizeof_struct_kinfo_proc),
+	pid:       int(unsafe.Offsetof(C.struct_kinfo_proc{}.ki_pid)),
+	ppid:      int(unsafe.Offsetof(C.struct_kinfo_proc{}.ki_ppid)),
+	uid:       int(unsafe.Offsetof(C.struct_kinfo_proc{}.ki_uid)),
+	jid:       int(unsafe.Offsetof(C.struct_kinfo_proc{}.ki_jid)),
+	rssize:    int(unsafe.Offsetof(C.struct_kinfo_proc{}.ki_rssize)),
+	rssizeLen: int(unsafe.Sizeof(C.struct_kinfo_proc{}.ki_rssize)),
+	comm:      int(unsafe.Offsetof(C.struct_kinfo_proc{}.ki_comm)),
+	commLen:   len(C.struct_kinfo_proc{}.ki_comm),
+}
+
+// kernProcs reads the kern.proc.proc sysctl, which is an array of struct
+// kinfo_proc with one entry per process (rather than per thread).
+func kernProcs() ([]byte, error) {
+	mib := [3]C.int{C.CTL_KERN, C.KERN_PROC, C.KERN_PROC_PROC}
+
+	for {
+		var size C.size_t
+
+		if _, er := C.sysctl(&mib[0], C.u_int(len(mib)), nil, &size, nil, 0); er != nil {
+			return nil, er
+		}
+
+		/* Leave room for processes started between the two calls. */
+		size += size / 4
+		buf := make([]byte, size)
+
+		if _, er := C.sysctl(&mib[0], C.u_int(len(mib)), unsafe.Pointer(&buf[0]), &size, nil, 0); er == syscall.ENOMEM {
+			continue
+
+		} else if er != nil {
+			return nil, er
+		}
+
+		return buf[:size], nil
+	}
+}
+
+// Processes returns the processes running in the jail. Jails nested inside
+// this one aren't included.
+func (j *Jail) Processes() ([]Process, error) {
+	buf, er := kernProcs()
+	if er != nil {
+		return nil, er
+	}
+
+	procs, er := decodeKinfoProcs(buf, &hostKinfoLayout, uint64(os.Getpagesize()))
+	if er != nil {
+		return nil, er
+	}
+
+	return processesInJail(procs, j.jid), nil
+}
+
+func (hp hostProcs) signalAll(sig syscall.Signal) error {
+	argv, er := killHelperArgs(hp.jail.jid, sig)
+	if er != nil {
+		return er
+	}
+
+	self, er := os.Executable()
+	if er != nil {
+		return er
+	}
+
+	cmd := &exec.Cmd{Path: self, Args: argv}
+
+	if out, er := cmd.CombinedOutput(); er != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("Unable to signal jail %d: %s", hp.jail.jid, msg)
+		}
+
+		return er
+	}
+
+	return nil
+}
+
+// runKillHelper attaches to the jail and signals everything in it, and in
+// the jails nested inside it, apart from itself. Finding nothing to signal
+// isn't a failure.
+func runKillHelper(argv []string) int {
+	conf, er := parseKillHelperArgs(argv)
+	if er != nil {
+		fmt.Fprintf(os.Stderr, "jail: %s\n", er)
+		return 1
+	}
+
+	if _, er := C.jail_attach(C.int(conf.Jid)); er != nil {
+		fmt.Fprintf(os.Stderr, "jail: jail_attach: %s\n", er)
+		return 1
+	}
+
+	if er := syscall.Kill(-1, syscall.Signal(conf.Signal)); er != nil && er != syscall.ESRCH {
+		fmt.Fprintf(os.Stderr, "jail: kill: %s\n", er)
+		return 1
+	}
+
+	return 0
+}
+
+func (hp hostProcs) remove() error {
+	return hp.jail.Destroy()
+}
@@ -0,0 +1,274 @@
+//go:build freebsd
+
+package jail
+
+/*
+#cgo LDFLAGS: -ljail -lutil
+#include <sys/param.h>
+#include <sys/jail.h>
+#include <errno.h>
+#include <grp.h>
+#include <login_cap.h>
+#include <paths.h>
+#include <pwd.h>
+#include <stdlib.h>
+#include <unistd.h>
+
+extern char **environ;
+
+static int jexec_lookup(const char *user, struct passwd **pwd, gid_t **groups, int *ngroups, const char **step) {
+	*step = "getpwnam";
+	errno = 0;
+
+	if ((*pwd = getpwnam(user)) == NULL) {
+		if (errno == 0) {
+			errno = ENOENT;
+		}
+
+		return -1;
+	}
+
+	*ngroups = sysconf(_SC_NGROUPS_MAX) + 1;
+
+	*step = "malloc";
+	if ((*groups = malloc(sizeof(gid_t) * *ngroups)) == NULL) {
+		return -1;
+	}
+
+	*step = "getgrouplist";
+	if (getgrouplist(user, (*pwd)->pw_gid, *groups, ngroups) == -1) {
+		errno = E2BIG;
+		return -1;
+	}
+
+	return 0;
+}
+
+// jexec_run does what jexec(8) does, from inside the re-exec'd helper:
+// attach to the jail, take on the requested credentials and exec the
+// command. It only returns on failure, with *step naming the failed call.
+static int jexec_run(int jid, const char *user, int host_user, const char *class, int login,
+		int use_cred, uid_t uid, gid_t gid, int ngroups, gid_t *groups,
+		char **argv, const char **step) {
+
+	static char *cleanenv[1];
+	struct passwd *pwd = NULL;
+	login_cap_t *lcap = NULL;
+	gid_t *pwgroups = NULL;
+	int pwngroups = 0, flags;
+	char *term;
+
+	if (user != NULL && host_user && jexec_lookup(user, &pwd, &pwgroups, &pwngroups, step) == -1) {
+		return -1;
+	}
+
+	*step = "jail_attach";
+	if (jail_attach(jid) == -1) {
+		return -1;
+	}
+
+	*step = "chdir";
+	if (chdir("/") == -1) {
+		return -1;
+	}
+
+	if (user != NULL && !host_user && jexec_lookup(user, &pwd, &pwgroups, &pwngroups, step) == -1) {
+		return -1;
+	}
+
+	if (login) {
+		term = getenv("TERM");
+		environ = cleanenv;
+		setenv("PATH", "/bin:/usr/bin", 1);
+
+		if (term != NULL) {
+			setenv("TERM", term, 1);
+		}
+	}
+
+	if (pwd != NULL) {
+		use_cred = 1;
+		uid = pwd->pw_uid;
+		gid = pwd->pw_gid;
+		groups = pwgroups;
+		ngroups = pwngroups;
+	}
+
+	if (use_cred) {
+		*step = "setgroups";
+		if (setgroups(ngroups, groups) == -1) {
+			return -1;
+		}
+
+		*step = "setgid";
+		if (setgid(gid) == -1) {
+			return -1;
+		}
+	}
+
+	if (use_cred || class != NULL) {
+		if (class != NULL) {
+			lcap = login_getclass(class);
+
+		} else {
+			lcap = login_getpwclass(pwd);
+		}
+
+		flags = LOGIN_SETALL & ~LOGIN_SETGROUP & ~LOGIN_SETLOGIN;
+
+		if (pwd == NULL) {
+			flags &= ~LOGIN_SETMAC;
+		}
+
+		if (!use_cred) {
+			flags &= ~LOGIN_SETUSER;
+			uid = getuid();
+		}
+
+		*step = "setusercontext";
+		if (setusercontext(lcap, pwd, uid, flags) == -1) {
+			return -1;
+		}
+
+		login_close(lcap);
+	}
+
+	if (login && pwd != NULL) {
+		setenv("HOME", pwd->pw_dir, 1);
+		setenv("SHELL", *pwd->pw_shell ? pwd->pw_shell : _PATH_BSHELL, 1);
+		setenv("USER", pwd->pw_name, 1);
+
+		*step = "chdir";
+		if (chdir(pwd->pw_dir) == -1) {
+			return -1;
+		}
+	}
+
+	*step = "execvp";
+	execvp(argv[0], argv);
+
+	return -1;
+}
+*/
+import "C"
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+/* If this process is one of the helpers, do its job before the program
+ * proper gets a chance to run. */
+func init() {
+	if len(os.Args) == 0 {
+		return
+	}
+
+	switch os.Args[0] {
+	case execHelperArg0:
+		os.Exit(runExecHelper(os.Args))
+	case ifconfigHelperArg0:
+		os.Exit(runIfconfigHelper(os.Args))
+	case killHelperArg0:
+		os.Exit(runKillHelper(os.Args))
+	}
+}
+
+func runExecHelper(argv []string) int {
+	conf, cmd, er := parseExecHelperArgs(argv)
+	if er != nil {
+		fmt.Fprintf(os.Stderr, "jail: %s\n", er)
+		return 126
+	}
+
+	opts := conf.Opts
+
+	var user, class *C.char
+
+	if opts.User != "" {
+		user = C.CString(opts.User)
+
+	} else if opts.HostUser != "" {
+		user = C.CString(opts.HostUser)
+	}
+
+	if opts.LoginClass != "" {
+		class = C.CString(opts.LoginClass)
+	}
+
+	var useCred, login, hostUser C.int
+	var uid C.uid_t
+	var gid C.gid_t
+	groups := []C.gid_t{0}
+
+	if opts.Credential != nil {
+		useCred = 1
+		uid = C.uid_t(opts.Credential.Uid)
+		gid = C.gid_t(opts.Credential.Gid)
+		groups = []C.gid_t{gid}
+
+		for _, group := range opts.Credential.Groups {
+			groups = append(groups, C.gid_t(group))
+		}
+	}
+
+	if opts.HostUser != "" {
+		hostUser = 1
+	}
+
+	if opts.Login {
+		login = 1
+	}
+
+	cargv := make([]*C.char, len(cmd)+1)
+	for i := range cmd {
+		cargv[i] = C.CString(cmd[i])
+	}
+
+	var step *C.char
+
+	/* Only returns on failure; nothing is freed since we're about to exit. */
+	_, er = C.jexec_run(C.int(conf.Jid), user, hostUser, class, login,
+		useCred, uid, gid, C.int(len(groups)), &groups[0], &cargv[0], &step)
+
+	fmt.Fprintf(os.Stderr, "jail: %s: %s\n", C.GoString(step), er)
+
+	if er == syscall.ENOENT && C.GoString(step) == "execvp" {
+		return 127
+	}
+
+	return 126
+}
+
+// Command returns an *exec.Cmd that runs name inside the jail with the
+// identity described by opts. As with exec.Command, setting up the
+// environment, stdio and so on and then starting the command is left to the
+// caller; name is looked up in the PATH from the command's environment,
+// inside the jail.
+//
+// Rather than relying on jexec(8), the command re-executes the current
+// binary, which attaches to the jail, drops privileges and then execs name
+// before any other code in the program runs. If the helper fails before
+// exec'ing name, it writes the reason to stderr and exits with status 126
+// (or 127 if name wasn't found).
+func (j *Jail) Command(opts ExecOptions, name string, args ...string) *exec.Cmd {
+	cmd := &exec.Cmd{}
+
+	argv, er := execHelperArgs(j.jid, opts, name, args)
+	if er != nil {
+		cmd.Err = er
+		return cmd
+	}
+
+	self, er := os.Executable()
+	if er != nil {
+		cmd.Err = er
+		return cmd
+	}
+
+	cmd.Path = self
+	cmd.Args = argv
+
+	return cmd
+}
@@ -0,0 +1,99 @@
+package jail
+
+import (
+	"fmt"
+)
+
+// EnforceStatfs is the value of the enforce_statfs parameter, which controls
+// which mount points are visible from inside a jail.
+type EnforceStatfs int
+
+const (
+	// EnforceStatfsNone shows every mount point on the system.
+	EnforceStatfsNone EnforceStatfs = 0
+
+	// EnforceStatfsBelowRoot shows only the mount points below the jail's
+	// root, with the jail's root stripped from their paths.
+	EnforceStatfsBelowRoot EnforceStatfs = 1
+
+	// EnforceStatfsRoot shows only the mount point the jail's root is on.
+	// This is the default.
+	EnforceStatfsRoot EnforceStatfs = 2
+)
+
+func (es EnforceStatfs) String() string {
+	switch es {
+	case EnforceStatfsNone:
+		return "none"
+
+	case EnforceStatfsBelowRoot:
+		return "below-root"
+
+	case EnforceStatfsRoot:
+		return "root"
+	}
+
+	return fmt.Sprintf("EnforceStatfs(%d)", int(es))
+}
+
+// Valid returns true if es is one of the values the kernel understands.
+func (es EnforceStatfs) Valid() bool {
+	return es >= EnforceStatfsNone && es <= EnforceStatfsRoot
+}
+
+const (
+	// SecureLevelMin is the "permanently insecure" level, at which the
+	// system always runs as if at level 0.
+	SecureLevelMin = -1
+
+	// SecureLevelMax is the highest meaningful securelevel; see
+	// security(7) for what each level restricts.
+	SecureLevelMax = 3
+)
+
+func checkSecureLevel(level int) error {
+	if level < SecureLevelMin || level > SecureLevelMax {
+		return fmt.Errorf("Parameter `securelevel' must be between %d and %d, not %d", SecureLevelMin, SecureLevelMax, level)
+	}
+
+	return nil
+}
+
+// checkSecureLevelRaise checks that changing a jail's securelevel from
+// current to level hardens it. Like the host's kern.securelevel, a jail's
+// securelevel is only ever raised; lowering it takes a restart.
+func checkSecureLevelRaise(current, level int) error {
+	if er := checkSecureLevel(level); er != nil {
+		return er
+	}
+
+	if level < current {
+		return fmt.Errorf("Parameter `securelevel' can only be raised, not lowered from %d to %d", current, level)
+	}
+
+	return nil
+}
+
+func checkEnforceStatfs(es EnforceStatfs) error {
+	if !es.Valid() {
+		return fmt.Errorf("Parameter `enforce_statfs' must be 0, 1 or 2, not %d", int(es))
+	}
+
+	return nil
+}
+
+func (spec *JailSpec) validateSecurity() error {
+	if spec.SecureLevel != nil {
+		if er := checkSecureLevel(*spec.SecureLevel); er != nil {
+			return er
+		}
+	}
+
+	if spec.EnforceStatfs != nil {
+		if er := checkEnforceStatfs(*spec.EnforceStatfs); er != nil {
+			return er
+		}
+	}
+
+	return nil
+}
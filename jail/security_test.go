@@ -0,0 +1,70 @@
+package jail
+
+import (
+	"testing"
+)
+
+func TestEnforceStatfs(t *testing.T) {
+	for es, name := range map[EnforceStatfs]string{
+		EnforceStatfsNone:      "none",
+		EnforceStatfsBelowRoot: "below-root",
+		EnforceStatfsRoot:      "root",
+		EnforceStatfs(5):       "EnforceStatfs(5)",
+	} {
+		if es.String() != name {
+			t.Errorf("%d is named %s, expected %s", int(es), es, name)
+		}
+	}
+
+	for _, es := range []EnforceStatfs{-1, 3} {
+		if es.Valid() || checkEnforceStatfs(es) == nil {
+			t.Errorf("%d should be invalid", int(es))
+		}
+	}
+
+	if er := checkEnforceStatfs(EnforceStatfsBelowRoot); er != nil {
+		t.Error(er)
+	}
+}
+
+func TestSecureLevelRaise(t *testing.T) {
+	for _, tc := range []struct {
+		current, level int
+		ok             bool
+	}{
+		{-1, 0, true},
+		{0, 3, true},
+		{2, 2, true},
+		{3, 1, false},
+		{1, -1, false},
+		{0, 4, false},
+		{-2, -2, false},
+	} {
+		er := checkSecureLevelRaise(tc.current, tc.level)
+
+		if tc.ok && er != nil {
+			t.Errorf("Raising %d to %d failed: %s", tc.current, tc.level, er)
+
+		} else if !tc.ok && er == nil {
+			t.Errorf("Raising %d to %d should have failed", tc.current, tc.level)
+		}
+	}
+}
+
+func TestJailSpecValidateSecurity(t *testing.T) {
+	level, es := 2, EnforceStatfsBelowRoot
+
+	if er := (&JailSpec{SecureLevel: &level, EnforceStatfs: &es}).validateSecurity(); er != nil {
+		t.Error(er)
+	}
+
+	level, es = 9, EnforceStatfs(3)
+
+	if er := (&JailSpec{SecureLevel: &level}).validateSecurity(); er == nil {
+		t.Error("Out of range securelevel accepted")
+	}
+
+	if er := (&JailSpec{EnforceStatfs: &es}).validateSecurity(); er == nil {
+		t.Error("Out of range enforce_statfs accepted")
+	}
+}
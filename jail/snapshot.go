@@ -0,0 +1,158 @@
+package jail
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// SnapshotVersion is the version of the Snapshot format written by this
+// package. Snapshots from newer versions are rejected.
+const SnapshotVersion = 1
+
+// Snapshot is a serializable description of a jail, for recreating an
+// equivalent jail elsewhere. It's stable when encoded as JSON.
+type Snapshot struct {
+	Version int `json:"version"`
+
+	// Params holds every settable jail parameter the kernel reported, keyed
+	// by its jail(8) name, with the same Go types Jail.Get uses.
+	Params map[string]interface{} `json:"params"`
+
+	// Limits are the jail's rctl(8) rules, in rctl syntax.
+	Limits []string `json:"limits,omitempty"`
+
+	// CPUs is the list of CPUs the jail may run on, e.g. "0-3,8".
+	CPUs string `json:"cpus,omitempty"`
+
+	// Mounts are the filesystems mounted under the jail's root. They're
+	// recorded for reference but not restored, since their sources are
+	// specific to the host.
+	Mounts []SnapshotMount `json:"mounts,omitempty"`
+}
+
+// SnapshotMount is a filesystem mounted under a jail's root.
+type SnapshotMount struct {
+	FsType string `json:"fstype"`
+	Source string `json:"source"`
+
+	// Target is relative to the jail's root.
+	Target string `json:"target"`
+	Flags  uint64 `json:"flags"`
+}
+
+func (snap *Snapshot) UnmarshalJSON(data []byte) error {
+	/* Parameter values need the parameter table to be decoded into the
+	 * right types, so they're picked up raw. */
+	type rawSnapshot Snapshot
+
+	raw := struct {
+		*rawSnapshot
+		Params map[string]json.RawMessage `json:"params"`
+	}{rawSnapshot: (*rawSnapshot)(snap)}
+
+	if er := json.Unmarshal(data, &raw); er != nil {
+		return er
+	}
+
+	/* Don't try to make sense of parameters from a format we don't know. */
+	if snap.Version < 1 || snap.Version > SnapshotVersion {
+		return fmt.Errorf("Unsupported snapshot version %d", snap.Version)
+	}
+
+	snap.Params = map[string]interface{}{}
+
+	for name, value := range raw.Params {
+		ty, er := snapshotParamType(name)
+		if er != nil {
+			return er
+		}
+
+		ptr := reflect.New(ty)
+		if er := json.Unmarshal(value, ptr.Interface()); er != nil {
+			return fmt.Errorf("Parameter `%s' must be a %s", name, ty)
+		}
+
+		snap.Params[name] = ptr.Elem().Interface()
+	}
+
+	return snap.validate()
+}
+
+func snapshotParamType(name string) (reflect.Type, error) {
+	ty := paramTypeMapping[name]
+	if ty == nil {
+		return nil, fmt.Errorf("Unknown jail parameter `%s'", name)
+	}
+
+	if readOnlyParams[name] {
+		return nil, fmt.Errorf("Jail parameter `%s' is read-only", name)
+	}
+
+	return ty, nil
+}
+
+// validate checks the snapshot's version and that each of its parameters
+// is settable and of the right type.
+func (snap *Snapshot) validate() error {
+	if snap.Version < 1 || snap.Version > SnapshotVersion {
+		return fmt.Errorf("Unsupported snapshot version %d", snap.Version)
+	}
+
+	if len(snap.Params) == 0 {
+		return fmt.Errorf("Snapshot has no jail parameters")
+	}
+
+	names := []string{}
+	for name := range snap.Params {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		ty, er := snapshotParamType(name)
+		if er != nil {
+			return er
+		}
+
+		value := snap.Params[name]
+
+		if reflect.TypeOf(value) != ty {
+			return fmt.Errorf("Parameter `%s' must be a %s", name, ty)
+		}
+
+		if sys, ok := value.(JailSys); ok && sys != JailSysNew && sys != JailSysInherit && sys != JailSysDisable {
+			return fmt.Errorf("Parameter `%s' must be one of new, inherit or disable", name)
+		}
+
+		if name == "securelevel" {
+			if er := checkSecureLevel(value.(int)); er != nil {
+				return er
+			}
+
+		} else if name == "enforce_statfs" {
+			if er := checkEnforceStatfs(EnforceStatfs(value.(int))); er != nil {
+				return er
+			}
+		}
+	}
+
+	return nil
+}
+
+// snapshotParamNames returns the parameters a snapshot captures: every
+// settable one except jid, which is up to the host the jail is restored on.
+func snapshotParamNames() []string {
+	names := []string{}
+
+	for name := range paramTypeMapping {
+		if !readOnlyParams[name] && name != "jid" {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,100 @@
+package jail
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	snap := &Snapshot{
+		Version: SnapshotVersion,
+		Params: map[string]interface{}{
+			"name":          "www",
+			"path":          "/jails/www",
+			"host.hostname": "www.example.org",
+			"ip4.addr":      []net.IP{net.ParseIP("192.0.2.10")},
+			"ip6":           JailSysDisable,
+			"securelevel":   2,
+			"allow.mount":   true,
+			"persist":       true,
+		},
+		Limits: []string{"jail:www:memoryuse:deny=1073741824"},
+		CPUs:   "0-3",
+		Mounts: []SnapshotMount{{FsType: "devfs", Source: "devfs", Target: "/dev", Flags: 0x10}},
+	}
+
+	if er := snap.validate(); er != nil {
+		t.Fatal(er)
+	}
+
+	data, er := json.Marshal(snap)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if !strings.Contains(string(data), `"ip4.addr":["192.0.2.10"]`) {
+		t.Errorf("Addresses should be written as strings: %s", data)
+	}
+
+	restored := &Snapshot{}
+	if er := json.Unmarshal(data, restored); er != nil {
+		t.Fatal(er)
+	}
+
+	if er := restored.validate(); er != nil {
+		t.Fatal(er)
+	}
+
+	addrs := restored.Params["ip4.addr"].([]net.IP)
+	if len(addrs) != 1 || !addrs[0].Equal(net.ParseIP("192.0.2.10")) {
+		t.Errorf("Unexpected addresses %v", addrs)
+	}
+
+	/* Addresses come back in their 16-byte form, which is just as good. */
+	restored.Params["ip4.addr"] = snap.Params["ip4.addr"]
+
+	if !reflect.DeepEqual(restored, snap) {
+		t.Errorf("Snapshot didn't survive the round trip:\n%#v\n%#v", restored, snap)
+	}
+}
+
+func TestSnapshotInvalid(t *testing.T) {
+	for _, data := range []string{
+		`{"version": 0, "params": {"name": "www"}}`,
+		`{"version": 99, "params": {"name": "www"}}`,
+		`{"version": 1, "params": {"bogus": 1}}`,
+		`{"version": 1, "params": {"dying": true}}`,
+		`{"version": 1, "params": {"securelevel": "high"}}`,
+		`{"version": 1, "params": {"ip4": "sometimes"}}`,
+		`{"version": 1, "params": {"securelevel": 7}}`,
+		`{"version": 1, "params": {"enforce_statfs": 3}}`,
+		`{"version": 1, "params": {"ip4.addr": ["not an address"]}}`,
+	} {
+		snap := &Snapshot{}
+		if er := json.Unmarshal([]byte(data), snap); er == nil {
+			t.Errorf("Expected %s to be rejected", data)
+		}
+	}
+
+	for _, snap := range []*Snapshot{
+		{Version: 1},
+		{Version: 1, Params: map[string]interface{}{"securelevel": "3"}},
+		{Version: 1, Params: map[string]interface{}{"parent": 1}},
+		{Version: 2, Params: map[string]interface{}{"name": "www"}},
+	} {
+		if er := snap.validate(); er == nil {
+			t.Errorf("Expected %#v to be rejected", snap)
+		}
+	}
+}
+
+func TestSnapshotParamNames(t *testing.T) {
+	for _, name := range snapshotParamNames() {
+		if readOnlyParams[name] || name == "jid" {
+			t.Errorf("Snapshots shouldn't capture `%s'", name)
+		}
+	}
+}
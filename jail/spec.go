@@ -0,0 +1,117 @@
+package jail
+
+import (
+	"net"
+	"reflect"
+)
+
+// JailSys is the value of one of the jailsys parameters (host, ip4, ip6 and
+// vnet), which control whether a jail gets its own copy of a subsystem,
+// shares its parent's, or has it disabled entirely.
+type JailSys string
+
+const (
+	JailSysNew     JailSys = "new"
+	JailSysInherit JailSys = "inherit"
+	JailSysDisable JailSys = "disable"
+)
+
+// JailSpec describes a jail for CreateJail. Each field corresponds to the
+// jail parameter named in its tag (see jail(8) for what they do), and all of
+// them are handed to the kernel in a single call, so the jail never exists
+// without its restrictions in place.
+//
+// Fields left at their zero value are not passed, leaving the kernel default
+// in place, with two exceptions: the allow.* flags are always passed (so an
+// unset flag is denied, regardless of the security.jail.* sysctl defaults)
+// and Persist defaults to true. Pointer fields are used where the zero value
+// is itself meaningful.
+//
+// The read-only parameters (lastjid, parent, children.cur, cpuset.id and
+// dying) can't be set and have no fields. Fields without a tag aren't jail
+// parameters at all, but things CreateJail sets up alongside the jail.
+type JailSpec struct {
+	// Jid requests a specific jail ID; by default the next free one is used.
+	Jid  int    `jail:"jid"`
+	Name string `jail:"name"`
+	Path string `jail:"path"`
+
+	// Persist defaults to true; see the Jail documentation.
+	Persist *bool `jail:"persist"`
+
+	Host           JailSys `jail:"host"`
+	HostName       string  `jail:"host.hostname"`
+	HostDomainName string  `jail:"host.domainname"`
+	HostUuid       string  `jail:"host.hostuuid"`
+	HostId         int     `jail:"host.hostid"`
+
+	Ip4         JailSys  `jail:"ip4"`
+	Ip4Addrs    []net.IP `jail:"ip4.addr"`
+	Ip4SAddrSel *bool    `jail:"ip4.saddrsel"`
+
+	Ip6         JailSys  `jail:"ip6"`
+	Ip6Addrs    []net.IP `jail:"ip6.addr"`
+	Ip6SAddrSel *bool    `jail:"ip6.saddrsel"`
+
+	// Vnet set to JailSysNew gives the jail its own network stack, which
+	// starts out with nothing but a loopback interface; see Epairs.
+	Vnet JailSys `jail:"vnet"`
+
+	// Epairs are created and plumbed into a VNET jail once it exists, and
+	// destroyed along with it. They aren't a jail parameter, so if the
+	// plumbing fails the half-made jail is destroyed.
+	Epairs []VnetEpair
+
+	// Mounts are mounted under Path before the jail is created, and
+	// unmounted when it's destroyed. If any of them fail, the ones already
+	// mounted are unmounted again and the jail isn't created.
+	Mounts MountPlan
+
+	SecureLevel   *int           `jail:"securelevel"`
+	ChildrenMax   int            `jail:"children.max"`
+	EnforceStatfs *EnforceStatfs `jail:"enforce_statfs"`
+
+	AllowSetHostname bool `jail:"allow.set_hostname"`
+	AllowSysvIpc     bool `jail:"allow.sysvipc"`
+	AllowRawSockets  bool `jail:"allow.raw_sockets"`
+	AllowChflags     bool `jail:"allow.chflags"`
+	AllowMount       bool `jail:"allow.mount"`
+	AllowQuotas      bool `jail:"allow.quotas"`
+	AllowSocketAf    bool `jail:"allow.socket_af"`
+}
+
+// params returns the jail parameters described by the spec, in the form
+// jailParamList.bindParameters expects. Values are pointers into the spec.
+func (spec *JailSpec) params() map[string]interface{} {
+	params := map[string]interface{}{}
+
+	val := reflect.ValueOf(spec).Elem()
+	ty := val.Type()
+
+	for i := 0; i < ty.NumField(); i++ {
+		name := ty.Field(i).Tag.Get("jail")
+		field := val.Field(i)
+
+		if name == "" || (field.Kind() != reflect.Bool && field.IsZero()) {
+			continue
+		}
+
+		if field.Kind() == reflect.Ptr {
+			params[name] = field.Interface()
+
+		} else {
+			params[name] = field.Addr().Interface()
+		}
+	}
+
+	if _, ok := params["persist"]; !ok {
+		params["persist"] = true
+	}
+
+	/* Like NewJail, default the hostname to the name. */
+	if _, ok := params["host.hostname"]; !ok && spec.Name != "" {
+		params["host.hostname"] = &spec.Name
+	}
+
+	return params
+}
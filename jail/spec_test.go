@@ -0,0 +1,98 @@
+package jail
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJailSpecCoversParams(t *testing.T) {
+	covered := map[string]bool{}
+	ty := reflect.TypeOf(JailSpec{})
+
+	for i := 0; i < ty.NumField(); i++ {
+		name := ty.Field(i).Tag.Get("jail")
+		if name == "" {
+			continue
+		}
+
+		paramTy := builtinParamTypes[name]
+		if paramTy == nil {
+			t.Errorf("Field %s maps to unknown parameter `%s'", ty.Field(i).Name, name)
+			continue
+		}
+
+		fieldTy := ty.Field(i).Type
+		if fieldTy.Kind() == reflect.Ptr {
+			fieldTy = fieldTy.Elem()
+		}
+
+		if fieldTy.Kind() != paramTy.Kind() {
+			t.Errorf("Field %s is a %s but `%s' is a %s", ty.Field(i).Name, fieldTy, name, paramTy)
+		}
+
+		covered[name] = true
+	}
+
+	for name := range builtinParamTypes {
+		if !covered[name] && !readOnlyParams[name] {
+			t.Errorf("JailSpec has no field for `%s'", name)
+		}
+	}
+}
+
+func TestJailSpecParams(t *testing.T) {
+	level := 3
+	spec := &JailSpec{
+		Name:        "locked",
+		Path:        "/jails/locked",
+		Ip4Addrs:    []net.IP{net.IPv4(10, 0, 0, 1).To4()},
+		Ip6:         JailSysDisable,
+		SecureLevel: &level,
+		AllowMount:  true,
+	}
+
+	params := spec.params()
+
+	for name, value := range map[string]interface{}{
+		"name":              "locked",
+		"host.hostname":     "locked",
+		"path":              "/jails/locked",
+		"persist":           true,
+		"ip6":               JailSysDisable,
+		"securelevel":       3,
+		"allow.mount":       true,
+		"allow.raw_sockets": false,
+	} {
+		param, ok := params[name]
+		if !ok {
+			t.Errorf("Parameter `%s' missing", name)
+			continue
+		}
+
+		if got := reflect.Indirect(reflect.ValueOf(param)).Interface(); got != value {
+			t.Errorf("Parameter `%s' is %v, expected %v", name, got, value)
+		}
+	}
+
+	for _, name := range []string{"jid", "host.domainname", "ip4", "ip6.addr", "ip4.saddrsel", "children.max", "enforce_statfs"} {
+		if _, ok := params[name]; ok {
+			t.Errorf("Unset parameter `%s' should not be passed", name)
+		}
+	}
+
+	for name := range builtinParamTypes {
+		if strings.HasPrefix(name, "allow.") {
+			if _, ok := params[name]; !ok {
+				t.Errorf("Parameter `%s' should always be passed", name)
+			}
+		}
+	}
+
+	/* Values point back into the spec. */
+	spec.Path = "/elsewhere"
+	if path := reflect.Indirect(reflect.ValueOf(params["path"])).String(); path != "/elsewhere" {
+		t.Errorf("params should reference the spec, got %s", path)
+	}
+}
@@ -0,0 +1,202 @@
+package jail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultStopTimeout      = 10 * time.Second
+	defaultStopPollInterval = 100 * time.Millisecond
+)
+
+// StopOptions controls how Stop shuts down a jail.
+type StopOptions struct {
+	// ExecStop is an optional command (and arguments) run inside the jail
+	// before any signals are sent, like jail(8)'s exec.stop -- typically
+	// {"/bin/sh", "/etc/rc.shutdown"}.
+	ExecStop []string
+
+	// Timeout is how long to wait for processes to exit after SIGTERM
+	// before resorting to SIGKILL. Defaults to 10 seconds.
+	Timeout time.Duration
+
+	// PollInterval is how often to check whether the jail has emptied out.
+	// Defaults to 100ms.
+	PollInterval time.Duration
+}
+
+// StopStage identifies the stage at which a jail finished shutting down.
+type StopStage int
+
+const (
+	// StoppedByExec means every process exited after ExecStop ran, without
+	// being signalled.
+	StoppedByExec StopStage = iota
+
+	// StoppedByTerm means every process exited within the timeout after
+	// being sent SIGTERM (or there were none to begin with).
+	StoppedByTerm
+
+	// StoppedByKill means processes were still running after the timeout
+	// and had to be sent SIGKILL.
+	StoppedByKill
+)
+
+func (stage StopStage) String() string {
+	switch stage {
+	case StoppedByExec:
+		return "exec.stop"
+	case StoppedByTerm:
+		return "SIGTERM"
+	case StoppedByKill:
+		return "SIGKILL"
+	}
+
+	return "unknown"
+}
+
+// jailProcs is what stopJail needs to manage the processes in a jail,
+// including those in the jails nested inside it.
+type jailProcs interface {
+	exec(ctx context.Context, args []string) error
+	pids() ([]int, error)
+
+	// signalAll sends sig to every process in the jail from inside it, so
+	// a PID that's been reused since pids was called can't be hit. It
+	// returns ESRCH if there was nothing to signal.
+	signalAll(sig syscall.Signal) error
+
+	remove() error
+}
+
+// stopJail drives a jail through shutdown: exec.stop, SIGTERM, a grace
+// period and then SIGKILL, after which the jail is removed. If ctx is done
+// before the jail has emptied out, it skips straight to SIGKILL.
+func stopJail(ctx context.Context, procs jailProcs, opts StopOptions) (StopStage, error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultStopTimeout
+	}
+
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = defaultStopPollInterval
+	}
+
+	if len(opts.ExecStop) > 0 && ctx.Err() == nil {
+		if er := procs.exec(ctx, opts.ExecStop); er != nil && ctx.Err() == nil {
+			return StoppedByExec, er
+		}
+
+		pids, er := procs.pids()
+		if er != nil {
+			return StoppedByExec, er
+		}
+
+		if len(pids) == 0 {
+			return StoppedByExec, procs.remove()
+		}
+	}
+
+	if ctx.Err() == nil {
+		empty, er := signalJail(procs, syscall.SIGTERM)
+		if er != nil {
+			return StoppedByTerm, er
+
+		} else if empty {
+			return StoppedByTerm, procs.remove()
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		deadline := time.NewTimer(timeout)
+		defer deadline.Stop()
+
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				break wait
+
+			case <-deadline.C:
+				break wait
+
+			case <-ticker.C:
+				pids, er := procs.pids()
+				if er != nil {
+					return StoppedByTerm, er
+				}
+
+				if len(pids) == 0 {
+					return StoppedByTerm, procs.remove()
+				}
+			}
+		}
+	}
+
+	if _, er := signalJail(procs, syscall.SIGKILL); er != nil {
+		return StoppedByKill, er
+	}
+
+	return StoppedByKill, procs.remove()
+}
+
+// signalJail sends sig to every process in the jail, reporting whether there
+// were any processes at all. Processes that exit before they can be
+// signalled are ignored.
+func signalJail(procs jailProcs, sig syscall.Signal) (empty bool, er error) {
+	pids, er := procs.pids()
+	if er != nil {
+		return false, er
+	}
+
+	if len(pids) == 0 {
+		return true, nil
+	}
+
+	if er := procs.signalAll(sig); er != nil && er != syscall.ESRCH {
+		return false, er
+	}
+
+	return false, nil
+}
+
+// Processes are signalled from a re-exec'd helper attached to the jail,
+// which does what `jexec kill -TERM -1` would. The helper is recognized by
+// its argv[0]; argv[1] is the encoded killHelperConf.
+const killHelperArg0 = "freebsd-jail-kill"
+
+type killHelperConf struct {
+	Jid    int
+	Signal int
+}
+
+func killHelperArgs(jid int, sig syscall.Signal) ([]string, error) {
+	conf, er := json.Marshal(killHelperConf{Jid: jid, Signal: int(sig)})
+	if er != nil {
+		return nil, er
+	}
+
+	return []string{killHelperArg0, string(conf)}, nil
+}
+
+func parseKillHelperArgs(argv []string) (conf killHelperConf, er error) {
+	if len(argv) != 2 || argv[0] != killHelperArg0 {
+		return conf, fmt.Errorf("Malformed kill helper arguments")
+	}
+
+	if er := json.Unmarshal([]byte(argv[1]), &conf); er != nil {
+		return conf, er
+	}
+
+	if conf.Jid <= 0 || conf.Signal <= 0 {
+		return conf, fmt.Errorf("Malformed kill helper arguments")
+	}
+
+	return conf, nil
+}
@@ -0,0 +1,216 @@
+package jail
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeProcs is a scripted jail: each process either exits on SIGTERM or
+// ignores it, and exec.stop can be made to stop everything or fail.
+type fakeProcs struct {
+	mu         sync.Mutex
+	running    map[int]bool
+	stubborn   map[int]bool
+	execKills  bool
+	execError  error
+	execRan    []string
+	signalsHit []syscall.Signal
+	removed    bool
+}
+
+func newFakeProcs(pids ...int) *fakeProcs {
+	fp := &fakeProcs{running: map[int]bool{}, stubborn: map[int]bool{}}
+
+	for _, pid := range pids {
+		fp.running[pid] = true
+	}
+
+	return fp
+}
+
+func (fp *fakeProcs) exec(ctx context.Context, args []string) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	fp.execRan = args
+
+	if fp.execKills {
+		fp.running = map[int]bool{}
+	}
+
+	return fp.execError
+}
+
+func (fp *fakeProcs) pids() ([]int, error) {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	pids := []int{}
+	for pid := range fp.running {
+		pids = append(pids, pid)
+	}
+
+	return pids, nil
+}
+
+func (fp *fakeProcs) signalAll(sig syscall.Signal) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	if len(fp.running) == 0 {
+		return syscall.ESRCH
+	}
+
+	for pid := range fp.running {
+		fp.signalsHit = append(fp.signalsHit, sig)
+
+		if sig == syscall.SIGKILL || !fp.stubborn[pid] {
+			delete(fp.running, pid)
+		}
+	}
+
+	return nil
+}
+
+func (fp *fakeProcs) remove() error {
+	fp.removed = true
+	return nil
+}
+
+var fastStop = StopOptions{Timeout: 50 * time.Millisecond, PollInterval: time.Millisecond}
+
+func TestStopByExec(t *testing.T) {
+	fp := newFakeProcs(10, 11)
+	fp.execKills = true
+
+	opts := fastStop
+	opts.ExecStop = []string{"/bin/sh", "/etc/rc.shutdown"}
+
+	stage, er := stopJail(context.Background(), fp, opts)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if stage != StoppedByExec {
+		t.Errorf("Stopped by %s, expected exec.stop", stage)
+	}
+
+	if !reflect.DeepEqual(fp.execRan, opts.ExecStop) {
+		t.Errorf("exec.stop ran %v", fp.execRan)
+	}
+
+	if len(fp.signalsHit) != 0 || !fp.removed {
+		t.Errorf("Expected no signals and removal, got %v (removed: %v)", fp.signalsHit, fp.removed)
+	}
+}
+
+func TestStopByTerm(t *testing.T) {
+	fp := newFakeProcs(10, 11)
+
+	stage, er := stopJail(context.Background(), fp, fastStop)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if stage != StoppedByTerm {
+		t.Errorf("Stopped by %s, expected SIGTERM", stage)
+	}
+
+	if !reflect.DeepEqual(fp.signalsHit, []syscall.Signal{syscall.SIGTERM, syscall.SIGTERM}) || !fp.removed {
+		t.Errorf("Unexpected signals %v (removed: %v)", fp.signalsHit, fp.removed)
+	}
+}
+
+func TestStopByKill(t *testing.T) {
+	fp := newFakeProcs(10, 11)
+	fp.stubborn[11] = true
+
+	stage, er := stopJail(context.Background(), fp, fastStop)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if stage != StoppedByKill {
+		t.Errorf("Stopped by %s, expected SIGKILL", stage)
+	}
+
+	expected := []syscall.Signal{syscall.SIGTERM, syscall.SIGTERM, syscall.SIGKILL}
+	if len(fp.signalsHit) != 3 || fp.signalsHit[2] != syscall.SIGKILL || !fp.removed {
+		t.Errorf("Expected signals %v, got %v (removed: %v)", expected, fp.signalsHit, fp.removed)
+	}
+}
+
+func TestStopCancelled(t *testing.T) {
+	fp := newFakeProcs(10)
+	fp.stubborn[10] = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	opts := fastStop
+	opts.Timeout = time.Hour
+	opts.ExecStop = []string{"/bin/false"}
+
+	stage, er := stopJail(ctx, fp, opts)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if stage != StoppedByKill || fp.execRan != nil {
+		t.Errorf("Cancelled stop should go straight to SIGKILL, got %s (exec: %v)", stage, fp.execRan)
+	}
+
+	if !reflect.DeepEqual(fp.signalsHit, []syscall.Signal{syscall.SIGKILL}) || !fp.removed {
+		t.Errorf("Unexpected signals %v (removed: %v)", fp.signalsHit, fp.removed)
+	}
+}
+
+func TestStopExecFails(t *testing.T) {
+	fp := newFakeProcs(10)
+	fp.execError = errors.New("rc.shutdown failed")
+
+	opts := fastStop
+	opts.ExecStop = []string{"/bin/sh", "/etc/rc.shutdown"}
+
+	if _, er := stopJail(context.Background(), fp, opts); er != fp.execError {
+		t.Errorf("Expected exec.stop's error, got %v", er)
+	}
+
+	if len(fp.signalsHit) != 0 || fp.removed {
+		t.Errorf("A failed exec.stop should leave the jail alone")
+	}
+}
+
+func TestKillHelperArgs(t *testing.T) {
+	argv, er := killHelperArgs(7, syscall.SIGTERM)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	conf, er := parseKillHelperArgs(argv)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if conf.Jid != 7 || syscall.Signal(conf.Signal) != syscall.SIGTERM {
+		t.Errorf("Round-tripped %+v", conf)
+	}
+
+	for _, argv := range [][]string{
+		{},
+		{killHelperArg0},
+		{execHelperArg0, `{"Jid":7,"Signal":15}`},
+		{killHelperArg0, "not json"},
+		{killHelperArg0, `{"Jid":0,"Signal":15}`},
+		{killHelperArg0, `{"Jid":7}`},
+	} {
+		if _, er := parseKillHelperArgs(argv); er == nil {
+			t.Errorf("Parsed malformed kill helper arguments %v", argv)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+//go:build freebsd
+
+package jail
+
+/*
+#include <sys/types.h>
+#include <sys/sysctl.h>
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// The undocumented {0, x, ...} OIDs that sysctl(8) uses to walk the tree.
+const (
+	sysctlQueryName   = 1
+	sysctlQueryNext   = 2
+	sysctlQueryOidFmt = 4
+)
+
+// hostSysctl is a sysctlReader for the running kernel.
+type hostSysctl struct{}
+
+var paramSysctl sysctlReader = hostSysctl{}
+
+func (hostSysctl) mib(name string) ([]C.int, error) {
+	nameStr := C.CString(name)
+	defer C.free(unsafe.Pointer(nameStr))
+
+	mib := make([]C.int, C.CTL_MAXNAME)
+	size := C.size_t(len(mib))
+
+	if _, er := C.sysctlnametomib(nameStr, &mib[0], &size); er != nil {
+		return nil, er
+	}
+
+	return mib[:size], nil
+}
+
+func (hostSysctl) query(which int, oid []C.int) ([]byte, error) {
+	mib := append([]C.int{0, C.int(which)}, oid...)
+	buf := make([]byte, C.BUFSIZ)
+	size := C.size_t(len(buf))
+
+	if _, er := C.sysctl(&mib[0], C.u_int(len(mib)), unsafe.Pointer(&buf[0]), &size, nil, 0); er != nil {
+		return nil, er
+	}
+
+	return buf[:size], nil
+}
+
+func (hs hostSysctl) list(node string) ([]string, error) {
+	root, er := hs.mib(node)
+	if er != nil {
+		return nil, er
+	}
+
+	names := []string{}
+	oid := root
+
+	for {
+		next, er := hs.query(sysctlQueryNext, oid)
+		if er == syscall.ENOENT {
+			break
+
+		} else if er != nil {
+			return nil, er
+		}
+
+		oid = make([]C.int, len(next)/int(unsafe.Sizeof(C.int(0))))
+		copy(oid, unsafe.Slice((*C.int)(unsafe.Pointer(&next[0])), len(oid)))
+
+		if len(oid) <= len(root) {
+			break
+		}
+
+		inside := true
+		for i := range root {
+			inside = inside && oid[i] == root[i]
+		}
+
+		if !inside {
+			break
+		}
+
+		name, er := hs.query(sysctlQueryName, oid)
+		if er != nil {
+			return nil, er
+		}
+
+		names = append(names, strings.TrimRight(string(name), "\x00"))
+	}
+
+	return names, nil
+}
+
+func (hs hostSysctl) format(name string) (kind int, format string, er error) {
+	oid, er := hs.mib(name)
+	if er != nil {
+		return 0, "", er
+	}
+
+	buf, er := hs.query(sysctlQueryOidFmt, oid)
+	if er != nil {
+		return 0, "", er
+	}
+
+	if len(buf) < 4 {
+		return 0, "", syscall.EINVAL
+	}
+
+	kind = int(*(*C.u_int)(unsafe.Pointer(&buf[0])))
+	format = strings.TrimRight(string(buf[4:]), "\x00")
+
+	return kind, format, nil
+}
@@ -0,0 +1,7 @@
+//go:build !freebsd
+
+package jail
+
+// There's no kernel to ask for parameters here, so only the static parameter
+// table is used.
+var paramSysctl sysctlReader
@@ -0,0 +1,260 @@
+//go:build freebsd
+
+package jail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// TransientJail is a jail that only lives as long as the command started in
+// it. Set up the command's stdio and environment through Cmd before calling
+// Start, as with an exec.Cmd.
+type TransientJail struct {
+	Cmd *exec.Cmd
+
+	spec *JailSpec
+	opts ExecOptions
+	argv []string
+
+	jail   *Jail
+	exited chan struct{}
+	waitEr error
+	ctxEr  error
+	reaped chan struct{}
+
+	// teardownEr is why the jail or its resources couldn't be cleaned up.
+	teardownEr error
+}
+
+// NewTransientJail prepares to run name in a new jail described by spec,
+// with the identity described by opts (see Jail.Command). Nothing is
+// created until Start. The spec's Persist is ignored.
+func NewTransientJail(spec *JailSpec, opts ExecOptions, name string, args ...string) *TransientJail {
+	tj := &TransientJail{
+		spec: spec,
+		opts: opts,
+		argv: append([]string{name}, args...),
+	}
+
+	/* The JID isn't known yet; Start fills it in. */
+	tj.Cmd = (&Jail{}).Command(opts, name, args...)
+
+	return tj
+}
+
+// Start creates the jail, starts the command in it and then drops the
+// jail's persistence, so that it goes away by itself once the command and
+// whatever it spawned have exited. If ctx is done before then, the jail is
+// removed, killing everything in it. If the command doesn't attach to the
+// jail within a few seconds, or ctx is done first, Start kills it, removes
+// the jail and returns ErrAttachTimeout (or ctx's error).
+func (tj *TransientJail) Start(ctx context.Context) error {
+	if tj.jail != nil {
+		return fmt.Errorf("Transient jail already started")
+	}
+
+	if tj.Cmd.Err != nil {
+		return tj.Cmd.Err
+	}
+
+	/* The jail has to persist until the command has attached to it, or
+	 * it'd be gone before the command got there. */
+	persist := true
+	spec := *tj.spec
+	spec.Persist = &persist
+
+	jail, er := CreateJail(&spec)
+	if er != nil {
+		return er
+	}
+
+	argv, er := execHelperArgs(jail.jid, tj.opts, tj.argv[0], tj.argv[1:])
+	if er != nil {
+		jail.Destroy()
+		return er
+	}
+
+	tj.Cmd.Args = argv
+
+	if er := tj.Cmd.Start(); er != nil {
+		jail.Destroy()
+		return er
+	}
+
+	tj.jail = jail
+	tj.exited = make(chan struct{})
+	tj.reaped = make(chan struct{})
+
+	go func() {
+		tj.waitEr = tj.Cmd.Wait()
+		close(tj.exited)
+	}()
+
+	if er := tj.waitForAttach(ctx); er != nil {
+		return tj.abort(er)
+	}
+
+	/* If the command is already gone (or never got in), this removes the
+	 * now-empty jail straight away. */
+	if er := jail.Set(map[string]interface{}{"persist": false}); er != nil && !errors.Is(er, ErrJailNotFound) {
+		return tj.abort(er)
+	}
+
+	go func() {
+		select {
+		case <-tj.exited:
+		case <-ctx.Done():
+			tj.ctxEr = ctx.Err()
+
+			/* Kill everything in the jail; its resources are released
+			 * by cleanup once the command has been reaped. */
+			if er := removeIfPresent(jail); er != nil {
+				tj.teardownEr = er
+			}
+
+			<-tj.exited
+		}
+
+		if er := tj.cleanup(); tj.teardownEr == nil {
+			tj.teardownEr = er
+		}
+
+		close(tj.reaped)
+	}()
+
+	return nil
+}
+
+// abort kills the command and tears the jail down when Start fails after
+// the command has been started, returning er along with any teardown error.
+func (tj *TransientJail) abort(er error) error {
+	tj.Cmd.Process.Kill()
+	<-tj.exited
+	tj.teardownEr = tj.cleanup()
+	close(tj.reaped)
+
+	if tj.teardownEr != nil {
+		return errors.Join(er, tj.teardownEr)
+	}
+
+	return er
+}
+
+// attachTimeout is how long Start waits for the helper to attach to the
+// jail.
+const attachTimeout = 10 * time.Second
+
+// ErrAttachTimeout is returned by Start when the command doesn't get into
+// the jail within a reasonable time (e.g. because it's blocked before
+// attaching); the command is killed and the jail removed.
+var ErrAttachTimeout = errors.New("jail: command didn't attach to the jail in time")
+
+// waitForAttach waits until the helper has attached to the jail, or has
+// exited without managing to. It gives up after attachTimeout, or as soon
+// as ctx is done.
+func (tj *TransientJail) waitForAttach(ctx context.Context) error {
+	deadline := time.NewTimer(attachTimeout)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if jid, er := procJid(tj.Cmd.Process.Pid); er == nil && jid == tj.jail.jid {
+			return nil
+		}
+
+		select {
+		case <-tj.exited:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return ErrAttachTimeout
+		case <-ticker.C:
+		}
+	}
+}
+
+// removeIfPresent removes the jail, unless it's already gone (or dying),
+// which jail_remove reports as EINVAL.
+func removeIfPresent(jail *Jail) error {
+	if er := jail.remove(); er != nil && !errors.Is(er, syscall.EINVAL) {
+		return er
+	}
+
+	return nil
+}
+
+// cleanup removes whatever the command left running in the jail, along
+// with the resources CreateJail set up for it, and returns the first
+// error from doing so.
+func (tj *TransientJail) cleanup() error {
+	/* The jail has most likely gone by itself, unless the command left
+	 * something behind. */
+	er := removeIfPresent(tj.jail)
+
+	if rer := tj.jail.releaseResources(); er == nil {
+		er = rer
+	}
+
+	return er
+}
+
+// Jail returns the running jail. It's only valid between Start and Wait.
+func (tj *TransientJail) Jail() *Jail {
+	return tj.jail
+}
+
+// Jid returns the running jail's JID, or 0 if it hasn't been started.
+func (tj *TransientJail) Jid() int {
+	if tj.jail == nil {
+		return 0
+	}
+
+	return tj.jail.jid
+}
+
+// Wait waits for the command to exit and the jail to be torn down, and
+// returns the command's exit status. A non-zero status isn't an error; if
+// the command was killed by a signal, the status is 128 plus the signal
+// number. If the jail was killed because ctx was done, ctx's error is
+// returned along with the status, as is any failure to tear down the
+// jail's mounts and interfaces.
+func (tj *TransientJail) Wait() (int, error) {
+	if tj.jail == nil {
+		return -1, fmt.Errorf("Transient jail not started")
+	}
+
+	<-tj.reaped
+
+	status, er := exitStatus(tj.waitEr)
+	if er == nil {
+		er = tj.ctxEr
+	}
+
+	if tj.teardownEr != nil {
+		er = errors.Join(er, tj.teardownEr)
+	}
+
+	return status, er
+}
+
+// RunInNewJail runs name in a new transient jail described by spec, as
+// NewTransientJail, Start and Wait do, and returns its exit status. The
+// command's stdio is left unconnected; use a TransientJail to set it up or
+// to find out the JID while it's running.
+func RunInNewJail(ctx context.Context, spec *JailSpec, opts ExecOptions, name string, args ...string) (int, error) {
+	tj := NewTransientJail(spec, opts, name, args...)
+
+	if er := tj.Start(ctx); er != nil {
+		return -1, er
+	}
+
+	return tj.Wait()
+}
@@ -0,0 +1,53 @@
+package jail
+
+import (
+	"sort"
+	"strings"
+)
+
+// Child jails have hierarchical names: a jail "db" created inside the jail
+// "www" is called "www.db" when seen from the host (and just "db" from
+// inside www).
+const jailNameSeparator = "."
+
+// splitJailName splits a hierarchical jail name into the name of its parent
+// (empty for top-level jails) and its own name relative to that parent.
+func splitJailName(name string) (parent, child string) {
+	idx := strings.LastIndex(name, jailNameSeparator)
+	if idx < 0 {
+		return "", name
+	}
+
+	return name[:idx], name[idx+1:]
+}
+
+// jailTree groups jails by the JID of their parent, with top-level jails
+// under 0. Each group is ordered by JID.
+func jailTree(jails []Jail) map[int][]Jail {
+	tree := map[int][]Jail{}
+
+	for _, jail := range jails {
+		tree[jail.parent] = append(tree[jail.parent], jail)
+	}
+
+	for _, children := range tree {
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].jid < children[j].jid
+		})
+	}
+
+	return tree
+}
+
+// descendantJids returns the JIDs of every jail nested, however deeply,
+// inside the jail jid, given the jails grouped by jailTree.
+func descendantJids(tree map[int][]Jail, jid int) []int {
+	jids := []int{}
+
+	for _, child := range tree[jid] {
+		jids = append(jids, child.jid)
+		jids = append(jids, descendantJids(tree, child.jid)...)
+	}
+
+	return jids
+}
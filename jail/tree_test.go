@@ -0,0 +1,83 @@
+package jail
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitJailName(t *testing.T) {
+	for name, expected := range map[string][2]string{
+		"www":        {"", "www"},
+		"www.db":     {"www", "db"},
+		"www.db.tmp": {"www.db", "tmp"},
+	} {
+		parent, child := splitJailName(name)
+
+		if parent != expected[0] || child != expected[1] {
+			t.Errorf("Split `%s' into `%s' and `%s'", name, parent, child)
+		}
+	}
+}
+
+func TestJailTree(t *testing.T) {
+	jails := []Jail{
+		{jid: 5, parent: 1, name: "www.cache"},
+		{jid: 1, name: "www"},
+		{jid: 3, parent: 1, name: "www.db"},
+		{jid: 2, name: "mail"},
+		{jid: 4, parent: 3, name: "www.db.tmp"},
+	}
+
+	tree := jailTree(jails)
+
+	expected := map[int][]int{
+		0: {1, 2},
+		1: {3, 5},
+		3: {4},
+	}
+
+	if len(tree) != len(expected) {
+		t.Errorf("Expected %d parents, got %d", len(expected), len(tree))
+	}
+
+	for parent, jids := range expected {
+		children := tree[parent]
+
+		if len(children) != len(jids) {
+			t.Errorf("Parent %d has %d children, expected %d", parent, len(children), len(jids))
+			continue
+		}
+
+		for i := range jids {
+			if children[i].jid != jids[i] {
+				t.Errorf("Child %d of %d is %d, expected %d", i, parent, children[i].jid, jids[i])
+			}
+		}
+	}
+
+	if len(tree[2]) != 0 {
+		t.Errorf("Jail 2 shouldn't have children")
+	}
+}
+
+func TestDescendantJids(t *testing.T) {
+	tree := jailTree([]Jail{
+		{jid: 5, parent: 1, name: "www.cache"},
+		{jid: 1, name: "www"},
+		{jid: 3, parent: 1, name: "www.db"},
+		{jid: 2, name: "mail"},
+		{jid: 4, parent: 3, name: "www.db.tmp"},
+	})
+
+	for jid, expected := range map[int][]int{
+		1: {3, 4, 5},
+		3: {4},
+		2: {},
+		4: {},
+		9: {},
+	} {
+		if jids := descendantJids(tree, jid); !reflect.DeepEqual(jids, expected) {
+			t.Errorf("Jails inside %d are %v, expected %v", jid, jids, expected)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package jail
+
+import (
+	"net"
+)
+
+// Jail provides a wrapper around a single jail's metadata. Older versions of
+// FreeBSD represented jails as a simple struct, however there's been so much
+// added to them that you have to use an iovec to access most functionality.
+// As such, there's not much corresponding documentation -- the best thing is
+// jail(8) which provides the name and description of most iovec keys.
+//
+// Jail exposes some of the jail functionality, but not all (since there's a lot
+// of it, and most of it is off the beaten path). Jails are persistent by
+// default, since that's the direction the jails have been moving the past
+// several years. Transient jails, which exist until the spawned process
+// terminates, are created with RunInNewJail or a TransientJail.
+type Jail struct {
+	jid    int
+	parent int
+	name   string
+
+	hostname string
+
+	path     string
+	cpusetId int
+
+	addrs  []net.IP
+	epairs []Epair
+	mounts []string
+
+	dying bool
+}
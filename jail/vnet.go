@@ -0,0 +1,68 @@
+package jail
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/lye/freebsd/netif"
+)
+
+// VnetEpair describes an epair(4) for CreateJail to plumb into a VNET jail.
+// One end stays on the host and the other is moved into the jail; both are
+// brought up, each with its own addresses.
+type VnetEpair struct {
+	HostAddrs []netif.InterfaceAddr
+	JailAddrs []netif.InterfaceAddr
+}
+
+// Epair names the ends of an epair plumbed into a jail. The jailed end
+// keeps its name inside the jail.
+type Epair struct {
+	Host string
+	Jail string
+}
+
+func (spec *JailSpec) validateVnet() error {
+	if len(spec.Epairs) > 0 && spec.Vnet != JailSysNew {
+		return fmt.Errorf("Epairs can only be plumbed into a jail with Vnet set to `new'")
+	}
+
+	return nil
+}
+
+// Addresses only stick to an interface once it's inside the jail, and only
+// a process attached to the jail can reach its network stack, so the jailed
+// end is configured from a re-exec'd helper, as with Command. The helper is
+// recognized by its argv[0]; argv[1] is the encoded ifconfigHelperConf.
+const ifconfigHelperArg0 = "freebsd-jail-ifconfig"
+
+type ifconfigHelperConf struct {
+	Jid   int
+	Iface string
+	Addrs []netif.InterfaceAddr
+}
+
+func ifconfigHelperArgs(jid int, iface string, addrs []netif.InterfaceAddr) ([]string, error) {
+	conf, er := json.Marshal(ifconfigHelperConf{Jid: jid, Iface: iface, Addrs: addrs})
+	if er != nil {
+		return nil, er
+	}
+
+	return []string{ifconfigHelperArg0, string(conf)}, nil
+}
+
+func parseIfconfigHelperArgs(argv []string) (conf ifconfigHelperConf, er error) {
+	if len(argv) != 2 || argv[0] != ifconfigHelperArg0 {
+		return conf, fmt.Errorf("Malformed ifconfig helper arguments")
+	}
+
+	if er := json.Unmarshal([]byte(argv[1]), &conf); er != nil {
+		return conf, er
+	}
+
+	if conf.Iface == "" {
+		return conf, fmt.Errorf("Malformed ifconfig helper arguments")
+	}
+
+	return conf, nil
+}
@@ -0,0 +1,69 @@
+package jail
+
+import (
+	"testing"
+
+	"github.com/lye/freebsd/netif"
+)
+
+func TestIfconfigHelperArgs(t *testing.T) {
+	addrs := []netif.InterfaceAddr{}
+
+	for _, s := range []string{"192.0.2.2/24", "2001:db8::2/64"} {
+		addr, er := netif.ParseInterfaceAddr(s)
+		if er != nil {
+			t.Fatal(er)
+		}
+
+		addrs = append(addrs, addr)
+	}
+
+	argv, er := ifconfigHelperArgs(7, "epair0b", addrs)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	conf, er := parseIfconfigHelperArgs(argv)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if conf.Jid != 7 || conf.Iface != "epair0b" || len(conf.Addrs) != 2 {
+		t.Fatalf("Config didn't survive the round trip: %#v", conf)
+	}
+
+	for i := range addrs {
+		if conf.Addrs[i].String() != addrs[i].String() {
+			t.Errorf("Address %s came back as %s", addrs[i], conf.Addrs[i])
+		}
+	}
+
+	for _, argv := range [][]string{
+		nil,
+		{ifconfigHelperArg0},
+		{execHelperArg0, "{}"},
+		{ifconfigHelperArg0, "{}"},
+		{ifconfigHelperArg0, "not json"},
+	} {
+		if _, er := parseIfconfigHelperArgs(argv); er == nil {
+			t.Errorf("Expected %q to be rejected", argv)
+		}
+	}
+}
+
+func TestJailSpecValidateVnet(t *testing.T) {
+	spec := &JailSpec{Name: "vnet", Epairs: []VnetEpair{{}}}
+
+	if er := spec.validateVnet(); er == nil {
+		t.Errorf("Epairs without a vnet should be rejected")
+	}
+
+	spec.Vnet = JailSysNew
+	if er := spec.validateVnet(); er != nil {
+		t.Error(er)
+	}
+
+	if _, ok := spec.params()["vnet"]; !ok {
+		t.Errorf("vnet missing from the spec's params")
+	}
+}
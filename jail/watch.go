@@ -0,0 +1,241 @@
+package jail
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+const defaultWatchInterval = time.Second
+
+// JailEventType is the kind of change a JailEvent reports.
+type JailEventType int
+
+const (
+	// JailCreated is sent the first time a jail is seen, including for
+	// jails that already exist when Watch is called.
+	JailCreated JailEventType = iota
+
+	// JailUpdated is sent when a jail's name, hostname, path, cpuset,
+	// parent or addresses change.
+	JailUpdated
+
+	// JailDying is sent when a jail starts being removed; it may linger in
+	// this state until its last process has exited and its resources have
+	// been released.
+	JailDying
+
+	// JailRemoved is sent once a jail is gone entirely.
+	JailRemoved
+
+	// JailNotificationsLost is sent if jailed processes can no longer be
+	// tracked; changes are still found, but only as often as the jails are
+	// polled. It has no Jid or Jail, only Err.
+	JailNotificationsLost
+)
+
+func (ty JailEventType) String() string {
+	switch ty {
+	case JailCreated:
+		return "created"
+	case JailUpdated:
+		return "updated"
+	case JailDying:
+		return "dying"
+	case JailRemoved:
+		return "removed"
+	case JailNotificationsLost:
+		return "notifications lost"
+	}
+
+	return "unknown"
+}
+
+// JailEvent describes a change to a single jail.
+type JailEvent struct {
+	Type JailEventType
+	Jid  int
+
+	// Jail is the state of the jail as of the event. For JailRemoved, it's
+	// the last state seen before the jail went away.
+	Jail Jail
+
+	// Err is why notifications were lost, for JailNotificationsLost.
+	Err error
+}
+
+func sameAddrs(lhs, rhs *Jail) bool {
+	if len(lhs.addrs) != len(rhs.addrs) {
+		return false
+	}
+
+	for i := range lhs.addrs {
+		if !lhs.addrs[i].Equal(rhs.addrs[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func jailChanged(lhs, rhs *Jail) bool {
+	return lhs.name != rhs.name || lhs.hostname != rhs.hostname || lhs.path != rhs.path ||
+		lhs.parent != rhs.parent || lhs.cpusetId != rhs.cpusetId || !sameAddrs(lhs, rhs)
+}
+
+// diffJailSnapshots returns the events that take prev to next, ordered by
+// JID.
+func diffJailSnapshots(prev, next map[int]Jail) []JailEvent {
+	jids := []int{}
+
+	for jid := range prev {
+		jids = append(jids, jid)
+	}
+
+	for jid := range next {
+		if _, ok := prev[jid]; !ok {
+			jids = append(jids, jid)
+		}
+	}
+
+	sort.Ints(jids)
+
+	events := []JailEvent{}
+
+	for _, jid := range jids {
+		old, wasThere := prev[jid]
+		cur, isThere := next[jid]
+
+		if !isThere {
+			events = append(events, JailEvent{Type: JailRemoved, Jid: jid, Jail: old})
+			continue
+		}
+
+		if !wasThere {
+			events = append(events, JailEvent{Type: JailCreated, Jid: jid, Jail: cur})
+
+			if cur.dying {
+				events = append(events, JailEvent{Type: JailDying, Jid: jid, Jail: cur})
+			}
+
+		} else if cur.dying && !old.dying {
+			events = append(events, JailEvent{Type: JailDying, Jid: jid, Jail: cur})
+
+		} else if jailChanged(&old, &cur) {
+			events = append(events, JailEvent{Type: JailUpdated, Jid: jid, Jail: cur})
+		}
+	}
+
+	return events
+}
+
+// jailWatcher polls for jail snapshots and turns them into events. wake, if
+// set, triggers a poll ahead of the interval (e.g., when a jailed process
+// exits), and track is handed each snapshot so it can decide what to wake
+// up for. failed reports whatever stops wake from being triggered.
+type jailWatcher struct {
+	snapshot func() (map[int]Jail, error)
+	track    func(map[int]Jail) error
+	wake     <-chan struct{}
+	failed   <-chan error
+	interval time.Duration
+}
+
+// lose gives up on tracking after it fails, and says so with a
+// JailNotificationsLost event. It returns false if ctx was done first.
+func (w *jailWatcher) lose(ctx context.Context, events chan<- JailEvent, er error) bool {
+	w.track = nil
+	w.failed = nil
+
+	select {
+	case events <- JailEvent{Type: JailNotificationsLost, Err: er}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// run sends events to events until ctx is done, then closes it. A snapshot
+// that fails is simply retried at the next poll.
+func (w *jailWatcher) run(ctx context.Context, prev map[int]Jail, events chan<- JailEvent) {
+	defer close(events)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		case er := <-w.failed:
+			/* Carry on polling; there's nothing more to hear. */
+			if !w.lose(ctx, events, er) {
+				return
+			}
+
+			continue
+		}
+
+		next, er := w.snapshot()
+		if er != nil {
+			continue
+		}
+
+		if w.track != nil {
+			if er := w.track(next); er != nil && !w.lose(ctx, events, er) {
+				return
+			}
+		}
+
+		for _, event := range diffJailSnapshots(prev, next) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		prev = next
+	}
+}
+
+// start takes the initial snapshot (so that a failure can be reported up
+// front) and runs the watcher in the background.
+func (w *jailWatcher) start(ctx context.Context) (<-chan JailEvent, error) {
+	first, er := w.snapshot()
+	if er != nil {
+		return nil, er
+	}
+
+	var trackEr error
+	if w.track != nil {
+		trackEr = w.track(first)
+	}
+
+	events := make(chan JailEvent)
+
+	go func() {
+		initial := diffJailSnapshots(map[int]Jail{}, first)
+
+		/* Report what's already there, then carry on from it. */
+		for _, event := range initial {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				close(events)
+				return
+			}
+		}
+
+		if trackEr != nil && !w.lose(ctx, events, trackEr) {
+			close(events)
+			return
+		}
+
+		w.run(ctx, first, events)
+	}()
+
+	return events, nil
+}
@@ -0,0 +1,273 @@
+package jail
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func jailSnapshot(jails ...Jail) map[int]Jail {
+	snapshot := map[int]Jail{}
+
+	for _, jail := range jails {
+		snapshot[jail.jid] = jail
+	}
+
+	return snapshot
+}
+
+func eventSummary(events []JailEvent) []string {
+	summary := []string{}
+
+	for _, event := range events {
+		summary = append(summary, event.Type.String()+":"+event.Jail.name)
+	}
+
+	return summary
+}
+
+func checkEvents(t *testing.T, events []JailEvent, expected ...string) {
+	summary := eventSummary(events)
+
+	if len(summary) != len(expected) {
+		t.Errorf("Expected events %v, got %v", expected, summary)
+		return
+	}
+
+	for i := range summary {
+		if summary[i] != expected[i] {
+			t.Errorf("Expected events %v, got %v", expected, summary)
+			return
+		}
+	}
+}
+
+func TestDiffJailSnapshots(t *testing.T) {
+	www := Jail{jid: 1, name: "www", path: "/jails/www", addrs: []net.IP{net.ParseIP("10.0.0.1")}}
+	db := Jail{jid: 2, name: "db", path: "/jails/db"}
+
+	checkEvents(t, diffJailSnapshots(jailSnapshot(), jailSnapshot(www, db)), "created:www", "created:db")
+	checkEvents(t, diffJailSnapshots(jailSnapshot(www, db), jailSnapshot(www, db)))
+
+	moved := www
+	moved.addrs = []net.IP{net.ParseIP("10.0.0.2")}
+	checkEvents(t, diffJailSnapshots(jailSnapshot(www, db), jailSnapshot(moved, db)), "updated:www")
+
+	renamed := db
+	renamed.hostname = "db.example.org"
+	checkEvents(t, diffJailSnapshots(jailSnapshot(www, db), jailSnapshot(www, renamed)), "updated:db")
+
+	dying := db
+	dying.dying = true
+	checkEvents(t, diffJailSnapshots(jailSnapshot(www, db), jailSnapshot(www, dying)), "dying:db")
+	checkEvents(t, diffJailSnapshots(jailSnapshot(www, dying), jailSnapshot(www, dying)))
+	checkEvents(t, diffJailSnapshots(jailSnapshot(www, dying), jailSnapshot(www)), "removed:db")
+
+	/* A jail that started dying between snapshots is still reported as
+	 * having been created. */
+	checkEvents(t, diffJailSnapshots(jailSnapshot(www), jailSnapshot(www, dying)), "created:db", "dying:db")
+
+	/* A JID reused by a new jail after a removal is just a change. */
+	reused := Jail{jid: 1, name: "mail"}
+	checkEvents(t, diffJailSnapshots(jailSnapshot(www), jailSnapshot(reused)), "updated:mail")
+}
+
+func TestJailWatcher(t *testing.T) {
+	www := Jail{jid: 1, name: "www"}
+	db := Jail{jid: 2, name: "db"}
+	dying := db
+	dying.dying = true
+
+	script := []map[int]Jail{
+		jailSnapshot(www),
+		jailSnapshot(www, db),
+		nil,
+		jailSnapshot(www, dying),
+		jailSnapshot(www),
+	}
+
+	tracked := 0
+	wake := make(chan struct{}, 1)
+
+	w := &jailWatcher{
+		snapshot: func() (map[int]Jail, error) {
+			if len(script) == 0 {
+				return nil, errors.New("out of script")
+			}
+
+			next := script[0]
+			script = script[1:]
+
+			if next == nil {
+				return nil, errors.New("scripted failure")
+			}
+
+			return next, nil
+		},
+		track:    func(map[int]Jail) error { tracked++; return nil },
+		wake:     wake,
+		interval: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, er := w.start(ctx)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	seen := []JailEvent{}
+	for len(seen) < 4 {
+		select {
+		case event := <-events:
+			seen = append(seen, event)
+
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out after events %v", eventSummary(seen))
+		}
+	}
+
+	checkEvents(t, seen, "created:www", "created:db", "dying:db", "removed:db")
+
+	if tracked != 4 {
+		t.Errorf("Expected 4 snapshots to be tracked, got %d", tracked)
+	}
+
+	cancel()
+
+	for range events {
+	}
+}
+
+func TestJailWatcherWake(t *testing.T) {
+	polls := 0
+	wake := make(chan struct{}, 1)
+
+	w := &jailWatcher{
+		snapshot: func() (map[int]Jail, error) {
+			polls++
+			return jailSnapshot(), nil
+		},
+		wake:     wake,
+		interval: time.Hour,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, er := w.start(ctx)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	wake <- struct{}{}
+	wake <- struct{}{}
+	cancel()
+
+	for range events {
+	}
+
+	if polls < 2 {
+		t.Errorf("Waking the watcher should trigger a poll, got %d polls", polls)
+	}
+}
+
+func TestJailWatcherNotificationsLost(t *testing.T) {
+	www := Jail{jid: 1, name: "www"}
+	db := Jail{jid: 2, name: "db"}
+
+	script := []map[int]Jail{jailSnapshot(www), jailSnapshot(www, db)}
+	lost := errors.New("kevent failed")
+	tracked := 0
+
+	w := &jailWatcher{
+		snapshot: func() (map[int]Jail, error) {
+			if len(script) == 0 {
+				return jailSnapshot(www, db), nil
+			}
+
+			next := script[0]
+			script = script[1:]
+
+			return next, nil
+		},
+		track: func(map[int]Jail) error {
+			tracked++
+
+			if tracked == 2 {
+				return lost
+			}
+
+			return nil
+		},
+		interval: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, er := w.start(ctx)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	seen := []JailEvent{}
+	for len(seen) < 3 {
+		select {
+		case event := <-events:
+			seen = append(seen, event)
+
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out after events %v", eventSummary(seen))
+		}
+	}
+
+	checkEvents(t, seen, "created:www", "notifications lost:", "created:db")
+
+	if seen[1].Err != lost {
+		t.Errorf("Unexpected error %v", seen[1].Err)
+	}
+
+	/* Give the watcher a few more polls, which shouldn't be tracked. */
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	for range events {
+	}
+
+	if tracked != 2 {
+		t.Errorf("Tracking should stop once it fails, tracked %d snapshots", tracked)
+	}
+}
+
+func TestJailWatcherTrackerFailed(t *testing.T) {
+	failed := make(chan error, 1)
+	lost := errors.New("kqueue went away")
+
+	w := &jailWatcher{
+		snapshot: func() (map[int]Jail, error) { return jailSnapshot(), nil },
+		failed:   failed,
+		interval: time.Hour,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, er := w.start(ctx)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	failed <- lost
+
+	select {
+	case event := <-events:
+		if event.Type != JailNotificationsLost || event.Err != lost {
+			t.Errorf("Unexpected event %+v", event)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("Tracker failure wasn't reported")
+	}
+}
@@ -0,0 +1,128 @@
+package netif
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ifNameSize is IFNAMSIZ, including the terminating NUL.
+const ifNameSize = 16
+
+// InterfaceAddr is an address to assign to an interface along with the
+// length of its prefix, as written to ifconfig(8): "192.0.2.1/24".
+type InterfaceAddr struct {
+	IP        net.IP
+	PrefixLen int
+}
+
+// ParseInterfaceAddr parses an address in CIDR notation. Unlike
+// net.ParseCIDR, the host part of the address is kept. If the prefix length
+// is left off, the address is taken to be a host address (/32 or /128).
+func ParseInterfaceAddr(s string) (InterfaceAddr, error) {
+	addr, prefix, hasPrefix := s, "", false
+
+	if idx := strings.IndexByte(s, '/'); idx >= 0 {
+		addr, prefix, hasPrefix = s[:idx], s[idx+1:], true
+	}
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return InterfaceAddr{}, fmt.Errorf("Invalid interface address `%s'", s)
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	ifaddr := InterfaceAddr{IP: ip, PrefixLen: len(ip) * 8}
+
+	if hasPrefix {
+		n, er := strconv.Atoi(prefix)
+		if er != nil || n < 0 || n > len(ip)*8 {
+			return InterfaceAddr{}, fmt.Errorf("Invalid prefix length in interface address `%s'", s)
+		}
+
+		ifaddr.PrefixLen = n
+	}
+
+	return ifaddr, nil
+}
+
+// validate checks that the address is an IPv4 or IPv6 address, with a
+// prefix length that fits it.
+func (ia InterfaceAddr) validate() error {
+	bits := 128
+	if ia.Is4() {
+		bits = 32
+
+	} else if ia.IP.To16() == nil {
+		return fmt.Errorf("Invalid interface address `%s'", ia)
+	}
+
+	if ia.PrefixLen < 0 || ia.PrefixLen > bits {
+		return fmt.Errorf("Invalid prefix length in interface address `%s'", ia)
+	}
+
+	return nil
+}
+
+// Is4 returns true if the address is an IPv4 address.
+func (ia InterfaceAddr) Is4() bool {
+	return ia.IP.To4() != nil
+}
+
+// Mask returns the netmask corresponding to the prefix length.
+func (ia InterfaceAddr) Mask() net.IPMask {
+	if ia.Is4() {
+		return net.CIDRMask(ia.PrefixLen, 32)
+	}
+
+	return net.CIDRMask(ia.PrefixLen, 128)
+}
+
+// Broadcast returns the broadcast address of an IPv4 address's network, or
+// nil for IPv6 addresses and point-to-point (/31 and /32) networks.
+func (ia InterfaceAddr) Broadcast() net.IP {
+	ip4 := ia.IP.To4()
+	if ip4 == nil || ia.PrefixLen > 30 || ia.validate() != nil {
+		return nil
+	}
+
+	mask := ia.Mask()
+	brd := make(net.IP, 4)
+
+	for i := range brd {
+		brd[i] = ip4[i] | ^mask[i]
+	}
+
+	return brd
+}
+
+func (ia InterfaceAddr) String() string {
+	return fmt.Sprintf("%s/%d", ia.IP, ia.PrefixLen)
+}
+
+func checkIfName(name string) error {
+	if name == "" || len(name) >= ifNameSize {
+		return fmt.Errorf("Invalid interface name `%s'", name)
+	}
+
+	return nil
+}
+
+// epairPeer returns the name of the other end of an epair(4), e.g. epair3b
+// for epair3a.
+func epairPeer(name string) (string, error) {
+	if len(name) > len("epair") && strings.HasPrefix(name, "epair") {
+		switch name[len(name)-1] {
+		case 'a':
+			return name[:len(name)-1] + "b", nil
+		case 'b':
+			return name[:len(name)-1] + "a", nil
+		}
+	}
+
+	return "", fmt.Errorf("Interface `%s' is not an epair", name)
+}
@@ -0,0 +1,101 @@
+package netif
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseInterfaceAddr(t *testing.T) {
+	for _, test := range []struct {
+		in, out, mask, brd string
+	}{
+		{"192.0.2.10/24", "192.0.2.10/24", "ffffff00", "192.0.2.255"},
+		{"192.0.2.10", "192.0.2.10/32", "ffffffff", "<nil>"},
+		{"10.1.2.3/8", "10.1.2.3/8", "ff000000", "10.255.255.255"},
+		{"192.0.2.0/31", "192.0.2.0/31", "fffffffe", "<nil>"},
+		{"2001:db8::1/64", "2001:db8::1/64", "ffffffffffffffff0000000000000000", "<nil>"},
+		{"fe80::1", "fe80::1/128", "ffffffffffffffffffffffffffffffff", "<nil>"},
+	} {
+		addr, er := ParseInterfaceAddr(test.in)
+		if er != nil {
+			t.Errorf("%s: %s", test.in, er)
+			continue
+		}
+
+		if addr.String() != test.out {
+			t.Errorf("%s: parsed as %s, expected %s", test.in, addr, test.out)
+		}
+
+		if addr.Mask().String() != test.mask {
+			t.Errorf("%s: mask %s, expected %s", test.in, addr.Mask(), test.mask)
+		}
+
+		if addr.Broadcast().String() != test.brd {
+			t.Errorf("%s: broadcast %s, expected %s", test.in, addr.Broadcast(), test.brd)
+		}
+	}
+
+	for _, bad := range []string{"", "192.0.2.1/33", "2001:db8::1/129", "192.0.2.1/", "192.0.2.1/x", "example.org/24"} {
+		if _, er := ParseInterfaceAddr(bad); er == nil {
+			t.Errorf("Expected `%s' to be rejected", bad)
+		}
+	}
+}
+
+func TestInterfaceAddrValidate(t *testing.T) {
+	for _, addr := range []string{"192.0.2.10/0", "192.0.2.10/32", "2001:db8::1/0", "2001:db8::1/128"} {
+		ia, er := ParseInterfaceAddr(addr)
+		if er != nil {
+			t.Fatal(er)
+		}
+
+		if er := ia.validate(); er != nil {
+			t.Errorf("%s: %s", addr, er)
+		}
+	}
+
+	for _, ia := range []InterfaceAddr{
+		{IP: net.ParseIP("192.0.2.10"), PrefixLen: 33},
+		{IP: net.ParseIP("192.0.2.10").To4(), PrefixLen: -1},
+		{IP: net.ParseIP("2001:db8::1"), PrefixLen: 129},
+		{IP: net.ParseIP("2001:db8::1"), PrefixLen: -8},
+		{IP: net.IP{1, 2, 3}, PrefixLen: 8},
+		{PrefixLen: 8},
+	} {
+		if er := ia.validate(); er == nil {
+			t.Errorf("Expected %s to be rejected", ia)
+		}
+
+		/* Shouldn't panic on a prefix with no mask. */
+		if brd := ia.Broadcast(); brd != nil {
+			t.Errorf("%s has broadcast address %s", ia, brd)
+		}
+	}
+}
+
+func TestEpairPeer(t *testing.T) {
+	for name, peer := range map[string]string{
+		"epair0a":  "epair0b",
+		"epair12b": "epair12a",
+	} {
+		if got, er := epairPeer(name); er != nil || got != peer {
+			t.Errorf("Peer of %s is %s (%v), expected %s", name, got, er, peer)
+		}
+	}
+
+	for _, bad := range []string{"epair", "epair0", "em0", "bridge0a"} {
+		if _, er := epairPeer(bad); er == nil {
+			t.Errorf("Expected %s not to be an epair", bad)
+		}
+	}
+}
+
+func TestCheckIfName(t *testing.T) {
+	if er := checkIfName("epair0a"); er != nil {
+		t.Error(er)
+	}
+
+	if checkIfName("") == nil || checkIfName("averyveryverylongname") == nil {
+		t.Errorf("Expected empty and overlong names to be rejected")
+	}
+}
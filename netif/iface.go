@@ -0,0 +1,273 @@
+//go:build freebsd
+
+package netif
+
+/*
+#include <sys/types.h>
+#include <sys/ioctl.h>
+#include <sys/socket.h>
+#include <sys/sockio.h>
+#include <net/if.h>
+#include <netinet/in.h>
+#include <netinet/in_var.h>
+#include <netinet6/in6_var.h>
+#include <netinet6/nd6.h>
+#include <errno.h>
+#include <stdlib.h>
+#include <string.h>
+#include <unistd.h>
+
+static int netif_ioctl(int af, unsigned long req, void *arg) {
+	int s, ret, saved;
+
+	if ((s = socket(af, SOCK_DGRAM, 0)) == -1) {
+		return -1;
+	}
+
+	ret = ioctl(s, req, arg);
+
+	saved = errno;
+	close(s);
+	errno = saved;
+
+	return ret;
+}
+
+static int netif_create(const char *cloner, char *name) {
+	struct ifreq ifr;
+
+	memset(&ifr, 0, sizeof(ifr));
+	strlcpy(ifr.ifr_name, cloner, sizeof(ifr.ifr_name));
+
+	if (netif_ioctl(AF_LOCAL, SIOCIFCREATE2, &ifr) == -1) {
+		return -1;
+	}
+
+	strlcpy(name, ifr.ifr_name, IFNAMSIZ);
+	return 0;
+}
+
+static int netif_destroy(const char *name) {
+	struct ifreq ifr;
+
+	memset(&ifr, 0, sizeof(ifr));
+	strlcpy(ifr.ifr_name, name, sizeof(ifr.ifr_name));
+
+	return netif_ioctl(AF_LOCAL, SIOCIFDESTROY, &ifr);
+}
+
+static int netif_vnet(const char *name, int jid, int reclaim) {
+	struct ifreq ifr;
+
+	memset(&ifr, 0, sizeof(ifr));
+	strlcpy(ifr.ifr_name, name, sizeof(ifr.ifr_name));
+	ifr.ifr_jid = jid;
+
+	return netif_ioctl(AF_LOCAL, reclaim ? SIOCSIFRVNET : SIOCSIFVNET, &ifr);
+}
+
+static int netif_set_up(const char *name, int up) {
+	struct ifreq ifr;
+	int flags;
+
+	memset(&ifr, 0, sizeof(ifr));
+	strlcpy(ifr.ifr_name, name, sizeof(ifr.ifr_name));
+
+	if (netif_ioctl(AF_LOCAL, SIOCGIFFLAGS, &ifr) == -1) {
+		return -1;
+	}
+
+	flags = (ifr.ifr_flags & 0xffff) | (ifr.ifr_flagshigh << 16);
+
+	if (up) {
+		flags |= IFF_UP;
+
+	} else {
+		flags &= ~IFF_UP;
+	}
+
+	ifr.ifr_flags = flags & 0xffff;
+	ifr.ifr_flagshigh = flags >> 16;
+
+	return netif_ioctl(AF_LOCAL, SIOCSIFFLAGS, &ifr);
+}
+
+static void netif_sin(struct sockaddr_in *sin, const void *addr) {
+	sin->sin_len = sizeof(*sin);
+	sin->sin_family = AF_INET;
+	memcpy(&sin->sin_addr, addr, sizeof(sin->sin_addr));
+}
+
+static int netif_add_addr4(const char *name, const void *addr, const void *mask, const void *brd) {
+	struct in_aliasreq ifra;
+
+	memset(&ifra, 0, sizeof(ifra));
+	strlcpy(ifra.ifra_name, name, sizeof(ifra.ifra_name));
+
+	netif_sin(&ifra.ifra_addr, addr);
+	netif_sin(&ifra.ifra_mask, mask);
+
+	if (brd != NULL) {
+		netif_sin(&ifra.ifra_broadaddr, brd);
+	}
+
+	return netif_ioctl(AF_INET, SIOCAIFADDR, &ifra);
+}
+
+static void netif_sin6(struct sockaddr_in6 *sin6, const void *addr) {
+	sin6->sin6_len = sizeof(*sin6);
+	sin6->sin6_family = AF_INET6;
+	memcpy(&sin6->sin6_addr, addr, sizeof(sin6->sin6_addr));
+}
+
+static int netif_add_addr6(const char *name, const void *addr, const void *mask) {
+	struct in6_aliasreq ifra;
+
+	memset(&ifra, 0, sizeof(ifra));
+	strlcpy(ifra.ifra_name, name, sizeof(ifra.ifra_name));
+
+	netif_sin6(&ifra.ifra_addr, addr);
+	netif_sin6(&ifra.ifra_prefixmask, mask);
+
+	ifra.ifra_lifetime.ia6t_vltime = ND6_INFINITE_LIFETIME;
+	ifra.ifra_lifetime.ia6t_pltime = ND6_INFINITE_LIFETIME;
+
+	return netif_ioctl(AF_INET6, SIOCAIFADDR_IN6, &ifra);
+}
+*/
+import "C"
+import (
+	"unsafe"
+)
+
+// CreateInterface creates an instance of a cloned interface, like `ifconfig
+// cloner create`. The cloner is either a type of interface ("epair",
+// "bridge", ...), in which case the kernel picks the unit, or a full name
+// ("bridge7"). The name of the new interface is returned.
+func CreateInterface(cloner string) (string, error) {
+	if er := checkIfName(cloner); er != nil {
+		return "", er
+	}
+
+	ccloner := C.CString(cloner)
+	defer C.free(unsafe.Pointer(ccloner))
+
+	var name [ifNameSize]C.char
+
+	if _, er := C.netif_create(ccloner, &name[0]); er != nil {
+		return "", er
+	}
+
+	return C.GoString(&name[0]), nil
+}
+
+// CreateEpair creates an epair(4) -- a pair of virtual ethernet interfaces
+// connected back to back -- and returns the names of its two ends.
+func CreateEpair() (a, b string, er error) {
+	if a, er = CreateInterface("epair"); er != nil {
+		return "", "", er
+	}
+
+	if b, er = epairPeer(a); er != nil {
+		DestroyInterface(a)
+		return "", "", er
+	}
+
+	return a, b, nil
+}
+
+// DestroyInterface destroys a cloned interface, like `ifconfig name
+// destroy`. Destroying either end of an epair destroys both, even if the
+// other end has been moved into a jail.
+func DestroyInterface(name string) error {
+	if er := checkIfName(name); er != nil {
+		return er
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	_, er := C.netif_destroy(cname)
+	return er
+}
+
+// MoveToJail moves an interface into the network stack of a VNET jail, like
+// `ifconfig name vnet jid`. Any addresses on the interface are lost along
+// the way.
+func MoveToJail(name string, jid int) error {
+	return setVnet(name, jid, false)
+}
+
+// ReclaimFromJail moves an interface back out of a VNET jail, like
+// `ifconfig name -vnet jid`.
+func ReclaimFromJail(name string, jid int) error {
+	return setVnet(name, jid, true)
+}
+
+func setVnet(name string, jid int, reclaim bool) error {
+	if er := checkIfName(name); er != nil {
+		return er
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	var creclaim C.int
+	if reclaim {
+		creclaim = 1
+	}
+
+	_, er := C.netif_vnet(cname, C.int(jid), creclaim)
+	return er
+}
+
+// SetUp marks an interface up or down, like `ifconfig name up`.
+func SetUp(name string, up bool) error {
+	if er := checkIfName(name); er != nil {
+		return er
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	var cup C.int
+	if up {
+		cup = 1
+	}
+
+	_, er := C.netif_set_up(cname, cup)
+	return er
+}
+
+// AddAddr adds an address to an interface, like `ifconfig name inet addr
+// alias` (or inet6). IPv6 addresses are added with infinite lifetimes, and
+// IPv4 addresses get the broadcast address of their network.
+func AddAddr(name string, addr InterfaceAddr) error {
+	if er := checkIfName(name); er != nil {
+		return er
+	}
+
+	if er := addr.validate(); er != nil {
+		return er
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+
+	mask := []byte(addr.Mask())
+
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		var brd unsafe.Pointer
+		if b := addr.Broadcast(); b != nil {
+			brd = unsafe.Pointer(&b[0])
+		}
+
+		_, er := C.netif_add_addr4(cname, unsafe.Pointer(&ip4[0]), unsafe.Pointer(&mask[0]), brd)
+		return er
+	}
+
+	ip6 := addr.IP.To16()
+
+	_, er := C.netif_add_addr6(cname, unsafe.Pointer(&ip6[0]), unsafe.Pointer(&mask[0]))
+	return er
+}
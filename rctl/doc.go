@@ -0,0 +1,3 @@
+// Provides access to the resource limits database (rctl(8)) and resource
+// usage accounting.
+package rctl
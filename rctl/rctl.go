@@ -0,0 +1,131 @@
+//go:build freebsd
+
+package rctl
+
+/*
+#include <sys/types.h>
+#include <sys/rctl.h>
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	// ErrNotEnabled is returned when resource accounting is disabled; it
+	// has to be turned on with the kern.racct.enable tunable at boot.
+	ErrNotEnabled = errors.New("rctl: resource accounting is disabled (kern.racct.enable)")
+)
+
+type rctlCall func(inbuf *C.char, inlen C.size_t, outbuf *C.char, outlen C.size_t) (C.int, error)
+
+// call makes one of the rctl system calls with in as its input, growing the
+// output buffer until the result fits.
+func call(fn rctlCall, in string, wantOutput bool) (string, error) {
+	cin := C.CString(in)
+	defer C.free(unsafe.Pointer(cin))
+
+	/* The input length includes the terminating NUL. */
+	inlen := C.size_t(len(in) + 1)
+
+	if !wantOutput {
+		if _, er := fn(cin, inlen, nil, 0); er != nil {
+			return "", mapError(er)
+		}
+
+		return "", nil
+	}
+
+	for size := 4096; ; size *= 2 {
+		out := make([]byte, size)
+
+		_, er := fn(cin, inlen, (*C.char)(unsafe.Pointer(&out[0])), C.size_t(size))
+		if er == syscall.ERANGE {
+			continue
+
+		} else if er != nil {
+			return "", mapError(er)
+		}
+
+		return C.GoString((*C.char)(unsafe.Pointer(&out[0]))), nil
+	}
+}
+
+func mapError(er error) error {
+	if er == syscall.ENOSYS {
+		return ErrNotEnabled
+	}
+
+	return er
+}
+
+func getRacct(in *C.char, inlen C.size_t, out *C.char, outlen C.size_t) (C.int, error) {
+	return C.rctl_get_racct(in, inlen, out, outlen)
+}
+
+func getRules(in *C.char, inlen C.size_t, out *C.char, outlen C.size_t) (C.int, error) {
+	return C.rctl_get_rules(in, inlen, out, outlen)
+}
+
+func addRule(in *C.char, inlen C.size_t, out *C.char, outlen C.size_t) (C.int, error) {
+	return C.rctl_add_rule(in, inlen, out, outlen)
+}
+
+func removeRule(in *C.char, inlen C.size_t, out *C.char, outlen C.size_t) (C.int, error) {
+	return C.rctl_remove_rule(in, inlen, out, outlen)
+}
+
+// AddRule adds a rule, like `rctl -a`. The rule must be complete: subject,
+// subject ID, resource and action are all required.
+func AddRule(rule Rule) error {
+	if er := rule.validate(); er != nil {
+		return er
+	}
+
+	_, er := call(addRule, rule.String(), false)
+	return er
+}
+
+// RemoveRules removes every rule matching filter, like `rctl -r`.
+func RemoveRules(filter Rule) error {
+	if er := filter.check(); er != nil {
+		return er
+	}
+
+	_, er := call(removeRule, filter.filter(), false)
+	return er
+}
+
+// Rules returns every rule matching filter, like `rctl` with a filter. The
+// zero Rule lists all of them.
+func Rules(filter Rule) ([]Rule, error) {
+	if er := filter.check(); er != nil {
+		return nil, er
+	}
+
+	out, er := call(getRules, filter.filter(), true)
+	if er != nil {
+		return nil, er
+	}
+
+	return parseRules(out)
+}
+
+// Usage returns the current resource usage of a subject, like `rctl -u`.
+func Usage(subject SubjectType, id string) (map[Resource]uint64, error) {
+	filter := Rule{Subject: subject, SubjectId: id}
+
+	if er := filter.validateSubject(); er != nil {
+		return nil, er
+	}
+
+	out, er := call(getRacct, filter.filter(), true)
+	if er != nil {
+		return nil, er
+	}
+
+	return parseUsage(out)
+}
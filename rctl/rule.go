@@ -0,0 +1,329 @@
+package rctl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SubjectType is the kind of thing a rule applies to.
+type SubjectType string
+
+const (
+	SubjectProcess    SubjectType = "process"
+	SubjectUser       SubjectType = "user"
+	SubjectLoginClass SubjectType = "loginclass"
+	SubjectJail       SubjectType = "jail"
+)
+
+// Resource is a resource that can be accounted for and limited. Amounts are
+// in bytes, seconds, percent of a CPU or a plain count, as documented in
+// rctl(8).
+type Resource string
+
+const (
+	ResourceCpuTime         Resource = "cputime"
+	ResourceDataSize        Resource = "datasize"
+	ResourceStackSize       Resource = "stacksize"
+	ResourceCoreDumpSize    Resource = "coredumpsize"
+	ResourceMemoryUse       Resource = "memoryuse"
+	ResourceMemoryLocked    Resource = "memorylocked"
+	ResourceMaxProc         Resource = "maxproc"
+	ResourceOpenFiles       Resource = "openfiles"
+	ResourceVMemoryUse      Resource = "vmemoryuse"
+	ResourcePseudoTerminals Resource = "pseudoterminals"
+	ResourceSwapUse         Resource = "swapuse"
+	ResourceNThr            Resource = "nthr"
+	ResourceMsgqQueued      Resource = "msgqqueued"
+	ResourceMsgqSize        Resource = "msgqsize"
+	ResourceNMsgq           Resource = "nmsgq"
+	ResourceNSem            Resource = "nsem"
+	ResourceNSemop          Resource = "nsemop"
+	ResourceNShm            Resource = "nshm"
+	ResourceShmSize         Resource = "shmsize"
+	ResourceWallClock       Resource = "wallclock"
+	ResourcePcpu            Resource = "pcpu"
+	ResourceReadBps         Resource = "readbps"
+	ResourceWriteBps        Resource = "writebps"
+	ResourceReadIops        Resource = "readiops"
+	ResourceWriteIops       Resource = "writeiops"
+)
+
+// Action is what happens when a rule's amount is exceeded. Besides the
+// constants below, an action can be a signal to send to the offending
+// process; see SignalAction.
+type Action string
+
+const (
+	ActionDeny     Action = "deny"
+	ActionLog      Action = "log"
+	ActionDevctl   Action = "devctl"
+	ActionThrottle Action = "throttle"
+)
+
+// SignalAction returns the action that sends the named signal, e.g. "term"
+// or "SIGTERM" for SIGTERM.
+func SignalAction(sig string) Action {
+	return Action("sig" + strings.TrimPrefix(strings.ToLower(sig), "sig"))
+}
+
+var subjectTypes = map[SubjectType]bool{
+	SubjectProcess:    true,
+	SubjectUser:       true,
+	SubjectLoginClass: true,
+	SubjectJail:       true,
+}
+
+var resources = map[Resource]bool{
+	ResourceCpuTime: true, ResourceDataSize: true, ResourceStackSize: true,
+	ResourceCoreDumpSize: true, ResourceMemoryUse: true, ResourceMemoryLocked: true,
+	ResourceMaxProc: true, ResourceOpenFiles: true, ResourceVMemoryUse: true,
+	ResourcePseudoTerminals: true, ResourceSwapUse: true, ResourceNThr: true,
+	ResourceMsgqQueued: true, ResourceMsgqSize: true, ResourceNMsgq: true,
+	ResourceNSem: true, ResourceNSemop: true, ResourceNShm: true,
+	ResourceShmSize: true, ResourceWallClock: true, ResourcePcpu: true,
+	ResourceReadBps: true, ResourceWriteBps: true, ResourceReadIops: true,
+	ResourceWriteIops: true,
+}
+
+func (action Action) valid() bool {
+	switch action {
+	case ActionDeny, ActionLog, ActionDevctl, ActionThrottle:
+		return true
+	}
+
+	sig := strings.TrimPrefix(string(action), "sig")
+	return sig != string(action) && sig != "" && strings.ToLower(sig) == sig
+}
+
+// Rule is a single rctl rule, written as
+//
+//	subject:subject-id:resource:action=amount/per
+//
+// When used as a filter (for Rules and RemoveRules), any field may be left
+// empty, and Amount zero, to match everything.
+type Rule struct {
+	Subject SubjectType
+
+	// SubjectId identifies the subject: a PID, a user name or UID, a login
+	// class or a jail name.
+	SubjectId string
+
+	Resource Resource
+	Action   Action
+	Amount   uint64
+
+	// Per is the subject the amount is counted against, if it isn't the
+	// rule's own subject. For example, a rule on a login class can limit
+	// each user in the class rather than the class as a whole.
+	Per SubjectType
+}
+
+// ParseRule parses a rule or filter in rctl(8) syntax. Amounts may use the
+// k, m, g, t, p and e suffixes for powers of 1024.
+func ParseRule(s string) (Rule, error) {
+	rule := Rule{}
+
+	fields := strings.SplitN(s, ":", 4)
+	if len(fields) > 0 {
+		rule.Subject = SubjectType(fields[0])
+	}
+
+	if len(fields) > 1 {
+		rule.SubjectId = fields[1]
+	}
+
+	if len(fields) > 2 {
+		rule.Resource = Resource(fields[2])
+	}
+
+	if len(fields) > 3 {
+		action := fields[3]
+
+		if idx := strings.IndexByte(action, '='); idx >= 0 {
+			amount := action[idx+1:]
+			action = action[:idx]
+
+			if idx := strings.IndexByte(amount, '/'); idx >= 0 {
+				rule.Per = SubjectType(amount[idx+1:])
+				amount = amount[:idx]
+			}
+
+			n, er := parseAmount(amount)
+			if er != nil {
+				return Rule{}, fmt.Errorf("Invalid amount in rule `%s'", s)
+			}
+
+			rule.Amount = n
+		}
+
+		rule.Action = Action(action)
+	}
+
+	if er := rule.check(); er != nil {
+		return Rule{}, fmt.Errorf("Invalid rule `%s': %s", s, er)
+	}
+
+	return rule, nil
+}
+
+func (rule *Rule) check() error {
+	if rule.Subject != "" && !subjectTypes[rule.Subject] {
+		return fmt.Errorf("unknown subject `%s'", rule.Subject)
+	}
+
+	if rule.Resource != "" && !resources[rule.Resource] {
+		return fmt.Errorf("unknown resource `%s'", rule.Resource)
+	}
+
+	if rule.Action != "" && !rule.Action.valid() {
+		return fmt.Errorf("unknown action `%s'", rule.Action)
+	}
+
+	if rule.Per != "" && !subjectTypes[rule.Per] {
+		return fmt.Errorf("unknown subject `%s'", rule.Per)
+	}
+
+	return nil
+}
+
+// validateSubject checks that the rule names a single subject, as usage
+// queries need.
+func (rule *Rule) validateSubject() error {
+	if er := rule.check(); er != nil {
+		return er
+	}
+
+	if rule.Subject == "" || rule.SubjectId == "" {
+		return fmt.Errorf("A subject and subject ID are required")
+	}
+
+	return nil
+}
+
+// validate checks that the rule is complete enough to be added.
+func (rule *Rule) validate() error {
+	if er := rule.check(); er != nil {
+		return er
+	}
+
+	if rule.Subject == "" || rule.SubjectId == "" || rule.Resource == "" || rule.Action == "" {
+		return fmt.Errorf("Rule `%s' must have a subject, subject ID, resource and action", rule)
+	}
+
+	return nil
+}
+
+// String formats the rule in rctl(8) syntax.
+func (rule Rule) String() string {
+	return rule.format(false)
+}
+
+// filter formats the rule for use as a filter, where a zero Amount matches
+// any amount.
+func (rule Rule) filter() string {
+	return rule.format(true)
+}
+
+func (rule Rule) format(filter bool) string {
+	s := string(rule.Action)
+
+	if rule.Action != "" && (rule.Amount != 0 || !filter) {
+		s += "=" + strconv.FormatUint(rule.Amount, 10)
+
+		if rule.Per != "" {
+			s += "/" + string(rule.Per)
+		}
+	}
+
+	fields := []string{string(rule.Subject), rule.SubjectId, string(rule.Resource), s}
+
+	/* A filter leaves off its trailing empty fields. */
+	for len(fields) > 1 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+
+	return strings.Join(fields, ":")
+}
+
+func parseAmount(s string) (uint64, error) {
+	shift := uint(0)
+
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'k', 'K':
+			shift = 10
+		case 'm', 'M':
+			shift = 20
+		case 'g', 'G':
+			shift = 30
+		case 't', 'T':
+			shift = 40
+		case 'p', 'P':
+			shift = 50
+		case 'e', 'E':
+			shift = 60
+		}
+	}
+
+	if shift != 0 {
+		s = s[:len(s)-1]
+	}
+
+	n, er := strconv.ParseUint(s, 10, 64)
+	if er != nil {
+		return 0, er
+	}
+
+	if n > (^uint64(0))>>shift {
+		return 0, fmt.Errorf("Amount `%s' out of range", s)
+	}
+
+	return n << shift, nil
+}
+
+// parseRules parses the comma-separated list of rules the kernel returns.
+func parseRules(s string) ([]Rule, error) {
+	rules := []Rule{}
+
+	for _, field := range strings.Split(s, ",") {
+		if field == "" {
+			continue
+		}
+
+		rule, er := ParseRule(field)
+		if er != nil {
+			return nil, er
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// parseUsage parses the comma-separated resource=amount list the kernel
+// returns for usage queries.
+func parseUsage(s string) (map[Resource]uint64, error) {
+	usage := map[Resource]uint64{}
+
+	for _, field := range strings.Split(s, ",") {
+		if field == "" {
+			continue
+		}
+
+		idx := strings.IndexByte(field, '=')
+		if idx < 0 {
+			return nil, fmt.Errorf("Malformed usage `%s'", field)
+		}
+
+		n, er := strconv.ParseUint(field[idx+1:], 10, 64)
+		if er != nil {
+			return nil, fmt.Errorf("Malformed usage `%s'", field)
+		}
+
+		usage[Resource(field[:idx])] = n
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,152 @@
+package rctl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		rule Rule
+		out  string
+	}{
+		{
+			"jail:www:memoryuse:deny=1g",
+			Rule{SubjectJail, "www", ResourceMemoryUse, ActionDeny, 1 << 30, ""},
+			"jail:www:memoryuse:deny=1073741824",
+		},
+		{
+			"loginclass:users:maxproc:deny=100/user",
+			Rule{SubjectLoginClass, "users", ResourceMaxProc, ActionDeny, 100, SubjectUser},
+			"loginclass:users:maxproc:deny=100/user",
+		},
+		{
+			"user:1001:pcpu:throttle=50",
+			Rule{SubjectUser, "1001", ResourcePcpu, ActionThrottle, 50, ""},
+			"user:1001:pcpu:throttle=50",
+		},
+		{
+			"process:42:openfiles:sigterm=512",
+			Rule{SubjectProcess, "42", ResourceOpenFiles, SignalAction("SIGTERM"), 512, ""},
+			"process:42:openfiles:sigterm=512",
+		},
+		{
+			"jail:db:readbps:throttle=10M",
+			Rule{SubjectJail, "db", ResourceReadBps, ActionThrottle, 10 << 20, ""},
+			"jail:db:readbps:throttle=10485760",
+		},
+		{"jail:www", Rule{Subject: SubjectJail, SubjectId: "www"}, "jail:www"},
+		{"jail::maxproc", Rule{Subject: SubjectJail, Resource: ResourceMaxProc}, "jail::maxproc"},
+		{"", Rule{}, ""},
+	} {
+		rule, er := ParseRule(test.in)
+		if er != nil {
+			t.Errorf("%s: %s", test.in, er)
+			continue
+		}
+
+		if rule != test.rule {
+			t.Errorf("%s: parsed as %#v", test.in, rule)
+		}
+
+		if rule.String() != test.out {
+			t.Errorf("%s: formatted as `%s', expected `%s'", test.in, rule, test.out)
+		}
+	}
+
+	for _, bad := range []string{
+		"prison:www:memoryuse:deny=1",
+		"jail:www:memory:deny=1",
+		"jail:www:memoryuse:explode=1",
+		"jail:www:memoryuse:deny=lots",
+		"jail:www:memoryuse:deny=1x",
+		"jail:www:memoryuse:deny=1/group",
+		"jail:www:memoryuse:deny=16777216e",
+		"jail:www:memoryuse:sig=1",
+	} {
+		if _, er := ParseRule(bad); er == nil {
+			t.Errorf("Expected `%s' to be rejected", bad)
+		}
+	}
+}
+
+func TestRuleFilter(t *testing.T) {
+	filter := Rule{Subject: SubjectJail, SubjectId: "www", Resource: ResourceMemoryUse, Action: ActionDeny}
+	if filter.filter() != "jail:www:memoryuse:deny" {
+		t.Errorf("Unexpected filter `%s'", filter.filter())
+	}
+
+	if filter.String() != "jail:www:memoryuse:deny=0" {
+		t.Errorf("Unexpected rule `%s'", filter)
+	}
+
+	if (Rule{}).filter() != "" {
+		t.Errorf("The zero Rule should match everything")
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	full := Rule{SubjectJail, "www", ResourceMaxProc, ActionDeny, 10, ""}
+	if er := full.validate(); er != nil {
+		t.Error(er)
+	}
+
+	partial := Rule{Subject: SubjectJail, SubjectId: "www", Resource: ResourceMaxProc}
+	if er := partial.validate(); er == nil {
+		t.Errorf("A rule without an action should not validate")
+	}
+
+	if er := partial.validateSubject(); er != nil {
+		t.Error(er)
+	}
+
+	noId := Rule{Subject: SubjectJail}
+	if er := noId.validateSubject(); er == nil {
+		t.Errorf("A subject without an ID should not validate")
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, er := parseRules("jail:www:memoryuse:deny=1073741824,jail:www:maxproc:deny=100,")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	expected := []Rule{
+		{SubjectJail, "www", ResourceMemoryUse, ActionDeny, 1 << 30, ""},
+		{SubjectJail, "www", ResourceMaxProc, ActionDeny, 100, ""},
+	}
+
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("Unexpected rules %v", rules)
+	}
+
+	if rules, er := parseRules(""); er != nil || len(rules) != 0 {
+		t.Errorf("Expected no rules, got %v (%v)", rules, er)
+	}
+}
+
+func TestParseUsage(t *testing.T) {
+	usage, er := parseUsage("cputime=12,memoryuse=8388608,maxproc=3,pcpu=0")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	expected := map[Resource]uint64{
+		ResourceCpuTime:   12,
+		ResourceMemoryUse: 8 << 20,
+		ResourceMaxProc:   3,
+		ResourcePcpu:      0,
+	}
+
+	if !reflect.DeepEqual(usage, expected) {
+		t.Errorf("Unexpected usage %v", usage)
+	}
+
+	for _, bad := range []string{"cputime", "cputime=-1", "cputime=lots"} {
+		if _, er := parseUsage(bad); er == nil {
+			t.Errorf("Expected `%s' to be rejected", bad)
+		}
+	}
+}